@@ -5,6 +5,8 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"healthcare-system-sawtooth/client/db/models"
 	"healthcare-system-sawtooth/client/lib"
 	"healthcare-system-sawtooth/crypto"
@@ -39,6 +41,7 @@ func GenerateDataInfo(name, target, publicKey, username, keyAes string, accessTy
 		Addr:       username,
 		Key:        crypto.BytesToHex(keyEncrypt),
 		AccessType: accessType,
+		Expiration: expiration,
 	}
 	return
 }
@@ -61,34 +64,197 @@ func GenerateSharedDataInfo(name, publicKey, username, keyAes, hash string, size
 	return
 }
 
-// EncryptData encrypt the data using AES-CTR. After encryption, calculate the hash of data.
-func EncryptData(in, keyAes []byte) (hash string, out []byte, err error) {
+// envelopeMagic starts the versioned ciphertext envelope, which distinguishes it from the legacy AES-CTR data
+// starting with the random iv.
+var envelopeMagic = []byte("hce")
+
+// Errors of decryption
+var (
+	ErrUnsupportedEnvelope = errors.New("unsupported ciphertext envelope")
+	ErrInvalidCiphertext   = errors.New("invalid ciphertext")
+	// ErrIntegrityViolation is wrapped by IntegrityError, check it by errors.Is.
+	ErrIntegrityViolation = errors.New("integrity violation")
+)
+
+// IntegrityError is the error of the data stored off-chain, which doesn't match the hash stored on the blockchain.
+type IntegrityError struct {
+	Hash   string // Hash stored on the blockchain
+	Actual string // Hash of the data stored off-chain, empty if the data is missing
+}
+
+func (e *IntegrityError) Error() string {
+	if e.Actual == "" {
+		return fmt.Sprintf("%v: data %s is missing", ErrIntegrityViolation, e.Hash)
+	}
+	if e.Actual == e.Hash {
+		return fmt.Sprintf("%v: data %s fails authentication", ErrIntegrityViolation, e.Hash)
+	}
+	return fmt.Sprintf("%v: data %s has hash %s", ErrIntegrityViolation, e.Hash, e.Actual)
+}
+
+// Unwrap returns ErrIntegrityViolation.
+func (e *IntegrityError) Unwrap() error {
+	return ErrIntegrityViolation
+}
 
-	iv := make([]byte, lib.IvSize)
-	_, err = rand.Read(iv)
+// EncryptData encrypt the data using AES-256-GCM into the versioned envelope:
+// magic, version byte, algorithm byte, nonce, and ciphertext with the tag.
+// The hash of the data is calculated over the envelope without the tag, and the header of the envelope and the hash
+// are the associated data of the tag, so the data can't be changed without the key or be used as the data of another hash.
+func EncryptData(in, keyAes []byte) (hash string, out []byte, err error) {
+	aead, err := newGCM(keyAes)
 	if err != nil {
 		return
 	}
-	block, err := aes.NewCipher(keyAes)
+	nonce := make([]byte, lib.NonceSize)
+	_, err = rand.Read(nonce)
 	if err != nil {
 		return
 	}
-	ctr := cipher.NewCTR(block, iv)
+	header := append(append(append([]byte{}, envelopeMagic...), lib.EnvelopeVersion, lib.AlgorithmAESGCM), nonce...)
+	body, err := gcmCiphertext(keyAes, nonce, in)
+	if err != nil {
+		return
+	}
+	hash = envelopeHash(header, body)
+	out = aead.Seal(header, nonce, in, associatedData(header, hash))
+	return
+}
 
-	hashes := make([][]byte, 0)
-	outBuf := make([]byte, len(in))
+// DecryptData decrypt the data from the versioned envelope, or the legacy data encrypted using AES-CTR.
+// The hash of data is calculated the same way as EncryptData does.
+func DecryptData(in, key []byte) (hash string, out []byte, err error) {
+	if !isEnvelope(in) {
+		return decryptDataCTR(in, key)
+	}
+	header, body, err := splitEnvelope(in)
+	if err != nil {
+		return "", nil, err
+	}
+	hash = envelopeHash(header, body)
+	out, err = openEnvelope(in, key, hash)
+	return hash, out, err
+}
 
-	ctr.XORKeyStream(outBuf, in)
-	hashes = append(hashes, crypto.SHA512BytesFromBytes(outBuf))
+// OpenData verifies the data against the hash stored on the blockchain, and decrypt it.
+// The data whose tag is changed fails to decrypt.
+// IntegrityError is returned if the data doesn't match the hash.
+func OpenData(in, key []byte, hash string) ([]byte, error) {
+	err := VerifyData(in, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !isEnvelope(in) {
+		_, out, err := decryptDataCTR(in, key)
+		return out, err
+	}
+	out, err := openEnvelope(in, key, hash)
+	if err == ErrInvalidCiphertext {
+		return nil, &IntegrityError{Hash: hash, Actual: hash}
+	}
+	return out, err
+}
 
-	out = append(iv, outBuf...)
-	hash = crypto.SHA512HexFromBytes(bytes.Join(hashes, []byte{}))
-	return
+// HashData calculates the hash of the encrypted data the same way as EncryptData, without decrypting it.
+func HashData(in []byte) (string, error) {
+	if !isEnvelope(in) {
+		if len(in) < lib.IvSize {
+			return "", ErrInvalidCiphertext
+		}
+		return legacyHash(in[lib.IvSize:]), nil
+	}
+	header, body, err := splitEnvelope(in)
+	if err != nil {
+		return "", err
+	}
+	return envelopeHash(header, body), nil
 }
 
-// DecryptData decrypt the data using AES-CTR. After decryption, calculate the hash of data.
-func DecryptData(in, key []byte) (hash string, out []byte, err error) {
+// VerifyData checks the encrypted data against the hash stored on the blockchain.
+// IntegrityError is returned if the data doesn't match the hash.
+func VerifyData(in []byte, hash string) error {
+	actual, err := HashData(in)
+	if err == ErrInvalidCiphertext {
+		return &IntegrityError{Hash: hash, Actual: crypto.SHA512HexFromBytes(in)}
+	} else if err != nil {
+		return err
+	}
+	if actual != hash {
+		return &IntegrityError{Hash: hash, Actual: actual}
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, lib.NonceSize)
+}
+
+func isEnvelope(in []byte) bool {
+	return bytes.HasPrefix(in, envelopeMagic)
+}
 
+// splitEnvelope returns the header and the ciphertext without the tag of the envelope.
+func splitEnvelope(in []byte) (header, body []byte, err error) {
+	headerSize := len(envelopeMagic) + 2 + lib.NonceSize
+	if len(in) < headerSize+lib.TagSize {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	if in[len(envelopeMagic)] != lib.EnvelopeVersion || in[len(envelopeMagic)+1] != lib.AlgorithmAESGCM {
+		return nil, nil, ErrUnsupportedEnvelope
+	}
+	return in[:headerSize], in[headerSize : len(in)-lib.TagSize], nil
+}
+
+func openEnvelope(in, key []byte, hash string) ([]byte, error) {
+	header, _, err := splitEnvelope(in)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := aead.Open(nil, header[len(header)-lib.NonceSize:], in[len(header):], associatedData(header, hash))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return out, nil
+}
+
+func envelopeHash(header, body []byte) string {
+	return crypto.SHA512HexFromBytes(append(append([]byte{}, header...), body...))
+}
+
+// associatedData returns the associated data of the tag of the envelope, the header and the hash of the envelope.
+func associatedData(header []byte, hash string) []byte {
+	return append(append([]byte{}, header...), hash...)
+}
+
+// gcmCiphertext returns the ciphertext of AES-GCM without the tag, which is the keystream of AES-CTR starting
+// from the second counter block of the nonce. The hash is calculated over it before the tag is sealed only once.
+func gcmCiphertext(key, nonce, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, nonce)
+	counter[aes.BlockSize-1] = 2
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, counter).XORKeyStream(out, in)
+	return out, nil
+}
+
+// decryptDataCTR decrypt the legacy data using AES-CTR. The hash is calculated over the ciphertext without the iv,
+// the same way as the legacy encryption did.
+func decryptDataCTR(in, key []byte) (hash string, out []byte, err error) {
+	if len(in) < lib.IvSize {
+		return "", nil, ErrInvalidCiphertext
+	}
 	iv := in[:lib.IvSize]
 	enc := in[lib.IvSize:]
 
@@ -98,17 +264,17 @@ func DecryptData(in, key []byte) (hash string, out []byte, err error) {
 	}
 	ctr := cipher.NewCTR(block, iv)
 
-	hashes := make([][]byte, 0)
-	outBuf := make([]byte, len(enc))
-
-	ctr.XORKeyStream(outBuf, enc)
-	hashes = append(hashes, crypto.SHA512BytesFromBytes(outBuf))
-
-	out = outBuf
-	hash = crypto.SHA512HexFromBytes(bytes.Join(hashes, []byte{}))
+	out = make([]byte, len(enc))
+	ctr.XORKeyStream(out, enc)
+	hash = legacyHash(enc)
 	return
 }
 
+// legacyHash is the hash of the legacy data, SHA-512 of SHA-512 of the ciphertext without the iv.
+func legacyHash(enc []byte) string {
+	return crypto.SHA512HexFromBytes(crypto.SHA512BytesFromBytes(enc))
+}
+
 // CalDataHash calculate the hash of data.
 func CalDataHash(data string) (hash string, err error) {
 	hash = crypto.SHA512HexFromBytes([]byte(data))
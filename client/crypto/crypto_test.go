@@ -1,6 +1,11 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"testing"
 
@@ -18,10 +23,104 @@ func TestEncryptFile(t *testing.T) {
 	}
 	t.Log(hash)
 
-	hash, out, err = DecryptData(out, key)
+	decryptedHash, out, err := DecryptData(out, key)
 	if err != nil {
 		t.Error(err)
 	}
 	assert.Equal(t, string(in), string(out))
-	t.Log(hash)
+	assert.Equal(t, hash, decryptedHash)
+}
+
+func TestOpenData(t *testing.T) {
+	in := []byte("blood type: A+")
+	hash, out, err := EncryptData(in, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hce"), out[:3])
+	assert.Equal(t, lib.EnvelopeVersion, out[3])
+	assert.Equal(t, lib.AlgorithmAESGCM, out[4])
+	// the hash is calculated over the ciphertext sealed by the tag
+	header, body, err := splitEnvelope(out)
+	assert.NoError(t, err)
+	assert.Equal(t, envelopeHash(header, body), hash)
+
+	plain, err := OpenData(out, key, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, in, plain)
+
+	// the data of another hash isn't decrypted
+	otherHash, _, err := EncryptData(in, key)
+	assert.NoError(t, err)
+	_, err = OpenData(out, key, otherHash)
+	assert.True(t, errors.Is(err, ErrIntegrityViolation))
+	// the hash is authenticated by the tag
+	_, err = openEnvelope(out, key, otherHash)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	// the modified data isn't decrypted
+	modified := append([]byte{}, out...)
+	modified[len(modified)-lib.TagSize-1] ^= 1
+	_, err = OpenData(modified, key, hash)
+	assert.Equal(t, &IntegrityError{Hash: hash, Actual: tpCrypto.SHA512HexFromBytes(modified[:len(modified)-lib.TagSize])}, err)
+	_, _, err = DecryptData(modified, key)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	// the modified tag fails authentication
+	modified = append([]byte{}, out...)
+	modified[len(modified)-1] ^= 1
+	assert.NoError(t, VerifyData(modified, hash))
+	_, err = OpenData(modified, key, hash)
+	assert.True(t, errors.Is(err, ErrIntegrityViolation))
+
+	modified = append([]byte{}, out...)
+	modified[3] = 2
+	_, err = OpenData(modified, key, hash)
+	assert.Equal(t, ErrUnsupportedEnvelope, err)
+
+	_, err = OpenData(out[:10], key, hash)
+	assert.True(t, errors.Is(err, ErrIntegrityViolation))
+}
+
+func TestDecryptLegacyData(t *testing.T) {
+	in := []byte("legacy")
+	hash, enc, err := encryptDataCTR(in, key)
+	assert.NoError(t, err)
+
+	decryptedHash, out, err := DecryptData(enc, key)
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+	assert.Equal(t, hash, decryptedHash)
+
+	out, err = OpenData(enc, key, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+	assert.NoError(t, VerifyData(enc, hash))
+
+	enc[lib.IvSize] ^= 1
+	_, err = OpenData(enc, key, hash)
+	assert.True(t, errors.Is(err, ErrIntegrityViolation))
+}
+
+// encryptDataCTR is EncryptData before the envelope, which encrypted the data stored before.
+func encryptDataCTR(in, keyAes []byte) (hash string, out []byte, err error) {
+
+	iv := make([]byte, lib.IvSize)
+	_, err = rand.Read(iv)
+	if err != nil {
+		return
+	}
+	block, err := aes.NewCipher(keyAes)
+	if err != nil {
+		return
+	}
+	ctr := cipher.NewCTR(block, iv)
+
+	hashes := make([][]byte, 0)
+	outBuf := make([]byte, len(in))
+
+	ctr.XORKeyStream(outBuf, in)
+	hashes = append(hashes, tpCrypto.SHA512BytesFromBytes(outBuf))
+
+	out = append(iv, outBuf...)
+	hash = tpCrypto.SHA512HexFromBytes(bytes.Join(hashes, []byte{}))
+	return
 }
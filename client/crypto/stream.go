@@ -0,0 +1,262 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"healthcare-system-sawtooth/client/db/models"
+	"healthcare-system-sawtooth/client/lib"
+	"healthcare-system-sawtooth/crypto"
+	tpStorage "healthcare-system-sawtooth/tp/storage"
+)
+
+// streamMagic starts the header of the chunked stream, which is stored as the payload of the data.
+var streamMagic = []byte("hcs")
+
+// The nonce of the chunk is the random prefix of the stream, the index of the chunk and the flag of the last chunk,
+// so the chunks can't be reordered, dropped or truncated without failing authentication.
+const (
+	noncePrefixSize  = lib.NonceSize - 5
+	streamHeaderSize = 3 + 2 + 4 + noncePrefixSize
+)
+
+// ChunkWriter stores the sealed chunks of the stream in order. The chunk must not be retained after the call.
+type ChunkWriter interface {
+	WriteChunk(index int, chunk []byte) error
+}
+
+// ChunkReader reads the sealed chunks of the stream by index. io.EOF is returned after the last chunk.
+type ChunkReader interface {
+	ReadChunk(index int) ([]byte, error)
+}
+
+// GenerateStreamDataInfo encrypts the data read from the reader as the chunked stream,
+// and generates the information of data for storage system.
+func GenerateStreamDataInfo(name string, r io.Reader, publicKey, username, keyAes string, accessType uint) (info tpStorage.DataInfo, err error) {
+	keyEncrypt, err := crypto.Encryption(publicKey, keyAes)
+	if err != nil {
+		return
+	}
+	store := models.NewChunkStore()
+	header, hash, size, err := EncryptStream(store, r, crypto.HexToBytes(keyAes))
+	if err == nil {
+		data := &models.Data{
+			Name:    name,
+			Hash:    hash,
+			Payload: crypto.BytesToHex(header),
+			Stream:  &store.Stream,
+		}
+		_, err = data.Save()
+	}
+	if err != nil {
+		models.DeleteChunksByStreams([]primitive.ObjectID{store.Stream})
+		return
+	}
+	info = tpStorage.DataInfo{
+		Name:       name,
+		Size:       size,
+		Hash:       hash,
+		Addr:       username,
+		Key:        crypto.BytesToHex(keyEncrypt),
+		AccessType: accessType,
+	}
+	return
+}
+
+// EncryptStream encrypts the data read from src using AES-256-GCM in chunks of lib.ChunkSize, and writes the sealed
+// chunks to dst one by one. It returns the header of the stream, the hash of the stream and the size of the data.
+// The hash is SHA-512 of the header and the Merkle root of the sealed chunks.
+func EncryptStream(dst ChunkWriter, src io.Reader, keyAes []byte) (header []byte, hash string, size int64, err error) {
+	aead, err := newGCM(keyAes)
+	if err != nil {
+		return
+	}
+	header = make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	header[3] = lib.StreamVersion
+	header[4] = lib.AlgorithmAESGCM
+	binary.BigEndian.PutUint32(header[5:9], lib.ChunkSize)
+	_, err = rand.Read(header[9:])
+	if err != nil {
+		return
+	}
+	var tree merkleTree
+	buf := make([]byte, lib.ChunkSize)
+	sealed := make([]byte, 0, lib.ChunkSize+lib.TagSize)
+	in := bufio.NewReader(src)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, "", 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, err = in.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return nil, "", 0, err
+			}
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(header, index, last), buf[:n], header)
+		err = dst.WriteChunk(index, sealed)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		tree.add(sealed)
+		size += int64(n)
+		if last {
+			break
+		}
+	}
+	return header, streamHash(header, tree.root()), size, nil
+}
+
+// DecryptStream decrypts the chunks read from src and writes the data to dst one chunk at a time.
+// Every chunk is authenticated before it is written, and the hash of the stream is checked after the last chunk,
+// so the data written before the error must be discarded. IntegrityError is returned if the stream doesn't match the hash.
+func DecryptStream(dst io.Writer, src ChunkReader, header, keyAes []byte, hash string) (size int64, err error) {
+	err = checkStreamHeader(header)
+	if err != nil {
+		return
+	}
+	aead, err := newGCM(keyAes)
+	if err != nil {
+		return
+	}
+	var tree merkleTree
+	buf := make([]byte, 0, lib.ChunkSize)
+	for index := 0; ; index++ {
+		chunk, err := src.ReadChunk(index)
+		if err == io.EOF {
+			// the last chunk is missing
+			return size, &IntegrityError{Hash: hash, Actual: streamHash(header, tree.root())}
+		}
+		if err != nil {
+			return size, err
+		}
+		tree.add(chunk)
+		last := false
+		out, err := aead.Open(buf[:0], chunkNonce(header, index, false), chunk, header)
+		if err != nil {
+			last = true
+			out, err = aead.Open(buf[:0], chunkNonce(header, index, true), chunk, header)
+			if err != nil {
+				return size, &IntegrityError{Hash: hash, Actual: hash}
+			}
+		}
+		_, err = dst.Write(out)
+		if err != nil {
+			return size, err
+		}
+		size += int64(len(out))
+		if last {
+			break
+		}
+	}
+	return size, verifyStream(src, &tree, header, hash)
+}
+
+// VerifyStream checks the chunks read from src against the hash stored on the blockchain, without decrypting them.
+// IntegrityError is returned if the stream doesn't match the hash.
+func VerifyStream(src ChunkReader, header []byte, hash string) error {
+	err := checkStreamHeader(header)
+	if err != nil {
+		return &IntegrityError{Hash: hash, Actual: crypto.SHA512HexFromBytes(header)}
+	}
+	return verifyStream(src, &merkleTree{}, header, hash)
+}
+
+// IsStreamHeader reports whether the payload of the data is the header of the chunked stream.
+func IsStreamHeader(in []byte) bool {
+	return bytes.HasPrefix(in, streamMagic)
+}
+
+// verifyStream reads the rest of the chunks into the tree, and checks its root against the hash.
+func verifyStream(src ChunkReader, tree *merkleTree, header []byte, hash string) error {
+	for index := tree.leaves; ; index++ {
+		chunk, err := src.ReadChunk(index)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		tree.add(chunk)
+	}
+	if actual := streamHash(header, tree.root()); actual != hash {
+		return &IntegrityError{Hash: hash, Actual: actual}
+	}
+	return nil
+}
+
+func checkStreamHeader(header []byte) error {
+	if len(header) != streamHeaderSize || !IsStreamHeader(header) {
+		return ErrInvalidCiphertext
+	}
+	if header[3] != lib.StreamVersion || header[4] != lib.AlgorithmAESGCM || binary.BigEndian.Uint32(header[5:9]) != lib.ChunkSize {
+		return ErrUnsupportedEnvelope
+	}
+	return nil
+}
+
+func chunkNonce(header []byte, index int, last bool) []byte {
+	nonce := make([]byte, lib.NonceSize)
+	copy(nonce, header[9:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	if last {
+		nonce[lib.NonceSize-1] = 1
+	}
+	return nonce
+}
+
+func streamHash(header, root []byte) string {
+	return crypto.SHA512HexFromBytes(append(append([]byte{}, header...), root...))
+}
+
+// merkleTree calculates the Merkle root of the chunks incrementally, keeping the roots of the complete subtrees only.
+// Leaves and nodes are hashed with the prefixes 0 and 1 as in RFC 6962, and the root is the same as RFC 6962 defines.
+type merkleTree struct {
+	leaves int
+	stack  []merkleNode
+}
+
+type merkleNode struct {
+	hash   []byte
+	leaves int
+}
+
+func (t *merkleTree) add(chunk []byte) {
+	h := sha512.New()
+	h.Write([]byte{0})
+	h.Write(chunk)
+	t.stack = append(t.stack, merkleNode{hash: h.Sum(nil), leaves: 1})
+	t.leaves++
+	for n := len(t.stack); n > 1 && t.stack[n-2].leaves == t.stack[n-1].leaves; n = len(t.stack) {
+		t.stack = append(t.stack[:n-2], merkleNode{hash: merkleHash(t.stack[n-2].hash, t.stack[n-1].hash), leaves: 2 * t.stack[n-1].leaves})
+	}
+}
+
+func (t *merkleTree) root() []byte {
+	if len(t.stack) == 0 {
+		h := sha512.Sum512(nil)
+		return h[:]
+	}
+	root := t.stack[len(t.stack)-1].hash
+	for i := len(t.stack) - 2; i >= 0; i-- {
+		root = merkleHash(t.stack[i].hash, root)
+	}
+	return root
+}
+
+func merkleHash(left, right []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"healthcare-system-sawtooth/client/lib"
+)
+
+// memoryChunks stores the chunks of the stream in memory.
+type memoryChunks [][]byte
+
+func (m *memoryChunks) WriteChunk(index int, chunk []byte) error {
+	*m = append(*m, append([]byte{}, chunk...))
+	return nil
+}
+
+func (m *memoryChunks) ReadChunk(index int) ([]byte, error) {
+	if index >= len(*m) {
+		return nil, io.EOF
+	}
+	return (*m)[index], nil
+}
+
+func TestStream(t *testing.T) {
+	// the empty data is sealed as one empty chunk, and the data of the exact chunk size isn't followed by the empty chunk
+	for size, count := range map[int]int{0: 1, 10: 1, lib.ChunkSize: 1, 2*lib.ChunkSize + 1: 3} {
+		in := bytes.Repeat([]byte{'a'}, size)
+		var chunks memoryChunks
+		header, hash, n, err := EncryptStream(&chunks, bytes.NewReader(in), key)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), n)
+		assert.True(t, IsStreamHeader(header))
+		assert.Equal(t, count, len(chunks))
+		assert.NoError(t, VerifyStream(&chunks, header, hash))
+
+		var out bytes.Buffer
+		n, err = DecryptStream(&out, &chunks, header, key, hash)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), n)
+		assert.Equal(t, string(in), out.String())
+	}
+}
+
+func TestStreamTampered(t *testing.T) {
+	in := bytes.Repeat([]byte{'a'}, 2*lib.ChunkSize+1)
+	var chunks memoryChunks
+	header, hash, _, err := EncryptStream(&chunks, bytes.NewReader(in), key)
+	assert.NoError(t, err)
+
+	tampered := map[string]memoryChunks{
+		"flipped":   {chunks[0], append([]byte{chunks[1][0] ^ 1}, chunks[1][1:]...), chunks[2]},
+		"reordered": {chunks[1], chunks[0], chunks[2]},
+		"truncated": {chunks[0], chunks[1]},
+		"extended":  {chunks[0], chunks[1], chunks[2], chunks[2]},
+	}
+	for name, c := range tampered {
+		var integrityErr *IntegrityError
+		_, err = DecryptStream(io.Discard, &c, header, key, hash)
+		assert.True(t, errors.As(err, &integrityErr), name)
+		err = VerifyStream(&c, header, hash)
+		assert.True(t, errors.As(err, &integrityErr), name)
+	}
+}
+
+func TestMerkleTree(t *testing.T) {
+	var chunks [][]byte
+	var tree merkleTree
+	assert.Equal(t, merkleRoot(nil), tree.root())
+	for i := 0; i < 9; i++ {
+		chunk := []byte{byte(i)}
+		chunks = append(chunks, chunk)
+		tree.add(chunk)
+		assert.Equal(t, merkleRoot(chunks), tree.root())
+	}
+}
+
+// merkleRoot calculates the Merkle root of the chunks as RFC 6962 defines.
+func merkleRoot(chunks [][]byte) []byte {
+	switch len(chunks) {
+	case 0:
+		h := sha512.Sum512(nil)
+		return h[:]
+	case 1:
+		h := sha512.Sum512(append([]byte{0}, chunks[0]...))
+		return h[:]
+	}
+	k := 1
+	for k*2 < len(chunks) {
+		k *= 2
+	}
+	return merkleHash(merkleRoot(chunks[:k]), merkleRoot(chunks[k:]))
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"healthcare-system-sawtooth/client/db"
+)
+
+// Chunk of the encrypted data stream for MongoDB
+type Chunk struct {
+	OID     *primitive.ObjectID `json:"OID" bson:"_id,omitempty"`
+	Stream  primitive.ObjectID  `json:"stream" bson:"stream"`
+	Index   int                 `json:"index" bson:"index"`
+	Payload []byte              `json:"payload" bson:"payload"`
+}
+
+// ChunkStore writes and reads the chunks of the stream one by one,
+// so the stream is stored and loaded in constant memory.
+type ChunkStore struct {
+	Stream primitive.ObjectID
+}
+
+// NewChunkStore is the construct for ChunkStore of new stream.
+func NewChunkStore() *ChunkStore {
+	return &ChunkStore{Stream: primitive.NewObjectID()}
+}
+
+// WriteChunk stores the chunk of the stream by index.
+func (s *ChunkStore) WriteChunk(index int, chunk []byte) error {
+	ctx, cancel := db.GetMongoContext()
+	defer cancel()
+	col, err := getMongoChunkCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = col.InsertOne(ctx, &Chunk{Stream: s.Stream, Index: index, Payload: chunk})
+	return err
+}
+
+// ReadChunk gets the chunk of the stream by index. io.EOF is returned after the last chunk.
+func (s *ChunkStore) ReadChunk(index int) ([]byte, error) {
+	ctx, cancel := db.GetMongoContext()
+	defer cancel()
+	col, err := getMongoChunkCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunk := &Chunk{}
+	err = col.FindOne(ctx, bson.M{"stream": s.Stream, "index": index}).Decode(chunk)
+	if err == mongo.ErrNoDocuments {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chunk.Payload, nil
+}
+
+// DeleteChunksByStreams deletes the chunks of the streams from the database
+func DeleteChunksByStreams(streams []primitive.ObjectID) error {
+	if len(streams) == 0 {
+		return nil
+	}
+	ctx, cancel := db.GetMongoContext()
+	defer cancel()
+	col, err := getMongoChunkCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = col.DeleteMany(ctx, bson.M{"stream": bson.M{"$in": streams}})
+	return err
+}
+
+// Get table name
+func getMongoChunkCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.GetMongoCollection(ctx, db.MongoChunkCollection)
+}
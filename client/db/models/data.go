@@ -9,12 +9,15 @@ import (
 )
 
 // Data model for MongoDB
+// The data encrypted as the chunked stream has the header of the stream as the payload,
+// and its chunks are stored separately by the stream.
 type Data struct {
 	OID        *primitive.ObjectID `json:"OID" bson:"_id,omitempty"`
 	Hash       string              `json:"hash"`
 	Name       string              `json:"name"`
 	Payload    string              `json:"payload"`
 	Expiration int64               `json:"expiration"`
+	Stream     *primitive.ObjectID `json:"stream" bson:"stream,omitempty"`
 }
 
 // Save stores data into the database
@@ -90,6 +93,30 @@ func DeleteDatasByOid(oids []*primitive.ObjectID) error {
 		return err
 	}
 	filter := bson.M{"_id": bson.M{"$in": oids}}
+	err = deleteStreams(ctx, col, filter)
+	if err != nil {
+		return err
+	}
+	_, err = col.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteDatasByHashes deletes data from the database by hashes
+func DeleteDatasByHashes(hashes []string) error {
+	ctx, cancel := db.GetMongoContext()
+	defer cancel()
+	col, err := getMongoDataCollection(ctx)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"hash": bson.M{"$in": hashes}}
+	err = deleteStreams(ctx, col, filter)
+	if err != nil {
+		return err
+	}
 	_, err = col.DeleteMany(ctx, filter)
 	if err != nil {
 		return err
@@ -97,6 +124,24 @@ func DeleteDatasByOid(oids []*primitive.ObjectID) error {
 	return nil
 }
 
+// deleteStreams deletes the chunks of the data matched by the filter, which is stored as the chunked stream.
+func deleteStreams(ctx context.Context, col *mongo.Collection, filter bson.M) error {
+	c, err := col.Find(ctx, bson.M{"$and": []bson.M{filter, {"stream": bson.M{"$exists": true}}}})
+	if err != nil {
+		return err
+	}
+	var pms []*Data
+	err = c.All(ctx, &pms)
+	if err != nil {
+		return err
+	}
+	streams := make([]primitive.ObjectID, 0, len(pms))
+	for _, d := range pms {
+		streams = append(streams, *d.Stream)
+	}
+	return DeleteChunksByStreams(streams)
+}
+
 // Get table name
 func getMongoDataCollection(ctx context.Context) (*mongo.Collection, error) {
 	return db.GetMongoCollection(ctx, db.MongoDataCollection)
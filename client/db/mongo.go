@@ -16,8 +16,9 @@ import (
 
 const (
 	// Name of the table in MongoDB
-	MongoDataCollection    = "Datas"
-	MongoRequestCollection = "Requests"
+	MongoDataCollection = "Datas"
+	// Name of the table of the chunks of encrypted data streams in MongoDB
+	MongoChunkCollection = "Chunks"
 )
 
 // MongoDB connection client
@@ -109,6 +110,15 @@ func CreateIndexes(ctx context.Context, client *mongo.Client) error {
 		return err
 	}
 
+	chunks := client.Database(GetMongoDbName()).Collection(MongoChunkCollection)
+	_, err = chunks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "stream", Value: 1}, {Key: "index", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
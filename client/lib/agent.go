@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+)
+
+// The endpoints of the key agent. Every request and response is the agentMessage in JSON.
+const (
+	agentPublicKeyAPI    = "/public-key"
+	agentSignAPI         = "/sign"
+	agentDecryptAPI      = "/decrypt"
+	agentProxyDecryptAPI = "/proxy-decrypt"
+	agentReKeyAPI        = "/rekey"
+	agentTimeout         = 30 * time.Second
+	agentUnixScheme      = "unix://"
+)
+
+// agentMessage is the request and the response of the key agent. Bytes are hex encoded.
+type agentMessage struct {
+	PublicKey      string `json:"public_key,omitempty"`
+	ProxyPublicKey string `json:"proxy_public_key,omitempty"`
+	Data           string `json:"data,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// remoteKeyProvider asks the key agent, which holds the private key, to sign and decrypt.
+type remoteKeyProvider struct {
+	url            string
+	client         *http.Client
+	publicKey      string
+	proxyPublicKey string
+}
+
+// NewRemoteKeyProvider is the construct for the KeyProvider of the key agent at the address, unix:///path/to/agent.sock.
+func NewRemoteKeyProvider(address string) (KeyProvider, error) {
+	if !strings.HasPrefix(address, agentUnixScheme) {
+		return nil, fmt.Errorf("invalid key agent address, the key agent listens on the Unix socket only: %s", address)
+	}
+	socket := strings.TrimPrefix(address, agentUnixScheme)
+	p := &remoteKeyProvider{
+		url: "http://agent",
+		client: &http.Client{
+			Timeout: agentTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+	resp, err := p.call(agentPublicKeyAPI, agentMessage{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = hex.DecodeString(resp.PublicKey); err != nil || resp.PublicKey == "" {
+		return nil, errors.New("invalid public key of key agent")
+	}
+	if _, err = hex.DecodeString(resp.ProxyPublicKey); err != nil || resp.ProxyPublicKey == "" {
+		return nil, errors.New("invalid proxy public key of key agent")
+	}
+	p.publicKey = resp.PublicKey
+	p.proxyPublicKey = resp.ProxyPublicKey
+	return p, nil
+}
+
+func (p *remoteKeyProvider) PublicKey() string {
+	return p.publicKey
+}
+
+func (p *remoteKeyProvider) ProxyPublicKey() string {
+	return p.proxyPublicKey
+}
+
+// Sign asks the key agent to sign the message, and verifies the signature against the public key of the agent.
+func (p *remoteKeyProvider) Sign(message []byte) ([]byte, error) {
+	signature, err := p.callData(agentSignAPI, agentMessage{Data: hex.EncodeToString(message)})
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _ := hex.DecodeString(p.publicKey)
+	if !signing.NewSecp256k1Context().Verify(signature, message, signing.NewSecp256k1PublicKey(publicKey)) {
+		return nil, errors.New("invalid signature of key agent")
+	}
+	return signature, nil
+}
+
+func (p *remoteKeyProvider) Decrypt(data string) ([]byte, error) {
+	return p.callData(agentDecryptAPI, agentMessage{Data: data})
+}
+
+func (p *remoteKeyProvider) ProxyDecrypt(data string) ([]byte, error) {
+	return p.callData(agentProxyDecryptAPI, agentMessage{Data: data})
+}
+
+func (p *remoteKeyProvider) ReEncryptionKey(publicKeyTo string) ([]byte, error) {
+	return p.callData(agentReKeyAPI, agentMessage{PublicKey: publicKeyTo})
+}
+
+// callData sends the request to the key agent, and returns the data of the response.
+func (p *remoteKeyProvider) callData(api string, req agentMessage) ([]byte, error) {
+	resp, err := p.call(api, req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response of key agent: %v", err)
+	}
+	return data, nil
+}
+
+func (p *remoteKeyProvider) call(api string, req agentMessage) (*agentMessage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.client.Post(p.url+api, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to key agent: %v", err)
+	}
+	defer response.Body.Close()
+	resp := &agentMessage{}
+	err = json.NewDecoder(response.Body).Decode(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error %d: %s", response.StatusCode, response.Status)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("key agent: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// NewKeyAgentHandler returns the handler of the key agent, which signs and decrypts by the KeyProvider.
+// Anyone who can connect to the agent can use the key, so it must listen on the protected Unix socket.
+func NewKeyAgentHandler(keys KeyProvider) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(api string, f func(req *agentMessage) ([]byte, error)) {
+		mux.HandleFunc(api, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			req := &agentMessage{}
+			if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(req) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(agentMessage{Error: "invalid request"})
+				return
+			}
+			data, err := f(req)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(agentMessage{Error: err.Error()})
+				return
+			}
+			json.NewEncoder(w).Encode(agentMessage{PublicKey: keys.PublicKey(), ProxyPublicKey: keys.ProxyPublicKey(), Data: hex.EncodeToString(data)})
+		})
+	}
+	handle(agentPublicKeyAPI, func(*agentMessage) ([]byte, error) {
+		return nil, nil
+	})
+	handle(agentSignAPI, func(req *agentMessage) ([]byte, error) {
+		message, err := hex.DecodeString(req.Data)
+		if err != nil {
+			return nil, err
+		}
+		return keys.Sign(message)
+	})
+	handle(agentDecryptAPI, func(req *agentMessage) ([]byte, error) {
+		return keys.Decrypt(req.Data)
+	})
+	handle(agentProxyDecryptAPI, func(req *agentMessage) ([]byte, error) {
+		return keys.ProxyDecrypt(req.Data)
+	})
+	handle(agentReKeyAPI, func(req *agentMessage) ([]byte, error) {
+		return keys.ReEncryptionKey(req.PublicKey)
+	})
+	return mux
+}
+
+// ListenKeyAgent listens on the address of the key agent, unix:///path/to/agent.sock.
+// The socket is created in the directory accessible by the owner only, which is created if it doesn't exist,
+// so no one else can connect before the socket itself is restricted to the owner. It is removed when the listener is closed.
+// TCP isn't supported, as anyone on the host could connect to the loopback and use the key.
+func ListenKeyAgent(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, agentUnixScheme) {
+		return nil, fmt.Errorf("invalid key agent address, the key agent listens on the Unix socket only: %s", address)
+	}
+	socket := strings.TrimPrefix(address, agentUnixScheme)
+	dir := filepath.Dir(socket)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("directory of key agent socket must be accessible by the owner only: %s", dir)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// isAgentURL reports whether the key file is the address of the key agent, rather than the path of the file.
+func isAgentURL(address string) bool {
+	return strings.Contains(address, "://")
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/stretchr/testify/assert"
+	tpCrypto "healthcare-system-sawtooth/crypto"
+)
+
+func TestKeyAgent(t *testing.T) {
+	keys, err := NewLocalKeyProvider(signing.NewSecp256k1Context().NewRandomPrivateKey().AsHex())
+	assert.NoError(t, err)
+	// the directory of the socket is created accessible by the owner only
+	dir := path.Join(t.TempDir(), "agent")
+	address := "unix://" + path.Join(dir, "agent.sock")
+	listener, err := ListenKeyAgent(address)
+	assert.NoError(t, err)
+	defer listener.Close()
+	go http.Serve(listener, NewKeyAgentHandler(keys))
+	info, err := os.Stat(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(strings.TrimPrefix(address, agentUnixScheme))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	remote, err := NewRemoteKeyProvider(address)
+	assert.NoError(t, err)
+	assert.Equal(t, keys.PublicKey(), remote.PublicKey())
+
+	signature, err := remote.Sign([]byte("header"))
+	assert.NoError(t, err)
+	expected, _ := keys.Sign([]byte("header"))
+	assert.Equal(t, expected, signature)
+
+	key := tpCrypto.BytesToHex(tpCrypto.GenerateRandomAESKey(AESKeySize))
+	encrypted, err := tpCrypto.Encryption(remote.PublicKey(), key)
+	assert.NoError(t, err)
+	decrypted, err := remote.Decrypt(tpCrypto.BytesToHex(encrypted))
+	assert.NoError(t, err)
+	assert.Equal(t, tpCrypto.HexToBytes(key), decrypted)
+
+	assert.Equal(t, keys.ProxyPublicKey(), remote.ProxyPublicKey())
+	encrypted, err = tpCrypto.ProxyEncryption(remote.ProxyPublicKey(), key)
+	assert.NoError(t, err)
+	decrypted, err = remote.ProxyDecrypt(tpCrypto.BytesToHex(encrypted))
+	assert.NoError(t, err)
+	assert.Equal(t, tpCrypto.HexToBytes(key), decrypted)
+
+	_, err = remote.Decrypt("00")
+	assert.Error(t, err)
+
+	// others could connect to the socket in the shared directory before it's restricted
+	shared := t.TempDir()
+	assert.NoError(t, os.Chmod(shared, 0755))
+	_, err = ListenKeyAgent("unix://" + path.Join(shared, "agent.sock"))
+	assert.Error(t, err)
+
+	// TCP isn't supported even on the loopback
+	for _, address := range []string{"http://127.0.0.1:0", "http://0.0.0.0:0", "tcp://127.0.0.1:0"} {
+		_, err = ListenKeyAgent(address)
+		assert.Error(t, err, address)
+		_, err = NewRemoteKeyProvider(address)
+		assert.Error(t, err, address)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -23,6 +26,7 @@ import (
 	"github.com/pebbe/zmq4"
 	"github.com/sirupsen/logrus"
 	tpCrypto "healthcare-system-sawtooth/crypto"
+	tpEvent "healthcare-system-sawtooth/tp/event"
 	tpPayload "healthcare-system-sawtooth/tp/payload"
 	tpState "healthcare-system-sawtooth/tp/state"
 )
@@ -34,15 +38,22 @@ const (
 
 // ClientFramework provides SeaStorage base operations for both user and sea.
 type ClientFramework struct {
-	Name       string // The name of user.
-	Category   bool   // The category of client framework.
-	PrivKeyHex []byte
-	signer     *signing.Signer
-	zmqConn    *messaging.ZmqConnection
-	corrID     string
-	waiting    bool
-	signal     chan bool
-	State      chan []byte
+	Name     string      // The name of user.
+	Category bool        // The category of client framework.
+	keys     KeyProvider // Signs and decrypts by the private key of the signer.
+	zmqConn  *messaging.ZmqConnection
+	corrID   string
+	waiting  bool
+	signal   chan bool
+	State    chan []byte
+	handlers map[string][]EventHandler
+	mutex    sync.Mutex
+	watched  []string // The address and the record prefix of the signer, whose state changes are watched.
+	// identity guards the name, which is changed while the signer acts on behalf of the patient.
+	identity sync.RWMutex
+	self     string        // The name of the signer, while it acts on behalf of the patient.
+	onBehalf string        // The public key of the patient the signer acts on behalf of.
+	stop     chan struct{} // Stops watching the events notified to the patient.
 }
 
 // NewClientFramework is the construct for ClientFramework.
@@ -53,24 +64,20 @@ func NewClientFramework(name string, category bool, keyFile string) (*ClientFram
 	if keyFile == "" {
 		return nil, errors.New("need a valid key")
 	}
-	// Read private key file
-	privateKeyHex, err := ioutil.ReadFile(keyFile)
+	// Read private key file, decrypt the keystore, or connect to the key agent
+	keys, err := LoadKeyProvider(keyFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %v", err)
+		return nil, err
 	}
-	// Get private key object
-	privateKey := signing.NewSecp256k1PrivateKey(tpCrypto.HexToBytes(string(privateKeyHex)))
-	cryptoFactory := signing.NewCryptoFactory(signing.NewSecp256k1Context())
-	signer := cryptoFactory.NewSigner(privateKey)
 	cf := &ClientFramework{
-		Name:       name,
-		Category:   category,
-		signer:     signer,
-		PrivKeyHex: privateKeyHex,
-		signal:     make(chan bool),
-		State:      make(chan []byte),
-	}
-	err = cf.generateZmqConnection()
+		Name:     name,
+		Category: category,
+		keys:     keys,
+		signal:   make(chan bool),
+		State:    make(chan []byte),
+		handlers: make(map[string][]EventHandler),
+	}
+	cf.zmqConn, err = newZmqConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +91,8 @@ func NewClientFramework(name string, category bool, keyFile string) (*ClientFram
 
 // Close is the deconstruct for ClientFramework.
 func (cf *ClientFramework) Close() {
-	err := cf.unsubscribeEvents(cf.corrID)
+	cf.StopActing()
+	err := unsubscribeEvents(cf.zmqConn, cf.corrID)
 	if err != nil {
 		Logger.WithFields(logrus.Fields{
 			"correlationID": cf.corrID,
@@ -96,11 +104,18 @@ func (cf *ClientFramework) Close() {
 
 // Register user. Create user in the blockchain.
 func (cf *ClientFramework) Register(name string) error {
+	if cf.IsActing() {
+		return errors.New("can't register on behalf of the patient")
+	}
 	var seaStoragePayload tpPayload.StoragePayload
 	seaStoragePayload.Action = tpPayload.CreateUser
 	seaStoragePayload.Target = []string{name}
+	cf.identity.Lock()
 	cf.Name = name
-	return cf.SendTransactionAndWaiting([]tpPayload.StoragePayload{seaStoragePayload}, []string{cf.GetAddress()}, []string{cf.GetAddress()})
+	cf.identity.Unlock()
+	addresses := []string{cf.GetAddress(), tpState.MakeAddress(tpState.AddressTypeName, name, "")}
+	inputs := append(addresses, tpState.MakeSettingAddress(tpState.SettingAdmins))
+	return cf.SendTransactionAndWaiting([]tpPayload.StoragePayload{seaStoragePayload}, inputs, addresses)
 }
 
 // GetData returns the data of user.
@@ -110,25 +125,131 @@ func (cf *ClientFramework) GetData() ([]byte, error) {
 
 // GetAddress returns the address of user.
 func (cf *ClientFramework) GetAddress() string {
-	return tpState.MakeAddress(tpState.AddressTypeUser, cf.Name, cf.signer.GetPublicKey().AsHex())
+	name, publicKey := cf.user()
+	return tpState.MakeAddress(tpState.AddressTypeUser, name, publicKey)
+}
+
+// GetRecordPrefix returns the address prefix of data and keys of user.
+func (cf *ClientFramework) GetRecordPrefix() string {
+	name, publicKey := cf.user()
+	return tpState.MakeRecordPrefix(name, publicKey)
 }
 
 // GetPublicKey returns the public key of user.
+// While the signer acts on behalf of the patient, it is the public key of the patient.
 func (cf *ClientFramework) GetPublicKey() string {
-	return cf.signer.GetPublicKey().AsHex()
+	_, publicKey := cf.user()
+	return publicKey
+}
+
+// user returns the name and the public key of user.
+func (cf *ClientFramework) user() (string, string) {
+	cf.identity.RLock()
+	defer cf.identity.RUnlock()
+	if cf.onBehalf != "" {
+		return cf.Name, cf.onBehalf
+	}
+	return cf.Name, cf.keys.PublicKey()
+}
+
+// GetSignerName returns the name of the signer, which differs from the user while it acts on behalf of the patient.
+func (cf *ClientFramework) GetSignerName() string {
+	cf.identity.RLock()
+	defer cf.identity.RUnlock()
+	if cf.onBehalf != "" {
+		return cf.self
+	}
+	return cf.Name
+}
+
+// GetSignerPublicKey returns the public key of the signer, whose private key decrypts data keys.
+func (cf *ClientFramework) GetSignerPublicKey() string {
+	return cf.keys.PublicKey()
+}
+
+// ActAs makes the client act on behalf of the patient, who delegated to the signer.
+// Transactions change the state of the patient, and they are still signed by the signer.
+// The events notified to the patient are subscribed by their own connection until the signer stops acting.
+func (cf *ClientFramework) ActAs(name, publicKey string) error {
+	cf.StopActing()
+	if publicKey == cf.GetSignerPublicKey() {
+		return nil
+	}
+	zmqConn, err := newZmqConnection()
+	if err != nil {
+		return err
+	}
+	corrID, err := subscribeEvents(zmqConn, notificationSubscriptions(name))
+	if err != nil {
+		zmqConn.Close()
+		return err
+	}
+	stop := make(chan struct{})
+	go cf.watchEvents(zmqConn, corrID, stop)
+	cf.identity.Lock()
+	defer cf.identity.Unlock()
+	cf.self = cf.Name
+	cf.Name = name
+	cf.onBehalf = publicKey
+	cf.stop = stop
+	return nil
+}
+
+// StopActing makes the client act as the signer again.
+func (cf *ClientFramework) StopActing() {
+	cf.identity.Lock()
+	defer cf.identity.Unlock()
+	if cf.onBehalf == "" {
+		return
+	}
+	close(cf.stop)
+	cf.Name = cf.self
+	cf.onBehalf = ""
+	cf.stop = nil
+}
+
+// IsActing reports whether the client acts on behalf of the patient.
+func (cf *ClientFramework) IsActing() bool {
+	cf.identity.RLock()
+	defer cf.identity.RUnlock()
+	return cf.onBehalf != ""
 }
 
 // Whoami display the information of user.
 func (cf *ClientFramework) Whoami() {
-	fmt.Println("User name: " + cf.Name)
-	fmt.Println("Public key: " + cf.signer.GetPublicKey().AsHex())
+	name, _ := cf.user()
+	if cf.IsActing() {
+		fmt.Println("Signer name: " + cf.GetSignerName())
+		fmt.Println("Signer public key: " + cf.GetSignerPublicKey())
+		fmt.Println("Acting on behalf of: " + name)
+	} else {
+		fmt.Println("User name: " + name)
+	}
+	fmt.Println("Public key: " + cf.GetPublicKey())
 	fmt.Println("Sawtooth address: " + cf.GetAddress())
 }
 
 // DecryptDataKey returns the key decrypted by user's private key.
 // If the error is not nil, it will return.
+// The key forwarded to the user by proxy re-encryption is decrypted too.
 func (cf *ClientFramework) DecryptDataKey(key string) ([]byte, error) {
-	return tpCrypto.Decryption(string(cf.PrivKeyHex), key)
+	if tpCrypto.IsProxyCiphertext(key) {
+		// the key encrypted by ECIES may start with the magic by chance
+		if out, err := cf.keys.ProxyDecrypt(key); err == nil {
+			return out, nil
+		}
+	}
+	return cf.keys.Decrypt(key)
+}
+
+// GetProxyPublicKey returns the proxy public key of the signer, for which the forward keys of data are encrypted.
+func (cf *ClientFramework) GetProxyPublicKey() string {
+	return cf.keys.ProxyPublicKey()
+}
+
+// ReEncryptionKey returns the proxy re-encryption key from user's proxy key to the public key.
+func (cf *ClientFramework) ReEncryptionKey(publicKeyTo string) ([]byte, error) {
+	return cf.keys.ReEncryptionKey(publicKeyTo)
 }
 
 // DecryptDataKey returns the key encrypted by user's public key.
@@ -152,16 +273,20 @@ func (cf *ClientFramework) getStatus(batchID string, wait int64) (map[string]int
 // SendTransaction send transactions by the batch.
 func (cf *ClientFramework) SendTransaction(storagePayloads []tpPayload.StoragePayload, inputs, outputs []string) (map[string]interface{}, error) {
 	var transactions []*transaction_pb2.Transaction
+	cf.identity.RLock()
+	onBehalf := cf.onBehalf
+	cf.identity.RUnlock()
 
 	for _, storagePayload := range storagePayloads {
+		storagePayload.OnBehalf = onBehalf
 		// Construct TransactionHeader
 		rawTransactionHeader := transaction_pb2.TransactionHeader{
-			SignerPublicKey:  cf.signer.GetPublicKey().AsHex(),
+			SignerPublicKey:  cf.keys.PublicKey(),
 			FamilyName:       FamilyName,
 			FamilyVersion:    FamilyVersion,
 			Dependencies:     []string{},
 			Nonce:            strconv.Itoa(rand.Int()),
-			BatcherPublicKey: cf.signer.GetPublicKey().AsHex(),
+			BatcherPublicKey: cf.keys.PublicKey(),
 			Inputs:           inputs,
 			Outputs:          outputs,
 			PayloadSha512:    tpCrypto.SHA512HexFromBytes(storagePayload.ToBytes()),
@@ -172,12 +297,15 @@ func (cf *ClientFramework) SendTransaction(storagePayloads []tpPayload.StoragePa
 		}
 
 		// Signature of TransactionHeader
-		transactionHeaderSignature := hex.EncodeToString(cf.signer.Sign(transactionHeader))
+		transactionHeaderSignature, err := cf.keys.Sign(transactionHeader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign transaction header: %v", err)
+		}
 
 		// Construct Transaction
 		transaction := &transaction_pb2.Transaction{
 			Header:          transactionHeader,
-			HeaderSignature: transactionHeaderSignature,
+			HeaderSignature: hex.EncodeToString(transactionHeaderSignature),
 			Payload:         storagePayload.ToBytes(),
 		}
 
@@ -199,6 +327,10 @@ func (cf *ClientFramework) SendTransaction(storagePayloads []tpPayload.StoragePa
 
 // SendTransactionAndWaiting send transaction by the batch and waiting for the batches committed.
 func (cf *ClientFramework) SendTransactionAndWaiting(seaStoragePayloads []tpPayload.StoragePayload, inputs, outputs []string) error {
+	// the state changes are watched for the signer, so the batch status is waited for the patient
+	if cf.IsActing() {
+		return cf.SendTransactionAndWaitingForBatch(seaStoragePayloads, inputs, outputs)
+	}
 	response, err := cf.SendTransaction(seaStoragePayloads, inputs, outputs)
 	if err != nil {
 		return err
@@ -209,6 +341,40 @@ func (cf *ClientFramework) SendTransactionAndWaiting(seaStoragePayloads []tpPayl
 	return cf.WaitingForCommitted()
 }
 
+// SendTransactionAndWaitingForBatch send transaction by the batch and waiting for the batch status.
+// It is used when the transactions don't change the state of the user.
+func (cf *ClientFramework) SendTransactionAndWaitingForBatch(storagePayloads []tpPayload.StoragePayload, inputs, outputs []string) error {
+	response, err := cf.SendTransaction(storagePayloads, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	link, ok := response["link"].(string)
+	if !ok {
+		return errors.New("failed to get batch status link")
+	}
+	statusURL, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	entry, err := cf.getStatus(statusURL.Query().Get("id"), int64(DefaultWait.Seconds()))
+	if err != nil {
+		return err
+	}
+	switch entry["status"] {
+	case "COMMITTED":
+		return nil
+	case "INVALID":
+		if txns, ok := entry["invalid_transactions"].([]interface{}); ok && len(txns) > 0 {
+			if txn, ok := txns[0].(map[string]interface{}); ok {
+				return fmt.Errorf("invalid transaction: %v", txn["message"])
+			}
+		}
+		return errors.New("invalid transaction")
+	default:
+		return errors.New("waiting for committed timeout")
+	}
+}
+
 // create the list of batches.
 func (cf *ClientFramework) createBatchList(transactions []*transaction_pb2.Transaction) (batch_pb2.BatchList, error) {
 	// Get list of TransactionHeader signatures
@@ -219,7 +385,7 @@ func (cf *ClientFramework) createBatchList(transactions []*transaction_pb2.Trans
 
 	// Construct BatchHeader
 	rawBatchHeader := batch_pb2.BatchHeader{
-		SignerPublicKey: cf.signer.GetPublicKey().AsHex(),
+		SignerPublicKey: cf.keys.PublicKey(),
 		TransactionIds:  transactionSignatures,
 	}
 	batchHeader, err := proto.Marshal(&rawBatchHeader)
@@ -228,13 +394,16 @@ func (cf *ClientFramework) createBatchList(transactions []*transaction_pb2.Trans
 	}
 
 	// Signature of BatchHeader
-	batchHeaderSignature := hex.EncodeToString(cf.signer.Sign(batchHeader))
+	batchHeaderSignature, err := cf.keys.Sign(batchHeader)
+	if err != nil {
+		return batch_pb2.BatchList{}, fmt.Errorf("unable to sign batch header: %v", err)
+	}
 
 	// Construct Batch
 	batch := batch_pb2.Batch{
 		Header:          batchHeader,
 		Transactions:    transactions,
-		HeaderSignature: batchHeaderSignature,
+		HeaderSignature: hex.EncodeToString(batchHeaderSignature),
 	}
 
 	// Construct BatchList
@@ -256,26 +425,33 @@ func (cf *ClientFramework) WaitingForCommitted() error {
 	}
 }
 
-// WatchingForState waits for change of the state in the blockchain
+// WatchingForState waits for change of the state in the blockchain.
+// Both the user and its data and keys are watched.
+// The events notified to the user are subscribed together.
 func (cf *ClientFramework) WatchingForState() error {
-	subscription := &events_pb2.EventSubscription{
+	name, _ := cf.user()
+	watched := []string{cf.GetAddress(), cf.GetRecordPrefix()}
+	subscriptions := []*events_pb2.EventSubscription{{
 		EventType: "sawtooth/state-delta",
 		Filters: []*events_pb2.EventFilter{{
 			Key:         "address",
-			MatchString: cf.GetAddress(),
-			FilterType:  events_pb2.EventFilter_SIMPLE_ANY,
+			MatchString: fmt.Sprintf("^(%s|%s)", watched[0], watched[1]),
+			FilterType:  events_pb2.EventFilter_REGEX_ANY,
 		}},
-	}
-	corrID, err := cf.subscribeEvents([]*events_pb2.EventSubscription{subscription})
+	}, {
+		EventType: tpEvent.UserCreated,
+	}}
+	corrID, err := subscribeEvents(cf.zmqConn, append(subscriptions, notificationSubscriptions(name)...))
 	if err != nil {
 		return err
 	}
 	cf.corrID = corrID
+	cf.watched = watched
 	return nil
 }
 
 // Subscribe to any state change events in the blockchain
-func (cf *ClientFramework) subscribeEvents(subscriptions []*events_pb2.EventSubscription) (string, error) {
+func subscribeEvents(zmqConn *messaging.ZmqConnection, subscriptions []*events_pb2.EventSubscription) (string, error) {
 	// Construct the subscribeRequest
 	subscribeRequest := &client_event_pb2.ClientEventsSubscribeRequest{
 		Subscriptions: subscriptions,
@@ -284,12 +460,12 @@ func (cf *ClientFramework) subscribeEvents(subscriptions []*events_pb2.EventSubs
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal subscription subscribeRequest: %v", err)
 	}
-	corrID, err := cf.zmqConn.SendNewMsg(validator_pb2.Message_CLIENT_EVENTS_SUBSCRIBE_REQUEST, requestBytes)
+	corrID, err := zmqConn.SendNewMsg(validator_pb2.Message_CLIENT_EVENTS_SUBSCRIBE_REQUEST, requestBytes)
 	if err != nil {
 		return "", fmt.Errorf("failed to send subscription message: %v", err)
 	}
 	// Received subscription response
-	_, response, err := cf.zmqConn.RecvMsgWithId(corrID)
+	_, response, err := zmqConn.RecvMsgWithId(corrID)
 	if err != nil {
 		return "", fmt.Errorf("failed to received subscribe event response: %v", err)
 	}
@@ -305,19 +481,19 @@ func (cf *ClientFramework) subscribeEvents(subscriptions []*events_pb2.EventSubs
 }
 
 // Unsubscribe from any state change events in the blockchain
-func (cf *ClientFramework) unsubscribeEvents(corrID string) error {
+func unsubscribeEvents(zmqConn *messaging.ZmqConnection, corrID string) error {
 	// Construct the UnsubscribeRequest
 	unsubscribeRequest := &client_event_pb2.ClientEventsUnsubscribeRequest{}
 	unsubscribeRequestBytes, err := proto.Marshal(unsubscribeRequest)
 	if err != nil {
 		return fmt.Errorf("failed to marshal unsubscribe event: %v", err)
 	}
-	id, err := cf.zmqConn.SendNewMsg(validator_pb2.Message_CLIENT_EVENTS_UNSUBSCRIBE_REQUEST, unsubscribeRequestBytes)
+	id, err := zmqConn.SendNewMsg(validator_pb2.Message_CLIENT_EVENTS_UNSUBSCRIBE_REQUEST, unsubscribeRequestBytes)
 	if err != nil {
 		return fmt.Errorf("faield to send unsubscribe event message: %v", err)
 	}
 	// Received the unsubscription response
-	_, response, err := cf.zmqConn.RecvMsgWithId(id)
+	_, response, err := zmqConn.RecvMsgWithId(id)
 	if err != nil {
 		return fmt.Errorf("failed to received unsubcribe event response: %v", err)
 	}
@@ -352,8 +528,12 @@ func (cf *ClientFramework) subscribeHandler() {
 			continue
 		}
 		for _, event := range eventList.Events {
+			if event.EventType != "sawtooth/state-delta" {
+				cf.handleEvent(event)
+				continue
+			}
 			for _, attr := range event.Attributes {
-				if attr.Key == "address" && attr.Value == cf.GetAddress() {
+				if attr.Key == "address" && (attr.Value == cf.watched[0] || strings.HasPrefix(attr.Value, cf.watched[1])) {
 					if cf.waiting {
 						cf.signal <- true
 					}
@@ -365,7 +545,7 @@ func (cf *ClientFramework) subscribeHandler() {
 					}
 
 					for _, stateChange := range stateChangeList.StateChanges {
-						if stateChange.Address == cf.GetAddress() {
+						if stateChange.Address == cf.watched[0] {
 							cf.State <- stateChange.Value
 							break
 						}
@@ -377,19 +557,62 @@ func (cf *ClientFramework) subscribeHandler() {
 	}
 }
 
+// watchEvents handles the events received by the connection until it's stopped.
+// The connection is used only by it, so it's unsubscribed and closed when stopped.
+func (cf *ClientFramework) watchEvents(zmqConn *messaging.ZmqConnection, corrID string, stop chan struct{}) {
+	defer zmqConn.Close()
+	poller := zmq4.NewPoller()
+	poller.Add(zmqConn.Socket(), zmq4.POLLIN)
+	for {
+		select {
+		case <-stop:
+			err := unsubscribeEvents(zmqConn, corrID)
+			if err != nil {
+				Logger.WithFields(logrus.Fields{
+					"correlationID": corrID,
+				}).Errorf("failed to unsubscribe events: %v", err)
+			}
+			return
+		default:
+		}
+		polled, err := poller.Poll(EventPollInterval)
+		if err != nil {
+			Logger.Errorf("zmq failed to poll message: %v", err)
+			continue
+		}
+		if len(polled) == 0 {
+			continue
+		}
+		_, message, err := zmqConn.RecvMsg()
+		if err != nil {
+			Logger.Errorf("zmq failed to received message: %v", err)
+			continue
+		}
+		if message.MessageType != validator_pb2.Message_CLIENT_EVENTS {
+			continue
+		}
+		eventList := &events_pb2.EventList{}
+		err = proto.Unmarshal(message.Content, eventList)
+		if err != nil {
+			Logger.WithFields(logrus.Fields{
+				"message": message.String(),
+			}).Error("failed unmarshal message")
+			continue
+		}
+		for _, event := range eventList.Events {
+			cf.handleEvent(event)
+		}
+	}
+}
+
 // Zmq connections for event subscription
-func (cf *ClientFramework) generateZmqConnection() error {
+func newZmqConnection() (*messaging.ZmqConnection, error) {
 	// Setup a connection to the validator
 	ctx, err := zmq4.NewContext()
 	if err != nil {
-		return err
-	}
-	zmqConn, err := messaging.NewConnection(ctx, zmq4.DEALER, ValidatorURL, false)
-	if err != nil {
-		return err
+		return nil, err
 	}
-	cf.zmqConn = zmqConn
-	return nil
+	return messaging.NewConnection(ctx, zmq4.DEALER, ValidatorURL, false)
 }
 
 // GenerateKey generate key pair (Secp256k1) and store them in the client path.
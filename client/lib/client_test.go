@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/stretchr/testify/assert"
+	tpState "healthcare-system-sawtooth/tp/state"
+)
+
+func TestStopActing(t *testing.T) {
+	keys, err := NewLocalKeyProvider(signing.NewSecp256k1Context().NewRandomPrivateKey().AsHex())
+	assert.NoError(t, err)
+	patient, err := NewLocalKeyProvider(signing.NewSecp256k1Context().NewRandomPrivateKey().AsHex())
+	assert.NoError(t, err)
+	patientKey := patient.PublicKey()
+	stop := make(chan struct{})
+	cf := &ClientFramework{Name: "patient", keys: keys, self: "delegate", onBehalf: patientKey, stop: stop}
+	assert.True(t, cf.IsActing())
+	assert.Equal(t, tpState.MakeAddress(tpState.AddressTypeUser, "patient", patientKey), cf.GetAddress())
+	assert.Equal(t, "delegate", cf.GetSignerName())
+
+	// the identity is read by the event handlers while the signer stops acting
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cf.GetAddress()
+			cf.IsActing()
+		}
+	}()
+	cf.StopActing()
+	<-done
+	_, ok := <-stop
+	assert.False(t, ok, "watching the events of the patient isn't stopped")
+	assert.False(t, cf.IsActing())
+	assert.Equal(t, tpState.MakeAddress(tpState.AddressTypeUser, "delegate", keys.PublicKey()), cf.GetAddress())
+	assert.Equal(t, "delegate", cf.GetSignerName())
+	// stopping again is ignored
+	cf.StopActing()
+}
@@ -25,6 +25,8 @@ const (
 	FamilyVersion string = "1.0"
 	// DefaultWait is the waiting time for batch commits.
 	DefaultWait = time.Minute
+	// EventPollInterval is the interval to check whether the events of the patient are still watched.
+	EventPollInterval = time.Second
 	// DefaultQueryLimit is the limit of state queries.
 	DefaultQueryLimit uint = 20
 	// DefaultConfigFilename is the config filename.
@@ -53,6 +55,24 @@ const (
 	AESKeySize int = 256
 	// IvSize is the AES-CTR iv's size.
 	IvSize = aes.BlockSize
+
+	// Ciphertext envelope
+
+	// EnvelopeVersion is the version of the ciphertext envelope.
+	EnvelopeVersion byte = 1
+	// AlgorithmAESGCM is the AES-256-GCM algorithm of the ciphertext envelope.
+	AlgorithmAESGCM byte = 1
+	// NonceSize is the AES-GCM nonce's size.
+	NonceSize = 12
+	// TagSize is the AES-GCM tag's size.
+	TagSize = 16
+
+	// Chunked stream
+
+	// StreamVersion is the version of the chunked stream.
+	StreamVersion byte = 1
+	// ChunkSize is the size of the plaintext of each chunk of the stream.
+	ChunkSize = 1024 * 1024
 )
 
 var (
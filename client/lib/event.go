@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/events_pb2"
+	tpEvent "healthcare-system-sawtooth/tp/event"
+)
+
+// EventHandler handles the event emitted by the transaction processor with its attributes.
+type EventHandler func(eventType string, attributes map[string]string)
+
+// Subscribe registers the handler called when the event of the type is committed.
+// The events are notified only when the user is their recipient, except the user created event.
+func (cf *ClientFramework) Subscribe(eventType string, handler EventHandler) {
+	cf.mutex.Lock()
+	defer cf.mutex.Unlock()
+	cf.handlers[eventType] = append(cf.handlers[eventType], handler)
+}
+
+// notificationSubscriptions returns the subscriptions to the events notified to the recipient.
+func notificationSubscriptions(recipient string) []*events_pb2.EventSubscription {
+	var subscriptions []*events_pb2.EventSubscription
+	for _, eventType := range tpEvent.NotificationTypes {
+		subscriptions = append(subscriptions, &events_pb2.EventSubscription{
+			EventType: eventType,
+			Filters: []*events_pb2.EventFilter{{
+				Key:         tpEvent.AttrRecipient,
+				MatchString: recipient,
+				FilterType:  events_pb2.EventFilter_SIMPLE_ANY,
+			}},
+		})
+	}
+	return subscriptions
+}
+
+// handleEvent calls the handlers of the event.
+func (cf *ClientFramework) handleEvent(event *events_pb2.Event) {
+	attributes := make(map[string]string)
+	for _, attr := range event.Attributes {
+		attributes[attr.Key] = attr.Value
+	}
+	cf.mutex.Lock()
+	handlers := cf.handlers[event.EventType]
+	cf.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(event.EventType, attributes)
+	}
+}
@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	tpCrypto "healthcare-system-sawtooth/crypto"
+)
+
+// KeyProvider holds the private key of the identity. It signs the transactions and decrypts the keys of data
+// encrypted for the identity, so the client never holds the private key, which may live in another process.
+type KeyProvider interface {
+	// PublicKey returns the public key, hex encoded.
+	PublicKey() string
+	// Sign signs the message by secp256k1 the same way as the signer of Sawtooth.
+	Sign(message []byte) ([]byte, error)
+	// Decrypt decrypts the data encrypted for the public key by ECIES, hex encoded.
+	Decrypt(data string) ([]byte, error)
+	// ProxyPublicKey returns the proxy public key, hex encoded, for which the data is encrypted by proxy re-encryption.
+	ProxyPublicKey() string
+	// ProxyDecrypt decrypts the data encrypted for the proxy public key, or re-encrypted for the public key,
+	// by proxy re-encryption, hex encoded.
+	ProxyDecrypt(data string) ([]byte, error)
+	// ReEncryptionKey returns the proxy re-encryption key from the proxy key to the public key.
+	ReEncryptionKey(publicKeyTo string) ([]byte, error)
+}
+
+// localKeyProvider holds the private key and the proxy key derived from it in memory.
+type localKeyProvider struct {
+	privateKeyHex  string
+	proxyKeyHex    string
+	proxyPublicKey string
+	signer         *signing.Signer
+}
+
+// NewLocalKeyProvider is the construct for the KeyProvider holding the private key, hex encoded, in memory.
+func NewLocalKeyProvider(privateKeyHex string) (KeyProvider, error) {
+	privateKey, _, err := parsePrivateKey(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	proxyKeyHex, proxyPublicKey, err := tpCrypto.ProxyKeyPair(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	cryptoFactory := signing.NewCryptoFactory(signing.NewSecp256k1Context())
+	return &localKeyProvider{
+		privateKeyHex:  privateKeyHex,
+		proxyKeyHex:    proxyKeyHex,
+		proxyPublicKey: proxyPublicKey,
+		signer:         cryptoFactory.NewSigner(signing.NewSecp256k1PrivateKey(privateKey)),
+	}, nil
+}
+
+// LoadKeyProvider returns the KeyProvider of the key file. The key file of the scheme unix://
+// is the address of the key agent, otherwise it's loaded by LoadPrivateKey, which decrypts the keystore.
+func LoadKeyProvider(keyFile string) (KeyProvider, error) {
+	if isAgentURL(keyFile) {
+		return NewRemoteKeyProvider(keyFile)
+	}
+	privateKeyHex, err := LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalKeyProvider(privateKeyHex)
+}
+
+func (p *localKeyProvider) PublicKey() string {
+	return p.signer.GetPublicKey().AsHex()
+}
+
+func (p *localKeyProvider) Sign(message []byte) ([]byte, error) {
+	return p.signer.Sign(message), nil
+}
+
+func (p *localKeyProvider) Decrypt(data string) ([]byte, error) {
+	return tpCrypto.Decryption(p.privateKeyHex, data)
+}
+
+func (p *localKeyProvider) ProxyPublicKey() string {
+	return p.proxyPublicKey
+}
+
+// ProxyDecrypt decrypts the data encrypted for the proxy key, or re-encrypted for the private key.
+// The data encrypted for the public key before the proxy key was introduced is decrypted by the private key too.
+func (p *localKeyProvider) ProxyDecrypt(data string) ([]byte, error) {
+	out, err := tpCrypto.ProxyDecryption(p.proxyKeyHex, data)
+	if err == nil {
+		return out, nil
+	}
+	return tpCrypto.ProxyDecryption(p.privateKeyHex, data)
+}
+
+func (p *localKeyProvider) ReEncryptionKey(publicKeyTo string) ([]byte, error) {
+	return tpCrypto.ReEncryptionKey(p.proxyKeyHex, publicKeyTo)
+}
@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Parameters of the keystore.
+const (
+	KeystoreVersion = 1
+	keystoreKDF     = "scrypt"
+	keystoreCipher  = "aes-256-gcm"
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+	scryptMaxP      = 16
+	scryptMaxMemory = 1 << 30
+	scryptSaltSize  = 32
+)
+
+// The errors of the keystore.
+var (
+	ErrInvalidKeystore = errors.New("invalid keystore")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrEmptyPassphrase = errors.New("passphrase can't be empty")
+	ErrInvalidKey      = errors.New("invalid private key")
+)
+
+// PassphraseFunc reads the passphrase of the keystore. The new passphrase should be confirmed before it is returned.
+type PassphraseFunc func(isNew bool) ([]byte, error)
+
+// Passphrase reads the passphrase, when the keystore is loaded or the legacy key file is upgraded.
+// The new passphrase is read only when the legacy key file is upgraded, so the caller can tell the user.
+// If it is nil, the keystore can't be loaded, and the legacy key file is loaded as it is.
+var Passphrase PassphraseFunc
+
+// keystore is the private key encrypted by AES-256-GCM using the key derived from the passphrase by scrypt.
+// The public key is the associated data, so it can't be replaced without the passphrase.
+type keystore struct {
+	Version    int    `json:"version"`
+	PublicKey  string `json:"public_key"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// EncryptKey encrypts the private key, hex encoded, into the keystore by the passphrase.
+func EncryptKey(privateKeyHex string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+	privateKey, publicKey, err := parsePrivateKey(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	ks := &keystore{
+		Version:   KeystoreVersion,
+		PublicKey: publicKey,
+		KDF:       keystoreKDF,
+		N:         scryptN,
+		R:         scryptR,
+		P:         scryptP,
+		Cipher:    keystoreCipher,
+	}
+	salt := make([]byte, scryptSaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := ks.newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	ks.Salt = hex.EncodeToString(salt)
+	ks.Nonce = hex.EncodeToString(nonce)
+	ks.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, privateKey, []byte(publicKey)))
+	return json.MarshalIndent(ks, "", "\t")
+}
+
+// DecryptKey decrypts the private key from the keystore by the passphrase, and returns it hex encoded.
+func DecryptKey(in, passphrase []byte) (string, error) {
+	ks := &keystore{}
+	err := json.Unmarshal(in, ks)
+	if err != nil {
+		return "", ErrInvalidKeystore
+	}
+	if ks.Version != KeystoreVersion || ks.KDF != keystoreKDF || ks.Cipher != keystoreCipher {
+		return "", fmt.Errorf("%v: unsupported version %d, kdf %s or cipher %s", ErrInvalidKeystore, ks.Version, ks.KDF, ks.Cipher)
+	}
+	// the parameters are limited, so the keystore can't make scrypt take all the memory
+	if ks.N <= 1 || ks.N&(ks.N-1) != 0 || ks.R <= 0 || ks.R > scryptMaxMemory/128 || ks.N > scryptMaxMemory/128/ks.R ||
+		ks.P <= 0 || ks.P > scryptMaxP {
+		return "", fmt.Errorf("%v: invalid scrypt parameters", ErrInvalidKeystore)
+	}
+	salt, err := hex.DecodeString(ks.Salt)
+	if err != nil {
+		return "", ErrInvalidKeystore
+	}
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil {
+		return "", ErrInvalidKeystore
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return "", ErrInvalidKeystore
+	}
+	aead, err := ks.newGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", ErrInvalidKeystore
+	}
+	privateKey, err := aead.Open(nil, nonce, ciphertext, []byte(ks.PublicKey))
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return hex.EncodeToString(privateKey), nil
+}
+
+// IsKeystore reports whether the content of the key file is the keystore, rather than the legacy private key of plain hex.
+func IsKeystore(in []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(in), []byte("{"))
+}
+
+// LoadPrivateKey reads the private key from the key file, and returns it hex encoded.
+// The keystore is decrypted by the passphrase read by Passphrase. The legacy key file of plain hex is upgraded
+// to the keystore encrypted by the new passphrase, unless Passphrase is nil.
+func LoadPrivateKey(keyFile string) (string, error) {
+	in, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read private key: %v", err)
+	}
+	if IsKeystore(in) {
+		if Passphrase == nil {
+			return "", errors.New("passphrase of the keystore is required")
+		}
+		passphrase, err := Passphrase(false)
+		if err != nil {
+			return "", err
+		}
+		return DecryptKey(in, passphrase)
+	}
+	privateKeyHex := strings.TrimSpace(string(in))
+	_, _, err = parsePrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	if Passphrase == nil {
+		return privateKeyHex, nil
+	}
+	passphrase, err := Passphrase(true)
+	if err != nil {
+		return "", err
+	}
+	err = writeKeystore(keyFile, privateKeyHex, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return privateKeyHex, nil
+}
+
+// GenerateKeystore generates key pair (Secp256k1), and stores the private key encrypted by the passphrase
+// and the public key in the client path.
+func GenerateKeystore(keyName, keyPath string, passphrase []byte) error {
+	cont := signing.NewSecp256k1Context()
+	return ImportKey(path.Join(keyPath, keyName+".priv"), cont.NewRandomPrivateKey().AsHex(), passphrase)
+}
+
+// ImportKey stores the private key, hex encoded, into the new keystore encrypted by the passphrase,
+// and the public key next to it.
+func ImportKey(keyFile, privateKeyHex string, passphrase []byte) error {
+	_, publicKey, err := parsePrivateKey(strings.TrimSpace(privateKeyHex))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		return fmt.Errorf("key file %s already exists", keyFile)
+	}
+	err = os.MkdirAll(path.Dir(keyFile), 0755)
+	if err != nil {
+		return err
+	}
+	err = writeKeystore(keyFile, strings.TrimSpace(privateKeyHex), passphrase)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(strings.TrimSuffix(keyFile, ".priv")+".pub", []byte(publicKey), 0600)
+}
+
+// ExportKey decrypts the private key from the keystore by the passphrase, and returns it hex encoded.
+// The legacy key file is exported as it is.
+func ExportKey(keyFile string, passphrase []byte) (string, error) {
+	in, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read private key: %v", err)
+	}
+	if !IsKeystore(in) {
+		return strings.TrimSpace(string(in)), nil
+	}
+	return DecryptKey(in, passphrase)
+}
+
+// writeKeystore replaces the key file by the keystore, so the key file isn't lost if it fails to be written.
+func writeKeystore(keyFile, privateKeyHex string, passphrase []byte) error {
+	out, err := EncryptKey(privateKeyHex, passphrase)
+	if err != nil {
+		return err
+	}
+	tmp := keyFile + ".tmp"
+	err = ioutil.WriteFile(tmp, out, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, keyFile)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (ks *keystore) newGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, ks.N, ks.R, ks.P, AESKeySize/8)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// parsePrivateKey returns the private key and the public key, hex encoded.
+func parsePrivateKey(privateKeyHex string) ([]byte, string, error) {
+	privateKey, err := hex.DecodeString(privateKeyHex)
+	if err != nil || len(privateKey) != 32 {
+		return nil, "", ErrInvalidKey
+	}
+	cont := signing.NewSecp256k1Context()
+	return privateKey, cont.GetPublicKey(signing.NewSecp256k1PrivateKey(privateKey)).AsHex(), nil
+}
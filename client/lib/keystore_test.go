@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystore(t *testing.T) {
+	privateKeyHex := signing.NewSecp256k1Context().NewRandomPrivateKey().AsHex()
+	out, err := EncryptKey(privateKeyHex, []byte("secret"))
+	assert.NoError(t, err)
+	assert.True(t, IsKeystore(out))
+	assert.NotContains(t, string(out), privateKeyHex)
+
+	decrypted, err := DecryptKey(out, []byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, privateKeyHex, decrypted)
+
+	_, err = DecryptKey(out, []byte("wrong"))
+	assert.Equal(t, ErrWrongPassphrase, err)
+
+	_, err = EncryptKey(privateKeyHex, nil)
+	assert.Equal(t, ErrEmptyPassphrase, err)
+
+	// the public key is the associated data
+	other := signing.NewSecp256k1Context().NewRandomPrivateKey()
+	_, publicKey, _ := parsePrivateKey(privateKeyHex)
+	_, otherPublicKey, _ := parsePrivateKey(other.AsHex())
+	_, err = DecryptKey([]byte(strings.Replace(string(out), publicKey, otherPublicKey, 1)), []byte("secret"))
+	assert.Equal(t, ErrWrongPassphrase, err)
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	defer func() { Passphrase = nil }()
+	keyFile := path.Join(t.TempDir(), "test.priv")
+	privateKeyHex := signing.NewSecp256k1Context().NewRandomPrivateKey().AsHex()
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte(privateKeyHex), 0600))
+
+	// the legacy key file is loaded as it is without the passphrase
+	loaded, err := LoadPrivateKey(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKeyHex, loaded)
+
+	// and upgraded to the keystore with the passphrase
+	Passphrase = func(bool) ([]byte, error) { return []byte("secret"), nil }
+	loaded, err = LoadPrivateKey(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKeyHex, loaded)
+	in, err := ioutil.ReadFile(keyFile)
+	assert.NoError(t, err)
+	assert.True(t, IsKeystore(in))
+
+	loaded, err = LoadPrivateKey(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKeyHex, loaded)
+
+	exported, err := ExportKey(keyFile, []byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, privateKeyHex, exported)
+	assert.Error(t, ImportKey(keyFile, privateKeyHex, []byte("secret")))
+}
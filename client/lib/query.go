@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,6 +13,9 @@ import (
 	tpState "healthcare-system-sawtooth/tp/state"
 )
 
+// ErrNoSuchEndpoint is returned when the endpoint, e.g. the state of the address, doesn't exist.
+var ErrNoSuchEndpoint = errors.New("no such endpoint")
+
 // GetStateData returns the data of the address in byte slice.
 func GetStateData(addr string) ([]byte, error) {
 	apiSuffix := fmt.Sprintf("%s/%s", StateAPI, addr)
@@ -22,25 +26,58 @@ func GetStateData(addr string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(resp["data"].(string))
 }
 
-// List returns the list of data that address started with the address prefix.
-func list(address, start string, limit uint) (result []interface{}, err error) {
-	apiSuffix := fmt.Sprintf("%s?address=%s", StateAPI, address)
-	if start != "" {
-		apiSuffix = fmt.Sprintf("%s&start=%s", apiSuffix, start)
-	}
-	if limit > 0 {
-		apiSuffix = fmt.Sprintf("%s&limit=%v", apiSuffix, limit)
-	}
-	response, err := sendRequestByAPISuffix(apiSuffix, nil, "")
-	if err != nil {
-		return
+// listAll returns all the data that address started with the address prefix by following the paging.next links.
+func listAll(address string) ([]interface{}, error) {
+	var result []interface{}
+	response, err := sendRequestByAPISuffix(fmt.Sprintf("%s?address=%s", StateAPI, address), nil, "")
+	for {
+		if err != nil {
+			return nil, err
+		}
+		data, _ := response["data"].([]interface{})
+		result = append(result, data...)
+		paging, _ := response["paging"].(map[string]interface{})
+		next, _ := paging["next"].(string)
+		if next == "" {
+			return result, nil
+		}
+		response, err = sendRequest(next, nil, "")
 	}
-	return response["data"].([]interface{}), nil
 }
 
 // ListUsers returns the list of data that address started with the UserNamespace.
-func ListUsers(start string, limit uint) ([]interface{}, error) {
-	return list(tpState.Namespace+tpState.UserNamespace, start, limit)
+func ListUsers() ([]interface{}, error) {
+	return listAll(tpState.Namespace + tpState.UserNamespace)
+}
+
+// ListRequests returns the list of access requests received by the public key.
+func ListRequests(publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeRequestPrefix(publicKey))
+}
+
+// ListUserData returns the list of data stored by the user.
+func ListUserData(name, publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeDataPrefix(name, publicKey))
+}
+
+// ListUserKeys returns the list of keys stored by the user.
+func ListUserKeys(name, publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeKeyPrefix(name, publicKey))
+}
+
+// ListAuditLog returns the list of receipts in the audit log of the user.
+func ListAuditLog(name, publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeAuditPrefix(name, publicKey))
+}
+
+// ListDelegations returns the list of delegations of the patient.
+func ListDelegations(name, publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeDelegationPrefix(name, publicKey))
+}
+
+// ListReKeys returns the list of re-encryption keys issued by the patient.
+func ListReKeys(name, publicKey string) ([]interface{}, error) {
+	return listAll(tpState.MakeReKeyPrefix(name, publicKey))
 }
 
 // sendRequest send the request to the Hyperledger Sawtooth rest api by giving url.
@@ -57,7 +94,7 @@ func sendRequest(url string, data []byte, contentType string) (map[string]interf
 		return nil, fmt.Errorf("failed to connect to REST API: %v", err)
 	}
 	if response.StatusCode == 404 {
-		return nil, fmt.Errorf("no such endpoint: %s", url)
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchEndpoint, url)
 	} else if response.StatusCode >= 400 {
 		return nil, fmt.Errorf("error %d: %s", response.StatusCode, response.Status)
 	}
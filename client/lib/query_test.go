@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tpState "healthcare-system-sawtooth/tp/state"
+)
+
+func TestListAllPages(t *testing.T) {
+	// the REST API returns the state in pages of two entries, linked by paging.next
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/"+StateAPI, r.URL.Path)
+		assert.Equal(t, tpState.MakeRequestPrefix("02"), r.URL.Query().Get("address"))
+		page := 0
+		fmt.Sscan(r.URL.Query().Get("start"), &page)
+		paging := map[string]interface{}{"start": r.URL.Query().Get("start")}
+		if page < 2 {
+			paging["next_position"] = fmt.Sprint(page + 1)
+			paging["next"] = fmt.Sprintf("%s/%s?address=%s&start=%d", server.URL, StateAPI, r.URL.Query().Get("address"), page+1)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":   []string{fmt.Sprint(page, "a"), fmt.Sprint(page, "b")},
+			"paging": paging,
+		})
+	}))
+	defer server.Close()
+	tpURL := TPURL
+	TPURL = server.URL
+	defer func() { TPURL = tpURL }()
+
+	requests, err := ListRequests("02")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0a", "0b", "1a", "1b", "2a", "2b"}, requests)
+}
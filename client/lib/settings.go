@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	tpState "healthcare-system-sawtooth/tp/state"
+)
+
+// SettingsRefresh is the time after which the discovered settings are read again.
+const SettingsRefresh = time.Minute
+
+// Settings of the network stored by the settings transaction family.
+// The defaults of the transaction processor are used for the settings which aren't set.
+type Settings struct {
+	EmergencyTTL time.Duration // Time to live of the access to the data opened to the third party, 0 is unlimited
+	AccessTypes  []uint        // Access types allowed for the data and the requests
+	MaxRecords   int64         // Maximum number of data stored by the user, 0 is unlimited
+	MaxDataSize  int64         // Maximum size of the data in bytes, 0 is unlimited
+	MaxUserSize  int64         // Maximum total size of the data stored by the user in bytes, 0 is unlimited
+}
+
+var (
+	settings     *Settings
+	settingsTime time.Time
+	settingsLock sync.Mutex
+)
+
+// GetSetting returns the value of the setting by key.
+// If the setting doesn't exist, empty string will be returned.
+func GetSetting(key string) (string, error) {
+	data, err := GetStateData(tpState.MakeSettingAddress(key))
+	if errors.Is(err, ErrNoSuchEndpoint) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return tpState.DecodeSetting(data, key)
+}
+
+// GetSettings returns the settings of the network.
+// The settings are discovered from the state, and cached for SettingsRefresh.
+func GetSettings() (*Settings, error) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	if settings != nil && time.Since(settingsTime) < SettingsRefresh {
+		return settings, nil
+	}
+	s, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings, settingsTime = s, time.Now()
+	return settings, nil
+}
+
+// LoadSettings reads the settings of the network from the state.
+func LoadSettings() (*Settings, error) {
+	values := make(map[string]string)
+	for _, key := range []string{
+		tpState.SettingEmergencyTTL,
+		tpState.SettingAccessTypes,
+		tpState.SettingMaxRecords,
+		tpState.SettingMaxDataSize,
+		tpState.SettingMaxUserSize,
+	} {
+		value, err := GetSetting(key)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	s := &Settings{}
+	var err error
+	s.EmergencyTTL, err = tpState.ParseDurationSetting(values[tpState.SettingEmergencyTTL], tpState.DefaultEmergencyTTL)
+	if err != nil {
+		return nil, err
+	}
+	s.AccessTypes, err = tpState.ParseAccessTypesSetting(values[tpState.SettingAccessTypes])
+	if err != nil {
+		return nil, err
+	}
+	s.MaxRecords, err = tpState.ParseIntSetting(values[tpState.SettingMaxRecords], tpState.DefaultMaxRecords)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxDataSize, err = tpState.ParseIntSetting(values[tpState.SettingMaxDataSize], tpState.DefaultMaxDataSize)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxUserSize, err = tpState.ParseIntSetting(values[tpState.SettingMaxUserSize], tpState.DefaultMaxUserSize)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AllowsAccessType reports whether the access type is allowed by the network.
+func (s *Settings) AllowsAccessType(accessType uint) bool {
+	return tpState.AllowsAccessType(s.AccessTypes, accessType)
+}
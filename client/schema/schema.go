@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+// Schemas of the categories of clinical records.
+// A subset of JSON schema is supported: the object of string, number, integer and boolean
+// properties with enum, the date format, required properties and additionalProperties.
+//
+//go:embed schemas/*.json
+var files embed.FS
+
+type property struct {
+	Type   string        `json:"type"`
+	Enum   []interface{} `json:"enum"`
+	Format string        `json:"format"`
+}
+
+// Schema is the JSON schema of the category of clinical records.
+type Schema struct {
+	Type                 string              `json:"type"`
+	Properties           map[string]property `json:"properties"`
+	Required             []string            `json:"required"`
+	AdditionalProperties *bool               `json:"additionalProperties"`
+}
+
+// Get returns the schema of the category.
+func Get(category string) (*Schema, error) {
+	if !storage.ValidCategory(category) || category == "" {
+		return nil, fmt.Errorf("invalid category: %s", category)
+	}
+	data, err := files.ReadFile("schemas/" + category + ".json")
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{}
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema of %s: %v", category, err)
+	}
+	return s, nil
+}
+
+// Validate validates the plaintext of the record against the schema of the category.
+// The data without category isn't validated.
+func Validate(category, data string) error {
+	if category == "" {
+		return nil
+	}
+	s, err := Get(category)
+	if err != nil {
+		return err
+	}
+	return s.Validate([]byte(data))
+}
+
+// FromFields encodes the fields, e.g. the columns of csv row, as the record of the category.
+// The fields are converted to the types of the properties before validation.
+func FromFields(category string, fields map[string]string) (string, error) {
+	s, err := Get(category)
+	if err != nil {
+		return "", err
+	}
+	record := make(map[string]interface{})
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		p, ok := s.Properties[name]
+		if !ok {
+			record[name] = value
+			continue
+		}
+		record[name], err = p.convert(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	return string(data), s.Validate(data)
+}
+
+// Validate validates the JSON document against the schema.
+func (s *Schema) Validate(data []byte) error {
+	var record map[string]interface{}
+	err := json.Unmarshal(data, &record)
+	if err != nil || record == nil {
+		return errors.New("record must be JSON object")
+	}
+	for _, name := range s.Required {
+		if _, ok := record[name]; !ok {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	for name, value := range record {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return fmt.Errorf("%s isn't allowed", name)
+			}
+			continue
+		}
+		err = p.validate(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (p property) validate(value interface{}) error {
+	switch p.Type {
+	case "string":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("must be string")
+		}
+		if p.Format == "date" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return errors.New("must be date YYYY-MM-DD")
+			}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return errors.New("must be number")
+		}
+	case "integer":
+		v, ok := value.(float64)
+		if !ok || v != math.Trunc(v) {
+			return errors.New("must be integer")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be boolean")
+		}
+	}
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	for _, e := range p.Enum {
+		if e == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %v", p.Enum)
+}
+
+func (p property) convert(value string) (interface{}, error) {
+	switch p.Type {
+	case "number", "integer":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be %s", p.Type)
+		}
+		return v, nil
+	case "boolean":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("must be boolean")
+		}
+		return v, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,56 @@
+package schema
+
+import (
+	"testing"
+
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+func TestSchemas(t *testing.T) {
+	for _, category := range storage.Categories {
+		if _, err := Get(category); err != nil {
+			t.Errorf("%s: %v", category, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		category string
+		data     string
+		valid    bool
+	}{
+		{"", "any data", true},
+		{storage.CategoryAllergy, `{"substance":"peanut","severity":"severe"}`, true},
+		{storage.CategoryAllergy, `{"severity":"severe"}`, false},
+		{storage.CategoryAllergy, `{"substance":"peanut","severity":"fatal"}`, false},
+		{storage.CategoryAllergy, `{"substance":"peanut","note":"x"}`, false},
+		{storage.CategoryAllergy, `peanut`, false},
+		{storage.CategoryLabResult, `{"test":"glucose","value":5.4,"unit":"mmol/L"}`, true},
+		{storage.CategoryLabResult, `{"test":"glucose","value":"5.4"}`, false},
+		{storage.CategoryImmunization, `{"vaccine":"MMR","date":"2020-01-31","dose_number":2}`, true},
+		{storage.CategoryImmunization, `{"vaccine":"MMR","date":"31.01.2020"}`, false},
+		{storage.CategoryImmunization, `{"vaccine":"MMR","date":"2020-01-31","dose_number":1.5}`, false},
+		{"x-ray", `{}`, false},
+	}
+	for _, c := range cases {
+		err := Validate(c.category, c.data)
+		if (err == nil) != c.valid {
+			t.Errorf("%s %s: unexpected result %v", c.category, c.data, err)
+		}
+	}
+}
+
+func TestFromFields(t *testing.T) {
+	data, err := FromFields(storage.CategoryVitalSign, map[string]string{"type": "heart_rate", "value": "72", "unit": "bpm", "date": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != `{"type":"heart_rate","unit":"bpm","value":72}` {
+		t.Errorf("unexpected record %s", data)
+	}
+	_, err = FromFields(storage.CategoryVitalSign, map[string]string{"type": "heart_rate", "value": "high"})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
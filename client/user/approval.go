@@ -0,0 +1,56 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"healthcare-system-sawtooth/client/lib"
+	tpPayload "healthcare-system-sawtooth/tp/payload"
+	tpState "healthcare-system-sawtooth/tp/state"
+	tpUser "healthcare-system-sawtooth/tp/user"
+)
+
+// ErrApprovalPending is returned when the approval of multi-party request is recorded,
+// but the data isn't opened until the request is approved by enough trusted parties.
+var ErrApprovalPending = errors.New("approval is recorded, the data is opened once enough trusted parties approve the request")
+
+// SetApprovers configures the trusted parties who approve critical requests to the data of the current user.
+// Critical requests are opened only after the threshold of the approvers approved them.
+// The threshold 0 without approvers removes the configuration.
+func (c *Client) SetApprovers(threshold int, approvers []string) error {
+	if threshold < 0 || threshold > len(approvers) {
+		return errors.New("threshold must be between 1 and the number of approvers")
+	}
+	if threshold == 0 && len(approvers) > 0 {
+		return errors.New("threshold must be positive")
+	}
+	if len(approvers) > tpUser.MaxApprovers {
+		return fmt.Errorf("more than %d approvers", tpUser.MaxApprovers)
+	}
+	inputs := []string{c.GetAddress(), tpState.MakeAddress(tpState.AddressTypeName, c.Name, "")}
+	for _, approver := range approvers {
+		if approver == c.Name {
+			return errors.New("patient can't approve its own requests")
+		}
+		inputs = append(inputs, tpState.MakeAddress(tpState.AddressTypeName, approver, ""))
+	}
+	return c.SendTransactionAndWaiting([]tpPayload.StoragePayload{{
+		Action: tpPayload.UserSetApprovers,
+		Name:   c.Name,
+		Target: append([]string{strconv.Itoa(threshold)}, approvers...),
+	}}, inputs, []string{c.GetAddress()})
+}
+
+// GetApprovers returns the approvers of critical requests to the data of the current user and the threshold.
+func (c *Client) GetApprovers() ([]string, uint, error) {
+	userBytes, err := lib.GetStateData(c.GetAddress())
+	if err != nil {
+		return nil, 0, err
+	}
+	u, err := tpUser.UserFromBytes(userBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	return u.Approvers, u.ApprovalThreshold, nil
+}
@@ -0,0 +1,195 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	"healthcare-system-sawtooth/client/lib"
+	tpDelegation "healthcare-system-sawtooth/tp/delegation"
+	tpPayload "healthcare-system-sawtooth/tp/payload"
+	tpState "healthcare-system-sawtooth/tp/state"
+	"healthcare-system-sawtooth/tp/storage"
+	tpUser "healthcare-system-sawtooth/tp/user"
+)
+
+// GrantDelegation authorizes the delegate to act on behalf of the patient in the scopes until the expiration.
+// The patient grants the delegation, or the admin does it for the patient who can't manage keys.
+// The data of the patient granting the delegation is shared with the delegate, so the delegate can share it further.
+func (c *Client) GrantDelegation(patient, delegate string, scopes []string, expiration int64) error {
+	if c.IsActing() {
+		return errors.New("delegation can't be granted on behalf of the patient")
+	}
+	patientAddress, userPatient, err := c.GetUser(patient)
+	if err != nil {
+		return err
+	}
+	delegateAddress, userDelegate, err := c.GetUser(delegate)
+	if err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if !tpDelegation.ValidScope(scope) {
+			return errors.New("invalid scope: " + scope)
+		}
+	}
+	d := tpDelegation.NewDelegation(userPatient.Name, userPatient.PublicKey, userDelegate.Name, userDelegate.PublicKey, scopes, expiration, c.GetPublicKey())
+	address := tpState.MakeDelegationAddress(d.Patient, d.PatientKey, d.DelegateKey)
+	inputs := []string{address, patientAddress, delegateAddress, tpState.MakeSettingAddress(tpState.SettingAdmins), tpState.BlockInfoNamespace}
+	err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action:     tpPayload.GrantDelegation,
+		Name:       c.Name,
+		Delegation: *d,
+	}}, inputs, []string{address})
+	if err != nil {
+		return err
+	}
+	if userPatient.PublicKey != c.GetPublicKey() || !(d.HasScope(tpDelegation.ScopeShare) || d.HasScope(tpDelegation.ScopeProcess)) {
+		return nil
+	}
+	iNodes, err := c.ListPatientData()
+	if err != nil {
+		return err
+	}
+	for _, n := range iNodes {
+		if c.isSharedWith(n, userDelegate.Name) {
+			continue
+		}
+		err = c.ShareData(n.GetHash(), userDelegate.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeDelegation revokes the delegation of the patient to the delegate.
+// The data shared with the delegate is revoked too, when the patient revokes the delegation.
+func (c *Client) RevokeDelegation(patient, delegate string) error {
+	if c.IsActing() {
+		return errors.New("delegation can't be revoked on behalf of the patient")
+	}
+	_, userPatient, err := c.GetUser(patient)
+	if err != nil {
+		return err
+	}
+	_, userDelegate, err := c.GetUser(delegate)
+	if err != nil {
+		return err
+	}
+	address := tpState.MakeDelegationAddress(userPatient.Name, userPatient.PublicKey, userDelegate.PublicKey)
+	err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action: tpPayload.RevokeDelegation,
+		Name:   c.Name,
+		Target: []string{userPatient.Name, userPatient.PublicKey, userDelegate.PublicKey},
+	}}, []string{address, tpState.MakeSettingAddress(tpState.SettingAdmins)}, []string{address})
+	if err != nil || userPatient.PublicKey != c.GetPublicKey() {
+		return err
+	}
+	iNodes, err := c.ListPatientData()
+	if err != nil {
+		return err
+	}
+	for _, n := range iNodes {
+		if !c.isSharedWith(n, userDelegate.Name) {
+			continue
+		}
+		err = c.RevokeData(n.GetHash(), userDelegate.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDelegations lists the delegations of the patient.
+func (c *Client) ListDelegations(patient string) ([]*tpDelegation.Delegation, error) {
+	_, u, err := c.GetUser(patient)
+	if err != nil {
+		return nil, err
+	}
+	records, err := lib.ListDelegations(u.Name, u.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var delegations []*tpDelegation.Delegation
+	for _, delegationBytes := range decodeRecords(records) {
+		d, err := tpDelegation.DelegationFromBytes(delegationBytes)
+		if err != nil {
+			continue
+		}
+		delegations = append(delegations, d)
+	}
+	return delegations, nil
+}
+
+// ActAs makes the current user act on behalf of the patient, who delegated to the current user.
+// The data of the patient is read by the copies shared with the current user.
+func (c *Client) ActAs(patient string) error {
+	c.StopActing()
+	_, u, err := c.GetUser(patient)
+	if err != nil {
+		return err
+	}
+	if u.PublicKey == c.GetSignerPublicKey() {
+		return c.Sync()
+	}
+	delegationBytes, err := lib.GetStateData(tpState.MakeDelegationAddress(u.Name, u.PublicKey, c.GetSignerPublicKey()))
+	if err != nil {
+		return errors.New("current user isn't delegate of the patient")
+	}
+	d, err := tpDelegation.DelegationFromBytes(delegationBytes)
+	if err != nil {
+		return err
+	}
+	if d.IsExpired(time.Now().Unix()) {
+		return errors.New("delegation is expired")
+	}
+	err = c.ClientFramework.ActAs(u.Name, u.PublicKey)
+	if err != nil {
+		return err
+	}
+	return c.Sync()
+}
+
+// StopActing makes the current user act as itself again.
+func (c *Client) StopActing() error {
+	if !c.IsActing() {
+		return nil
+	}
+	c.ClientFramework.StopActing()
+	return c.Sync()
+}
+
+// readableCopy returns the data of the current user, which can be decrypted by the signer.
+// While the signer acts on behalf of the patient, it is the copy of the data shared with the signer.
+func (c *Client) readableCopy(di *storage.DataInfo) (*storage.DataInfo, error) {
+	if !c.IsActing() {
+		return di, nil
+	}
+	for _, n := range c.sharedCopies(di) {
+		if n.GetAddr() == c.GetSignerName() {
+			return c.User.Root.GetData(n.GetHash(), n.GetAddr())
+		}
+	}
+	return nil, errors.New("data isn't shared with the delegate")
+}
+
+// delegateCopy returns the copy of the data shared with the signer acting on behalf of the patient.
+func (c *Client) delegateCopy(info storage.DataInfo, keyAES []byte) (storage.DataInfo, error) {
+	signer := tpUser.GenerateUser(c.GetSignerName(), c.GetSignerPublicKey())
+	return c.shareCopy(&info, keyAES, signer, 0)
+}
+
+// isSharedWith reports whether the data owned by the current user is shared with the user.
+func (c *Client) isSharedWith(n storage.INode, username string) bool {
+	di, err := c.User.Root.GetData(n.GetHash(), c.User.Name)
+	if err != nil || di == nil {
+		return false
+	}
+	for _, shared := range c.sharedCopies(di) {
+		if shared.GetAddr() == username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package user
+
+import (
+	"errors"
+
+	"healthcare-system-sawtooth/client/lib"
+	tpPayload "healthcare-system-sawtooth/tp/payload"
+	tpState "healthcare-system-sawtooth/tp/state"
+	tpUser "healthcare-system-sawtooth/tp/user"
+)
+
+// CreateGroup creates new group led by the current user.
+func (c *Client) CreateGroup(groupName string) error {
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	addresses := []string{c.GetAddress(), getGroupAddress(groupName)}
+	err = c.SendTransactionAndWaiting([]tpPayload.StoragePayload{{
+		Action: tpPayload.CreateGroup,
+		Name:   c.Name,
+		Target: []string{groupName},
+	}}, addresses, addresses)
+	if err != nil {
+		return err
+	}
+	return c.Sync()
+}
+
+// GetGroup returns the group stored on the blockchain.
+func (c *Client) GetGroup(groupName string) (*tpUser.Group, error) {
+	groupBytes, err := lib.GetStateData(getGroupAddress(groupName))
+	if err != nil {
+		return nil, err
+	}
+	return tpUser.GroupFromBytes(groupBytes)
+}
+
+// AddGroupMember adds the user to the group with the role.
+func (c *Client) AddGroupMember(groupName, username string, role tpUser.Role) error {
+	return c.sendGroupMemberTransaction(tpPayload.GroupAddMember, groupName, username, role)
+}
+
+// RemoveGroupMember removes the user from the group.
+// The current user leaves the group when the username is its own.
+func (c *Client) RemoveGroupMember(groupName, username string) error {
+	return c.sendGroupMemberTransaction(tpPayload.GroupRemoveMember, groupName, username, 0)
+}
+
+// UpdateGroupMemberRole changes the role of the group member.
+func (c *Client) UpdateGroupMemberRole(groupName, username string, role tpUser.Role) error {
+	return c.sendGroupMemberTransaction(tpPayload.GroupUpdateMemberRole, groupName, username, role)
+}
+
+// TransferGroupLeadership makes the group member the new leader of the group.
+func (c *Client) TransferGroupLeadership(groupName, username string) error {
+	return c.sendGroupMemberTransaction(tpPayload.GroupUpdateLeader, groupName, username, 0)
+}
+
+// send the transaction of the group action targeting the member.
+func (c *Client) sendGroupMemberTransaction(action uint, groupName, username string, role tpUser.Role) error {
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	if groupName == "" {
+		return errors.New("need a valid group name")
+	}
+	memberAddress, member, err := c.GetUser(username)
+	if err != nil {
+		return err
+	}
+	addresses := []string{getGroupAddress(groupName), memberAddress}
+	err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action: action,
+		Name:   c.Name,
+		Target: []string{groupName, member.Name, member.PublicKey},
+		Role:   uint(role),
+	}}, addresses, addresses)
+	if err != nil {
+		return err
+	}
+	return c.Sync()
+}
+
+// getGroupAddress returns the address of the group.
+func getGroupAddress(groupName string) string {
+	return tpState.MakeAddress(tpState.AddressTypeGroup, groupName, "")
+}
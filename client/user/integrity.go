@@ -0,0 +1,146 @@
+package user
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"healthcare-system-sawtooth/client/crypto"
+	"healthcare-system-sawtooth/client/db/models"
+	tpCrypto "healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+// Violation is the data whose copy stored off-chain doesn't match the hash stored on the blockchain.
+type Violation struct {
+	Owner string // Owner of the data on the blockchain
+	Name  string
+	Hash  string
+	Err   error // IntegrityError, or the error of the data which can't be hashed
+}
+
+// loadData gets the encrypted data of the hash stored off-chain.
+// The missing data is reported as IntegrityError, as the data on the blockchain refers to it.
+func loadData(hash string) (*models.Data, error) {
+	d, err := models.GetDataByHashes(context.Background(), []string{hash})
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range d {
+		if data.Hash == hash {
+			return data, nil
+		}
+	}
+	return nil, &crypto.IntegrityError{Hash: hash}
+}
+
+// openData verifies and decrypts the data of the hash stored off-chain, and writes it to w.
+// The chunked stream is decrypted chunk by chunk, so the data written before the error must be discarded.
+func openData(hash string, key []byte, w io.Writer) error {
+	data, err := loadData(hash)
+	if err != nil {
+		return err
+	}
+	payload, err := decodePayload(data)
+	if err != nil {
+		return err
+	}
+	if data.Stream != nil {
+		_, err = crypto.DecryptStream(w, &models.ChunkStore{Stream: *data.Stream}, payload, key, hash)
+		return err
+	}
+	out, err := crypto.OpenData(payload, key, hash)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func decodePayload(data *models.Data) ([]byte, error) {
+	payload, err := hex.DecodeString(data.Payload)
+	if err != nil {
+		return nil, &crypto.IntegrityError{Hash: data.Hash, Actual: tpCrypto.SHA512HexFromBytes([]byte(data.Payload))}
+	}
+	return payload, nil
+}
+
+// VerifyData checks every data the current user can see against the hashes stored on the blockchain:
+// the own data, the copies shared by the user, and the data shared with the user by other users, which isn't expired.
+// The data isn't decrypted. It returns the number of checked data and the violations.
+func (c *Client) VerifyData() (int, []*Violation, error) {
+	err := c.ListUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	owned := make([]storage.INode, 0, len(c.User.Root.Repo.INodes))
+	for _, n := range c.User.Root.Repo.INodes {
+		owned = append(owned, n)
+	}
+	violations, err := verifyINodes(c.User.Name, owned)
+	if err != nil {
+		return 0, nil, err
+	}
+	checked := len(owned)
+	now := time.Now().Unix()
+	for _, u := range c.QueryCache {
+		if u.PublicKey == c.User.PublicKey {
+			continue
+		}
+		datas, err := listUserData(u)
+		if err != nil {
+			return 0, nil, err
+		}
+		var shared []storage.INode
+		for _, d := range datas {
+			if d.Addr != c.User.Name || (d.Expiration != 0 && d.Expiration <= now) {
+				continue
+			}
+			shared = append(shared, d)
+		}
+		v, err := verifyINodes(u.Name, shared)
+		if err != nil {
+			return 0, nil, err
+		}
+		checked += len(shared)
+		violations = append(violations, v...)
+	}
+	return checked, violations, nil
+}
+
+// verifyINodes checks the data of the owner against their hashes.
+func verifyINodes(owner string, iNodes []storage.INode) ([]*Violation, error) {
+	if len(iNodes) == 0 {
+		return nil, nil
+	}
+	hashes := make([]string, 0, len(iNodes))
+	for _, n := range iNodes {
+		hashes = append(hashes, n.GetHash())
+	}
+	records, err := models.GetDataByHashes(context.Background(), hashes)
+	if err != nil {
+		return nil, err
+	}
+	payloads := make(map[string]*models.Data, len(records))
+	for _, data := range records {
+		payloads[data.Hash] = data
+	}
+	var violations []*Violation
+	for _, n := range iNodes {
+		err = &crypto.IntegrityError{Hash: n.GetHash()}
+		if data, ok := payloads[n.GetHash()]; ok {
+			var payload []byte
+			payload, err = decodePayload(data)
+			if err == nil && data.Stream != nil {
+				err = crypto.VerifyStream(&models.ChunkStore{Stream: *data.Stream}, payload, n.GetHash())
+			} else if err == nil {
+				err = crypto.VerifyData(payload, n.GetHash())
+			}
+		}
+		if err != nil {
+			violations = append(violations, &Violation{Owner: owner, Name: n.GetName(), Hash: n.GetHash(), Err: err})
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,165 @@
+package user
+
+import (
+	"encoding/base64"
+
+	"healthcare-system-sawtooth/client/lib"
+	tpState "healthcare-system-sawtooth/tp/state"
+	"healthcare-system-sawtooth/tp/storage"
+	tpUser "healthcare-system-sawtooth/tp/user"
+)
+
+// loadRoot returns the root built from the data and keys stored by the user.
+// The root of legacy user, whose data isn't moved yet, is returned directly.
+func loadRoot(u *tpUser.User) (*storage.Root, error) {
+	if u.Root != nil {
+		return u.Root, nil
+	}
+	datas, err := listUserData(u)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := lib.ListUserKeys(u.Name, u.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	root := storage.GenerateRoot()
+	for _, d := range datas {
+		root.Repo.INodes = append(root.Repo.INodes, d)
+	}
+	for _, keyBytes := range decodeRecords(keys) {
+		key, err := storage.FileKeyFromRecord(keyBytes)
+		if err != nil {
+			lib.Logger.Errorf("failed to decode key: %v", err)
+			continue
+		}
+		root.Keys.Keys = append(root.Keys.Keys, key)
+	}
+	return root, nil
+}
+
+// listUserData returns the data stored by the user.
+func listUserData(u *tpUser.User) ([]*storage.Data, error) {
+	var datas []*storage.Data
+	if u.Root != nil {
+		for _, iNode := range u.Root.Repo.INodes {
+			switch iNode.(type) {
+			case *storage.Data:
+				datas = append(datas, iNode.(*storage.Data))
+			}
+		}
+		return datas, nil
+	}
+	records, err := lib.ListUserData(u.Name, u.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, dataBytes := range decodeRecords(records) {
+		d, err := storage.DataFromRecord(dataBytes)
+		if err != nil {
+			lib.Logger.Errorf("failed to decode data: %v", err)
+			continue
+		}
+		datas = append(datas, d)
+	}
+	return datas, nil
+}
+
+// getUserData returns the data stored by the user by hash and address, only the data and its key are read.
+// If the data doesn't exist, nil will be returned.
+func getUserData(u *tpUser.User, hash, addr string) (*storage.DataInfo, error) {
+	if u.Root != nil {
+		return u.Root.GetData(hash, addr)
+	}
+	dataBytes, err := lib.GetStateData(tpState.MakeDataAddress(u.Name, u.PublicKey, hash, addr))
+	if err != nil || len(dataBytes) == 0 {
+		return nil, nil
+	}
+	d, err := storage.DataFromRecord(dataBytes)
+	if err != nil {
+		return nil, err
+	}
+	// the copy shared with the trusted party holding the re-encryption key has the forward key only
+	key := &storage.FileKey{}
+	if d.KeyIndex != "" {
+		keyBytes, err := lib.GetStateData(tpState.MakeKeyAddress(u.Name, u.PublicKey, d.KeyIndex))
+		if err != nil {
+			return nil, err
+		}
+		key, err = storage.FileKeyFromRecord(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	info := storage.NewDataInfo(d.Name, d.Size, d.Hash, key.Key, addr, d.AccessType)
+	info.Source = d.Source
+	info.Version = d.GetVersion()
+	info.Prev = d.Prev
+	info.Expiration = d.Expiration
+	info.Origin = d.Origin
+	info.Policy = d.Policy
+	info.Category = d.Category
+	info.ForwardKey = d.ForwardKey
+	return info, nil
+}
+
+// decodeRecords returns the state data of the listed records.
+func decodeRecords(records []interface{}) [][]byte {
+	var result [][]byte
+	for _, r := range records {
+		m := r.(map[string]interface{})
+		recordBytes, err := base64.StdEncoding.DecodeString(m["data"].(string))
+		if err != nil {
+			continue
+		}
+		result = append(result, recordBytes)
+	}
+	return result
+}
+
+// dataCopy is the copy shared from the data, referenced by the data.
+// The data of the copy is nil if the copy was already revoked, pruned or replaced by another data.
+type dataCopy struct {
+	storage.DataRef
+	data *storage.Data
+}
+
+// addresses returns the addresses the deletion of the copy reads and writes:
+// the user accounting the copy, the copy, and its key and previous version if it still exists.
+func (dc dataCopy) addresses() []string {
+	addresses := []string{
+		tpState.MakeAddress(tpState.AddressTypeUser, dc.Owner, dc.OwnerKey),
+		tpState.MakeDataAddress(dc.Owner, dc.OwnerKey, dc.Hash, dc.Addr),
+	}
+	if dc.data == nil {
+		return addresses
+	}
+	if dc.data.KeyIndex != "" {
+		addresses = append(addresses, tpState.MakeKeyAddress(dc.Owner, dc.OwnerKey, dc.data.KeyIndex))
+	}
+	if dc.data.Prev != "" {
+		addresses = append(addresses, tpState.MakeDataAddress(dc.Owner, dc.OwnerKey, dc.data.Prev, dc.Addr))
+	}
+	return addresses
+}
+
+// listCopies returns the copies referenced by the data, and the copies shared further from them,
+// which the transaction processor deletes with the data.
+func listCopies(d *storage.Data) []dataCopy {
+	var copies []dataCopy
+	for _, ref := range d.Copies {
+		dc := dataCopy{DataRef: ref}
+		dataBytes, err := lib.GetStateData(tpState.MakeDataAddress(ref.Owner, ref.OwnerKey, ref.Hash, ref.Addr))
+		if err == nil && len(dataBytes) > 0 {
+			copied, err := storage.DataFromRecord(dataBytes)
+			if err == nil && copied.Source == d.Hash {
+				dc.data = copied
+			}
+		}
+		copies = append(copies, dc)
+		if dc.data != nil {
+			copies = append(copies, listCopies(dc.data)...)
+		}
+	}
+	return copies
+}
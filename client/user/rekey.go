@@ -0,0 +1,265 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"healthcare-system-sawtooth/client/db/models"
+	"healthcare-system-sawtooth/client/lib"
+	tpCrypto "healthcare-system-sawtooth/crypto"
+	tpPayload "healthcare-system-sawtooth/tp/payload"
+	"healthcare-system-sawtooth/tp/rekey"
+	tpState "healthcare-system-sawtooth/tp/state"
+	"healthcare-system-sawtooth/tp/storage"
+	tpUser "healthcare-system-sawtooth/tp/user"
+)
+
+// GrantReKey issues the re-encryption key, which allows the trusted party to forward the data of the current user,
+// shared with the trusted party, to the third party until the expiration without decrypting it.
+// The copies shared with the trusted party before, which have the key of the data, are shared with it again by the
+// forward key only.
+func (c *Client) GrantReKey(proxy, recipient string, expiration int64) error {
+	if c.IsActing() {
+		return errors.New("re-encryption key can't be issued on behalf of the patient")
+	}
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	proxyAddress, userProxy, err := c.GetUser(proxy)
+	if err != nil {
+		return err
+	}
+	recipientAddress, userRecipient, err := c.GetUser(recipient)
+	if err != nil {
+		return err
+	}
+	reKey, err := c.ReEncryptionKey(userRecipient.PublicKey)
+	if err != nil {
+		return err
+	}
+	key, err := c.EncryptDataKey(userProxy.PublicKey, tpCrypto.BytesToHex(reKey))
+	if err != nil {
+		return err
+	}
+	batches := []tpPayload.StoragePayload{{
+		Action: tpPayload.GrantReKey,
+		Name:   c.Name,
+		ReKey: *rekey.NewReKey(c.Name, c.GetPublicKey(), userProxy.Name, userProxy.PublicKey,
+			userRecipient.Name, userRecipient.PublicKey, tpCrypto.BytesToHex(key), expiration),
+	}}
+	shared, hashes, err := c.forwardableCopies(userProxy)
+	if err != nil {
+		return err
+	}
+	batches = append(batches, shared...)
+	address := tpState.MakeReKeyAddress(c.Name, c.GetPublicKey(), userProxy.PublicKey, userRecipient.PublicKey)
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	inputs := append(addresses, address, proxyAddress, recipientAddress, tpState.BlockInfoNamespace, tpState.SettingsNamespace)
+	err = c.SendTransactionAndWaiting(batches, inputs, append(addresses, address))
+	if err != nil {
+		return err
+	}
+	if len(hashes) > 0 {
+		err = models.DeleteDatasByHashes(hashes)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Sync()
+}
+
+// RevokeReKey revokes the re-encryption key of the patient from the trusted party to the third party.
+// It is revoked by the patient or by the trusted party.
+func (c *Client) RevokeReKey(patient, proxy, recipient string) error {
+	if c.IsActing() {
+		return errors.New("re-encryption key can't be revoked on behalf of the patient")
+	}
+	_, userPatient, err := c.GetUser(patient)
+	if err != nil {
+		return err
+	}
+	_, userProxy, err := c.GetUser(proxy)
+	if err != nil {
+		return err
+	}
+	_, userRecipient, err := c.GetUser(recipient)
+	if err != nil {
+		return err
+	}
+	address := tpState.MakeReKeyAddress(userPatient.Name, userPatient.PublicKey, userProxy.PublicKey, userRecipient.PublicKey)
+	return c.SendTransactionAndWaiting([]tpPayload.StoragePayload{{
+		Action: tpPayload.RevokeReKey,
+		Name:   c.Name,
+		Target: []string{userPatient.Name, userPatient.PublicKey, userProxy.PublicKey, userRecipient.PublicKey},
+	}}, []string{address}, []string{address})
+}
+
+// ListReKeys lists the re-encryption keys issued by the patient.
+func (c *Client) ListReKeys(patient string) ([]*rekey.ReKey, error) {
+	_, u, err := c.GetUser(patient)
+	if err != nil {
+		return nil, err
+	}
+	records, err := lib.ListReKeys(u.Name, u.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var reKeys []*rekey.ReKey
+	for _, reKeyBytes := range decodeRecords(records) {
+		k, err := rekey.ReKeyFromBytes(reKeyBytes)
+		if err != nil {
+			continue
+		}
+		reKeys = append(reKeys, k)
+	}
+	return reKeys, nil
+}
+
+// getReKey returns the re-encryption key of the patient from the current user to the third party, hex encoded.
+// If the patient didn't issue it, or it is expired, the empty key will be returned.
+func (c *Client) getReKey(userPatient, userTo *tpUser.User) (string, error) {
+	address := tpState.MakeReKeyAddress(userPatient.Name, userPatient.PublicKey, c.GetSignerPublicKey(), userTo.PublicKey)
+	reKeyBytes, err := lib.GetStateData(address)
+	if errors.Is(err, lib.ErrNoSuchEndpoint) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	k, err := rekey.ReKeyFromBytes(reKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	if k.IsExpired(time.Now().Unix()) {
+		return "", nil
+	}
+	reKey, err := c.DecryptDataKey(k.Key)
+	if err != nil {
+		return "", err
+	}
+	return tpCrypto.BytesToHex(reKey), nil
+}
+
+// forwardKey encrypts the key of the data for the proxy key of the current user by proxy re-encryption,
+// so the trusted party holding the re-encryption key forwards the data to the third party without decrypting it.
+// The proxy key of the patient isn't known to the delegate, so the data isn't shared with the trusted party
+// on behalf of the patient.
+func (c *Client) forwardKey(keyAES []byte) (string, error) {
+	if c.IsActing() {
+		return "", errors.New("data can't be shared with the trusted party holding the re-encryption key on behalf of the patient")
+	}
+	key, err := tpCrypto.ProxyEncryption(c.GetProxyPublicKey(), tpCrypto.BytesToHex(keyAES))
+	if err != nil {
+		return "", err
+	}
+	return tpCrypto.BytesToHex(key), nil
+}
+
+// forwardCopy returns the copy of the data of the patient shared with the current user, which is shared with
+// the third party until the expiration. The forward key of the data is re-encrypted for the third party by
+// the re-encryption key the patient issued, so the current user never decrypts the key of the data.
+func (c *Client) forwardCopy(di *storage.DataInfo, userFrom, userTo *tpUser.User, expiration int64) (storage.DataInfo, error) {
+	if di.ForwardKey == "" {
+		return storage.DataInfo{}, fmt.Errorf("%s has no forward key, the patient must issue the re-encryption key to share it again", di.Name)
+	}
+	reKey, err := c.getReKey(userFrom, userTo)
+	if err != nil {
+		return storage.DataInfo{}, err
+	}
+	if reKey == "" {
+		return storage.DataInfo{}, errors.New("patient didn't issue the re-encryption key for the third party")
+	}
+	key, err := tpCrypto.ProxyReEncryption(reKey, di.ForwardKey)
+	if err != nil {
+		return storage.DataInfo{}, err
+	}
+	return c.copyInfo(di, userTo.Name, tpCrypto.BytesToHex(key), expiration), nil
+}
+
+// proxyKeys returns the public keys of the trusted parties holding the unexpired re-encryption keys of the current user.
+func (c *Client) proxyKeys() (map[string]bool, error) {
+	records, err := lib.ListReKeys(c.Name, c.GetPublicKey())
+	if err != nil {
+		return nil, err
+	}
+	proxyKeys := make(map[string]bool)
+	now := time.Now().Unix()
+	for _, reKeyBytes := range decodeRecords(records) {
+		k, err := rekey.ReKeyFromBytes(reKeyBytes)
+		if err != nil || k.IsExpired(now) {
+			continue
+		}
+		proxyKeys[k.ProxyKey] = true
+	}
+	return proxyKeys, nil
+}
+
+// recipientCopy returns the copy of the data shared with the user until the expiration.
+// The trusted party holding the re-encryption key gets the copy with the forward key only,
+// so it can forward the data to the third party, but can't decrypt it.
+func (c *Client) recipientCopy(di *storage.DataInfo, keyAES []byte, userTo *tpUser.User, expiration int64, proxyKeys map[string]bool) (storage.DataInfo, error) {
+	if !proxyKeys[userTo.PublicKey] {
+		return c.shareCopy(di, keyAES, userTo, expiration)
+	}
+	return c.proxyCopy(di, keyAES, userTo, expiration)
+}
+
+// proxyCopy returns the copy of the data shared with the trusted party until the expiration, which has the forward key
+// of the data, and no key the trusted party can decrypt.
+func (c *Client) proxyCopy(di *storage.DataInfo, keyAES []byte, userTo *tpUser.User, expiration int64) (storage.DataInfo, error) {
+	key, err := c.forwardKey(keyAES)
+	if err != nil {
+		return storage.DataInfo{}, err
+	}
+	info := c.copyInfo(di, userTo.Name, "", expiration)
+	info.ForwardKey = key
+	return info, nil
+}
+
+// forwardableCopies returns the payloads sharing again the copies of the data of the current user shared with
+// the trusted party before, so that they have the forward key only, and the hashes of their own encrypted data, if any.
+func (c *Client) forwardableCopies(userTo *tpUser.User) ([]tpPayload.StoragePayload, []string, error) {
+	iNodes, err := c.ListPatientData()
+	if err != nil {
+		return nil, nil, err
+	}
+	var batches []tpPayload.StoragePayload
+	var hashes []string
+	for _, n := range iNodes {
+		di, err := c.User.Root.GetData(n.GetHash(), c.User.Name)
+		if err != nil || di == nil {
+			continue
+		}
+		for _, shared := range c.sharedCopies(di) {
+			if shared.GetAddr() != userTo.Name {
+				continue
+			}
+			sharedInfo, err := c.User.Root.GetData(shared.GetHash(), shared.GetAddr())
+			if err != nil || sharedInfo == nil || sharedInfo.Key == "" {
+				continue
+			}
+			_, _, keyAES, err := c.patientDataKey(di.Hash)
+			if err != nil {
+				return nil, nil, err
+			}
+			info, err := c.proxyCopy(di, keyAES, userTo, sharedInfo.Expiration)
+			if err != nil {
+				return nil, nil, err
+			}
+			if shared.GetHash() != di.Hash {
+				hashes = append(hashes, shared.GetHash())
+			}
+			batches = append(batches, tpPayload.StoragePayload{
+				Action:   tpPayload.UserRevokeData,
+				Name:     c.Name,
+				DataInfo: storage.DataInfo{Hash: shared.GetHash(), Addr: shared.GetAddr()},
+			}, tpPayload.StoragePayload{
+				Action:   tpPayload.UserCreateData,
+				Name:     c.Name,
+				DataInfo: info,
+			})
+		}
+	}
+	return batches, hashes, nil
+}
@@ -9,24 +9,32 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"healthcare-system-sawtooth/client/db/models"
 	"healthcare-system-sawtooth/tp/storage"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"healthcare-system-sawtooth/client/crypto"
 	"healthcare-system-sawtooth/client/lib"
+	"healthcare-system-sawtooth/client/schema"
 	tpCrypto "healthcare-system-sawtooth/crypto"
+	tpAudit "healthcare-system-sawtooth/tp/audit"
 	tpPayload "healthcare-system-sawtooth/tp/payload"
+	tpPolicy "healthcare-system-sawtooth/tp/policy"
+	tpRequest "healthcare-system-sawtooth/tp/request"
+	tpState "healthcare-system-sawtooth/tp/state"
 	tpUser "healthcare-system-sawtooth/tp/user"
 )
 
 // Client provides the platform for user storing data.
 type Client struct {
 	User         *tpUser.User
-	lastQueryEnd string
 	QueryCache   map[string]*tpUser.User
+	SendReceipts bool // Submit the access receipt before the shared data is decrypted.
 	*lib.ClientFramework
 }
 
@@ -59,10 +67,14 @@ func NewUserClient(name, keyFile string) (*Client, error) {
 			u, err := tpUser.UserFromBytes(data)
 			if err != nil {
 				lib.Logger.Errorf("failed to sync: %v", err)
+			} else if cli.IsActing() {
+				// the state of the signer isn't used while it acts on behalf of the patient
+				continue
 			} else {
 				lib.Logger.Infof("user state: %+v", u)
-				for _, k := range u.Root.Keys.Keys {
-					lib.Logger.Infof("keys state: %+v", k)
+				// data and keys are stored at their own addresses, and synced on demand
+				if u.Root == nil && cli.User != nil {
+					u.Root = cli.User.Root
 				}
 				cli.User = u
 			}
@@ -81,6 +93,10 @@ func (c *Client) Sync() error {
 	if err != nil {
 		return err
 	}
+	u.Root, err = loadRoot(u)
+	if err != nil {
+		return err
+	}
 	c.User = u
 	return nil
 }
@@ -100,9 +116,18 @@ func (c *Client) UserRegister() error {
 }
 
 // CreatePatientData create new data of the source.
+// The data of the category is validated against its schema before encryption.
 // upload data into MongoDB, then send transaction.
-func (c *Client) CreatePatientData(name, data string, accessType uint) (*storage.DataInfo, error) {
-	err := c.Sync()
+func (c *Client) CreatePatientData(name, data string, accessType uint, category string) (*storage.DataInfo, error) {
+	err := schema.Validate(category, data)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDataSettings(accessType, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	err = c.Sync()
 	if err != nil {
 		return nil, err
 	}
@@ -111,19 +136,296 @@ func (c *Client) CreatePatientData(name, data string, accessType uint) (*storage
 	if err != nil {
 		return nil, err
 	}
+	info.Version = 1
+	info.Category = category
+	err = c.User.Root.CreateData(info)
+	if err != nil {
+		return nil, err
+	}
+	batches := []tpPayload.StoragePayload{{
+		Action:   tpPayload.UserCreateData,
+		Name:     c.Name,
+		DataInfo: info,
+	}}
+	// the delegate reads the data created on behalf of the patient by its copy
+	if c.IsActing() {
+		shared, err := c.delegateCopy(info, keyAES)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserCreateData,
+			Name:     c.Name,
+			DataInfo: shared,
+		})
+	}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	err = c.SendTransactionAndWaiting(batches, append(addresses, tpState.SettingsNamespace), addresses)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// UploadPatientData creates new data of the source read from r, which is encrypted as the chunked stream,
+// so the large attachment is uploaded in constant memory. The data isn't validated against the schema of any category.
+func (c *Client) UploadPatientData(name string, r io.Reader, accessType uint) (*storage.DataInfo, error) {
+	err := checkDataSettings(accessType, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Sync()
+	if err != nil {
+		return nil, err
+	}
+	keyAES := tpCrypto.GenerateRandomAESKey(lib.AESKeySize)
+	info, err := crypto.GenerateStreamDataInfo(name, r, c.GetPublicKey(), c.User.Name, tpCrypto.BytesToHex(keyAES), accessType)
+	if err != nil {
+		return nil, err
+	}
+	// the size is known after the data is stored
+	err = checkDataSettings(accessType, info.Size)
+	if err != nil {
+		models.DeleteDatasByHashes([]string{info.Hash})
+		return nil, err
+	}
+	info.Version = 1
 	err = c.User.Root.CreateData(info)
 	if err != nil {
 		return nil, err
 	}
-	addresses := []string{c.GetAddress()}
-	err = c.SendTransactionAndWaiting([]tpPayload.StoragePayload{{
+	batches := []tpPayload.StoragePayload{{
 		Action:   tpPayload.UserCreateData,
 		Name:     c.Name,
 		DataInfo: info,
-	}}, addresses, addresses)
+	}}
+	if c.IsActing() {
+		shared, err := c.delegateCopy(info, keyAES)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserCreateData,
+			Name:     c.Name,
+			DataInfo: shared,
+		})
+	}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	err = c.SendTransactionAndWaiting(batches, append(addresses, tpState.SettingsNamespace), addresses)
+	if err != nil {
+		return nil, err
+	}
 	return &info, nil
 }
 
+// checkDataSettings checks the data against the settings of the network before the data is stored,
+// since the transaction of the data disallowed by the settings is rejected.
+func checkDataSettings(accessType uint, size int64) error {
+	settings, err := lib.GetSettings()
+	if err != nil {
+		return err
+	}
+	if !settings.AllowsAccessType(accessType) {
+		return fmt.Errorf("access type %d isn't allowed", accessType)
+	}
+	if settings.MaxDataSize > 0 && size > settings.MaxDataSize {
+		return fmt.Errorf("data is larger than %d bytes", settings.MaxDataSize)
+	}
+	return nil
+}
+
+// UpdatePatientData create the next version of the data owned by the current user.
+// If followShares is true, the copies shared from the previous version are replaced by the new version.
+func (c *Client) UpdatePatientData(hash, data string, followShares bool) (*storage.DataInfo, error) {
+	err := c.Sync()
+	if err != nil {
+		return nil, err
+	}
+	di, err := c.User.Root.GetData(hash, c.User.Name)
+	if err != nil {
+		return nil, err
+	}
+	if di == nil {
+		return nil, errors.New("data doesn't exist")
+	}
+	err = schema.Validate(di.Category, data)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDataSettings(di.AccessType, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var shares []storage.INode
+	var proxyKeys map[string]bool
+	if followShares {
+		shares = c.sharedCopies(di)
+		proxyKeys, err = c.proxyKeys()
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyAES := tpCrypto.GenerateRandomAESKey(lib.AESKeySize)
+	info, err := crypto.GenerateDataInfo(di.Name, data, c.GetPublicKey(), c.User.Name, tpCrypto.BytesToHex(keyAES), di.AccessType, 0)
+	if err != nil {
+		return nil, err
+	}
+	info.Version = di.Version + 1
+	info.Prev = hash
+	info.Category = di.Category
+	info.Policy = di.Policy
+	batches := []tpPayload.StoragePayload{{
+		Action:   tpPayload.UserUpdateData,
+		Name:     c.Name,
+		DataInfo: info,
+	}}
+	var revoked []string
+	sharedWithSigner := false
+	for _, n := range shares {
+		if n.GetAddr() == c.GetSignerName() {
+			sharedWithSigner = true
+		}
+		_, userTo, err := c.GetUser(n.GetAddr())
+		if err != nil {
+			return nil, err
+		}
+		shared, err := c.recipientCopy(&info, keyAES, userTo, 0, proxyKeys)
+		if err != nil {
+			return nil, err
+		}
+		// the copies sharing the encrypted data of the previous version keep it
+		if n.GetHash() != hash {
+			revoked = append(revoked, n.GetHash())
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserRevokeData,
+			Name:     c.Name,
+			DataInfo: storage.DataInfo{Hash: n.GetHash(), Addr: n.GetAddr()},
+		}, tpPayload.StoragePayload{
+			Action:   tpPayload.UserCreateData,
+			Name:     c.Name,
+			DataInfo: shared,
+		})
+	}
+	if c.IsActing() && !sharedWithSigner {
+		shared, err := c.delegateCopy(info, keyAES)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserCreateData,
+			Name:     c.Name,
+			DataInfo: shared,
+		})
+	}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	err = c.SendTransactionAndWaiting(batches, append(addresses, tpState.SettingsNamespace), addresses)
+	if err != nil {
+		return nil, err
+	}
+	if len(revoked) > 0 {
+		err = models.DeleteDatasByHashes(revoked)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &info, c.Sync()
+}
+
+// GetPatientDataHistory get all the versions of the data owned by the current user by name.
+// The versions are ordered from the latest to the oldest.
+func (c *Client) GetPatientDataHistory(name string) ([]*storage.DataInfo, []string, error) {
+	iNodes, err := c.ListPatientData()
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeMap := make(map[string]storage.INode)
+	prevs := make(map[string]bool)
+	for _, n := range iNodes {
+		if n.GetName() != name {
+			continue
+		}
+		nodeMap[n.GetHash()] = n
+		prevs[n.GetPrev()] = true
+	}
+	var heads []storage.INode
+	for hash, n := range nodeMap {
+		if !prevs[hash] {
+			heads = append(heads, n)
+		}
+	}
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].GetVersion() > heads[j].GetVersion()
+	})
+	var infos []*storage.DataInfo
+	var datas []string
+	for _, head := range heads {
+		for n, ok := head, true; ok; n, ok = nodeMap[n.GetPrev()] {
+			di, data, err := c.GetPatientData(n.GetHash())
+			if err != nil {
+				return nil, nil, err
+			}
+			infos = append(infos, di)
+			datas = append(datas, data)
+		}
+	}
+	if len(infos) == 0 {
+		return nil, nil, errors.New("data doesn't exist")
+	}
+	return infos, datas, nil
+}
+
+// DeletePatientData delete the data owned by the current user by hash.
+// The copies shared from the data are deleted too, both from the blockchain and MongoDB.
+func (c *Client) DeletePatientData(hash string) error {
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	removed, err := c.User.Root.DeleteDataWithShares(hash, c.User.Name)
+	if err != nil {
+		return err
+	}
+	// the copies recorded in the data are deleted by the transaction processor, including the copies shared further
+	// by the trusted parties, and the copies shared before they were recorded are revoked by the same batch
+	copies := listCopies(removed[0])
+	recorded := make(map[string]bool)
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	for _, copied := range copies {
+		if copied.data != nil && copied.Owner == c.Name {
+			recorded[copied.Hash+"/"+copied.Addr] = true
+		}
+		addresses = append(addresses, copied.addresses()...)
+	}
+	var hashes []string
+	batches := make([]tpPayload.StoragePayload, 0)
+	for _, d := range removed {
+		hashes = append(hashes, d.Hash)
+		if d.Addr == c.Name || recorded[d.Hash+"/"+d.Addr] {
+			continue
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserRevokeData,
+			Name:     c.Name,
+			DataInfo: storage.DataInfo{Hash: d.Hash, Addr: d.Addr},
+		})
+	}
+	batches = append(batches, tpPayload.StoragePayload{
+		Action:   tpPayload.UserDeleteData,
+		Name:     c.Name,
+		DataInfo: storage.DataInfo{Hash: hash, Addr: c.Name},
+	})
+	err = c.SendTransactionAndWaiting(batches, addresses, addresses)
+	if err != nil {
+		return err
+	}
+	err = models.DeleteDatasByHashes(hashes)
+	if err != nil {
+		return err
+	}
+	return c.Sync()
+}
+
 // ListPatientData list all the data owned by the current user
 func (c *Client) ListPatientData() ([]storage.INode, error) {
 	err := c.Sync()
@@ -140,36 +442,75 @@ func (c *Client) ListPatientData() ([]storage.INode, error) {
 	return filtered, nil
 }
 
+// ListPatientDataByCategory list the data of the category owned by the current user.
+// The category is stored with the data, so the data isn't decrypted.
+func (c *Client) ListPatientDataByCategory(category string) ([]storage.INode, error) {
+	iNodes, err := c.ListPatientData()
+	if err != nil {
+		return nil, err
+	}
+	var filtered []storage.INode
+	for _, n := range iNodes {
+		if n.GetCategory() != category {
+			continue
+		}
+		filtered = append(filtered, n)
+	}
+	return filtered, nil
+}
+
 // GetPatientData get the data owned by the current user by hash
 func (c *Client) GetPatientData(hash string) (*storage.DataInfo, string, error) {
 	err := c.Sync()
 	if err != nil {
 		return nil, "", err
 	}
-	// Check Destination Path exists
-	di, err := c.User.Root.GetData(hash, c.User.Name)
+	di, readable, keyAes, err := c.patientDataKey(hash)
 	if err != nil {
 		return nil, "", err
 	}
-	if di == nil {
-		return nil, "", errors.New("data doesn't exist")
-	}
-	ctx := context.Background()
-	d, err := models.GetDataByHashes(ctx, []string{hash})
+	var out strings.Builder
+	err = openData(readable.Hash, keyAes, &out)
 	if err != nil {
 		return nil, "", err
 	}
-	keyAes, err := c.DecryptDataKey(di.Key)
+
+	return di, out.String(), nil
+}
+
+// DownloadPatientData writes the data owned by the current user by hash to w.
+// The chunked stream is decrypted in constant memory, so the data written before the error must be discarded.
+func (c *Client) DownloadPatientData(hash string, w io.Writer) (*storage.DataInfo, error) {
+	err := c.Sync()
 	if err != nil {
-		fmt.Println("failed to decrypt file key:", err)
-		return nil, "", err
+		return nil, err
 	}
-	_, out, err := crypto.DecryptData(tpCrypto.HexToBytes(d[0].Payload), keyAes)
+	di, readable, keyAes, err := c.patientDataKey(hash)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+	return di, openData(readable.Hash, keyAes, w)
+}
 
-	return di, string(out), nil
+// patientDataKey returns the data owned by the current user by hash, the copy of the data readable by the signer,
+// and the key of the data.
+func (c *Client) patientDataKey(hash string) (*storage.DataInfo, *storage.DataInfo, []byte, error) {
+	di, err := c.User.Root.GetData(hash, c.User.Name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if di == nil {
+		return nil, nil, nil, errors.New("data doesn't exist")
+	}
+	readable, err := c.readableCopy(di)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyAes, err := c.DecryptDataKey(readable.Key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return di, readable, keyAes, nil
 }
 
 // ListSharedPatientData lists the data shared by the username
@@ -183,12 +524,20 @@ func (c *Client) ListSharedPatientData(username string) ([]storage.INode, error)
 		return nil, err
 	}
 
+	datas, err := listUserData(user)
+	if err != nil {
+		return nil, err
+	}
 	var hashes []string
 	nodeMap := make(map[string]storage.INode, 0)
-	for _, n := range user.Root.Repo.INodes {
+	now := time.Now().Unix()
+	for _, n := range datas {
 		if n.GetAddr() != c.User.Name {
 			continue
 		}
+		if n.GetExpiration() != 0 && n.GetExpiration() <= now {
+			continue
+		}
 		hashes = append(hashes, n.GetHash())
 		nodeMap[n.GetHash()] = n
 	}
@@ -196,12 +545,12 @@ func (c *Client) ListSharedPatientData(username string) ([]storage.INode, error)
 	if len(hashes) == 0 {
 		return nil, nil
 	}
-	datas, err := models.GetDataByHashes(ctx, hashes)
+	records, err := models.GetDataByHashes(ctx, hashes)
 	if err != nil {
 		return nil, err
 	}
 	var filtered []storage.INode
-	for _, data := range datas {
+	for _, data := range records {
 		inode, ok := nodeMap[data.Hash]
 		if !ok {
 			continue
@@ -213,39 +562,156 @@ func (c *Client) ListSharedPatientData(username string) ([]storage.INode, error)
 
 // GetSharedPatientData gets the data shared by hash and username
 func (c *Client) GetSharedPatientData(hash, username string) (*storage.DataInfo, string, error) {
-	err := c.Sync()
+	di, keyAES, err := c.sharedDataKey(hash, username)
 	if err != nil {
 		return nil, "", err
 	}
-	_, user, err := c.GetUser(username)
+	var out strings.Builder
+	err = openData(hash, keyAES, &out)
 	if err != nil {
 		return nil, "", err
 	}
-	di, err := user.Root.GetData(hash, c.User.Name)
+
+	return di, out.String(), nil
+}
+
+// DownloadSharedPatientData writes the data shared by hash and username to w.
+// The chunked stream is decrypted in constant memory, so the data written before the error must be discarded.
+func (c *Client) DownloadSharedPatientData(hash, username string, w io.Writer) (*storage.DataInfo, error) {
+	di, keyAES, err := c.sharedDataKey(hash, username)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	if di == nil {
-		return nil, "", errors.New("data doesn't exist")
+	return di, openData(hash, keyAES, w)
+}
+
+// sharedDataKey returns the data shared with the current user by hash and username, and the key of the data.
+// The access receipt is submitted before the key is decrypted.
+func (c *Client) sharedDataKey(hash, username string) (*storage.DataInfo, []byte, error) {
+	di, user, err := c.sharedData(hash, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if di.Key == "" {
+		return nil, nil, errors.New("data is shared with the current user only to forward it to the third party")
+	}
+	if c.SendReceipts {
+		err = c.sendAccessReceipt(user, hash)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 	keyAES, err := c.DecryptDataKey(di.Key)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	ctx := context.Background()
-	d, err := models.GetDataByHashes(ctx, []string{hash})
+	return di, keyAES, nil
+}
+
+// sharedData returns the data shared with the current user by hash and username, and the user who shared it.
+func (c *Client) sharedData(hash, username string) (*storage.DataInfo, *tpUser.User, error) {
+	if c.IsActing() {
+		return nil, nil, errors.New("shared data can't be read on behalf of the patient")
+	}
+	err := c.Sync()
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	if d == nil {
-		return nil, "", errors.New("data doesn't exist")
+	_, user, err := c.GetUser(username)
+	if err != nil {
+		return nil, nil, err
 	}
-	_, out, err := crypto.DecryptData(tpCrypto.HexToBytes(d[0].Payload), keyAES)
+	di, err := getUserData(user, hash, c.User.Name)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+	if di == nil {
+		return nil, nil, errors.New("data doesn't exist")
+	}
+	if di.Expiration != 0 && di.Expiration <= time.Now().Unix() {
+		return nil, nil, errors.New("access to the data is expired")
 	}
+	return di, user, nil
+}
 
-	return di, string(out), nil
+// renewCopy checks whether the data can be shared with the user again.
+// The copy shared with the same hash isn't shared twice until it is expired, then it is revoked by the returned payloads.
+func (c *Client) renewCopy(hash, usernameTo string) ([]tpPayload.StoragePayload, bool, error) {
+	existing, err := c.User.Root.GetData(hash, usernameTo)
+	if err != nil || existing == nil {
+		return nil, err == nil, err
+	}
+	if existing.Expiration == 0 || existing.Expiration > time.Now().Unix() {
+		return nil, false, nil
+	}
+	err = c.User.Root.DeleteData(hash, usernameTo)
+	if err != nil {
+		return nil, false, err
+	}
+	return []tpPayload.StoragePayload{{
+		Action:   tpPayload.UserRevokeData,
+		Name:     c.Name,
+		DataInfo: storage.DataInfo{Hash: hash, Addr: usernameTo},
+	}}, true, nil
+}
+
+// shareCopy returns the copy of the data shared with the user until the expiration.
+// The copy reuses the encrypted data stored off-chain, and only the key of the data is wrapped for the user by ECIES,
+// so the copy has the same hash as the data.
+func (c *Client) shareCopy(di *storage.DataInfo, keyAES []byte, userTo *tpUser.User, expiration int64) (storage.DataInfo, error) {
+	key, err := c.EncryptDataKey(userTo.PublicKey, tpCrypto.BytesToHex(keyAES))
+	if err != nil {
+		return storage.DataInfo{}, err
+	}
+	return c.copyInfo(di, userTo.Name, tpCrypto.BytesToHex(key), expiration), nil
+}
+
+// copyInfo returns the copy of the data shared with the user by the key of the data encrypted for the user.
+func (c *Client) copyInfo(di *storage.DataInfo, usernameTo, key string, expiration int64) storage.DataInfo {
+	info := storage.NewDataInfo(fmt.Sprintf("shared_by_%s_%s", c.Name, di.Name), di.Size, di.Hash, key, usernameTo, di.AccessType)
+	info.Expiration = expiration
+	info.Source = di.Hash
+	info.Version = di.Version
+	info.Policy = di.Policy
+	info.Category = di.Category
+	return *info
+}
+
+// sendAccessReceipt records the access of the current user to the data shared by the owner in the audit log.
+func (c *Client) sendAccessReceipt(owner *tpUser.User, hash string) error {
+	inputs := []string{
+		c.GetAddress(),
+		tpState.MakeAddress(tpState.AddressTypeUser, owner.Name, owner.PublicKey),
+		tpState.MakeDataAddress(owner.Name, owner.PublicKey, hash, c.Name),
+		tpState.Namespace + tpState.NameNamespace,
+		tpState.BlockInfoNamespace,
+	}
+	return c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action:   tpPayload.UserAccessData,
+		Name:     c.Name,
+		Target:   []string{owner.Name, owner.PublicKey},
+		DataInfo: storage.DataInfo{Hash: hash, Addr: c.Name},
+	}}, inputs, []string{tpState.Namespace + tpState.AuditNamespace})
+}
+
+// ListAuditLog lists the receipts of access to the data of the current user, from the latest to the oldest.
+func (c *Client) ListAuditLog() ([]*tpAudit.Receipt, error) {
+	records, err := lib.ListAuditLog(c.Name, c.GetPublicKey())
+	if err != nil {
+		return nil, err
+	}
+	var receipts []*tpAudit.Receipt
+	for _, receiptBytes := range decodeRecords(records) {
+		r, err := tpAudit.ReceiptFromBytes(receiptBytes)
+		if err != nil {
+			continue
+		}
+		receipts = append(receipts, r)
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].Timestamp > receipts[j].Timestamp
+	})
+	return receipts, nil
 }
 
 // ShareData share the data owned by the current user
@@ -254,21 +720,23 @@ func (c *Client) ShareData(hash, usernameTo string) error {
 	if err != nil {
 		return err
 	}
-	di, data, err := c.GetPatientData(hash)
+	di, _, keyAES, err := c.patientDataKey(hash)
 	if err != nil {
 		fmt.Println("failed to get user:", err)
 		return err
 	}
-	addresses := []string{c.GetAddress()}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
 
 	_, userTo, err := c.GetUser(usernameTo)
 	if err != nil {
 		fmt.Println("failed to get user:", err)
 		return err
 	}
-	dataName := fmt.Sprintf("shared_by_%s_%s", c.Name, di.Name)
-	keyAES := tpCrypto.GenerateRandomAESKey(lib.AESKeySize)
-	info, err := crypto.GenerateDataInfo(dataName, data, userTo.PublicKey, userTo.Name, tpCrypto.BytesToHex(keyAES), di.AccessType, 0)
+	proxyKeys, err := c.proxyKeys()
+	if err != nil {
+		return err
+	}
+	info, err := c.recipientCopy(di, keyAES, userTo, 0, proxyKeys)
 	if err != nil {
 		return err
 	}
@@ -277,15 +745,62 @@ func (c *Client) ShareData(hash, usernameTo string) error {
 	if err != nil {
 		return err
 	}
-	lib.Logger.Infof("%s", info)
+	lib.Logger.Infof("share %s (%s) with %s", info.Name, info.Hash, info.Addr)
 	return c.SendTransactionAndWaiting([]tpPayload.StoragePayload{{
 		Action:   tpPayload.UserCreateData,
 		Name:     c.Name,
 		DataInfo: info,
-	}}, addresses, addresses)
+	}}, append(addresses, tpState.SettingsNamespace), addresses)
+}
+
+// RevokeData revoke the data shared by the current user with the user.
+// The shared copies are removed from the blockchain, the encrypted data stays in MongoDB for the owner
+// unless the copy was shared with its own encrypted data.
+// The key of the data isn't rotated, as the hash of the data would change, so the user who kept the key
+// or the data read before the revocation can still read the data.
+func (c *Client) RevokeData(hash, usernameTo string) error {
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	di, err := c.User.Root.GetData(hash, c.User.Name)
+	if err != nil {
+		return err
+	}
+	if di == nil {
+		return errors.New("data doesn't exist")
+	}
+	var hashes []string
+	batches := make([]tpPayload.StoragePayload, 0)
+	for _, n := range c.sharedCopies(di) {
+		if n.GetAddr() != usernameTo {
+			continue
+		}
+		// only the copies shared before the encrypted data was reused have their own encrypted data
+		if n.GetHash() != di.Hash {
+			hashes = append(hashes, n.GetHash())
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserRevokeData,
+			Name:     c.Name,
+			DataInfo: storage.DataInfo{Hash: n.GetHash(), Addr: usernameTo},
+		})
+	}
+	if len(batches) == 0 {
+		return errors.New("data isn't shared with the user")
+	}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	err = c.SendTransactionAndWaiting(batches, addresses, addresses)
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+	return models.DeleteDatasByHashes(hashes)
 }
 
-func (c *Client) OpenSharedDataToThirdParty(usernameFrom, usernameTo string, accessType int) error {
+// OpenSharedDataToThirdParty shares the data of patient, which is shared with the current user,
+// to the third party for the purpose. The data is skipped unless its policy is satisfied by the third party.
+// The critical data is shared only for the accepted request with the id.
+func (c *Client) OpenSharedDataToThirdParty(usernameFrom, usernameTo string, accessType int, purpose, requestID string) error {
 	err := c.Sync()
 	if err != nil {
 		return err
@@ -293,17 +808,25 @@ func (c *Client) OpenSharedDataToThirdParty(usernameFrom, usernameTo string, acc
 	if accessType == 0 || accessType > 2 {
 		return nil
 	}
+	settings, err := lib.GetSettings()
+	if err != nil {
+		return err
+	}
 	sharedDataList, err := c.ListSharedPatientData(usernameFrom)
 	if err != nil {
 		return err
 	}
+	addressFrom, userFrom, err := c.GetUser(usernameFrom)
+	if err != nil {
+		return err
+	}
 	_, userTo, err := c.GetUser(usernameTo)
 	if err != nil {
 		return err
 	}
 	batches := make([]tpPayload.StoragePayload, 0)
 	for _, sd := range sharedDataList {
-		di, data, err := c.GetSharedPatientData(sd.GetHash(), usernameFrom)
+		di, _, err := c.sharedData(sd.GetHash(), usernameFrom)
 		if err != nil {
 			return err
 		}
@@ -318,11 +841,28 @@ func (c *Client) OpenSharedDataToThirdParty(usernameFrom, usernameTo string, acc
 				continue
 			}
 		}
-		now := time.Now()
-		expiration := now.Add(5 * time.Minute)
-		dataName := fmt.Sprintf("shared_by_%s_%s", c.Name, di.Name)
-		keyAES := tpCrypto.GenerateRandomAESKey(lib.AESKeySize)
-		info, err := crypto.GenerateDataInfo(dataName, data, userTo.PublicKey, userTo.Name, tpCrypto.BytesToHex(keyAES), di.AccessType, expiration.Unix())
+		if !satisfiesPolicy(di, userTo, purpose) || !settings.AllowsAccessType(di.AccessType) {
+			continue
+		}
+		// the access of the third party expires after the emergency ttl of the network
+		var expiration int64
+		if settings.EmergencyTTL > 0 {
+			expiration = time.Now().Add(settings.EmergencyTTL).Unix()
+		}
+		renewed, ok, err := c.renewCopy(di.Hash, userTo.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if c.SendReceipts {
+			err = c.sendAccessReceipt(userFrom, di.Hash)
+			if err != nil {
+				return err
+			}
+		}
+		info, err := c.forwardCopy(di, userFrom, userTo, expiration)
 		if err != nil {
 			return err
 		}
@@ -330,18 +870,25 @@ func (c *Client) OpenSharedDataToThirdParty(usernameFrom, usernameTo string, acc
 		if err != nil {
 			return err
 		}
+		batches = append(batches, renewed...)
 		batches = append(batches, tpPayload.StoragePayload{
 			Action:   tpPayload.UserCreateData,
 			Name:     c.Name,
+			Target:   []string{userFrom.Name, userFrom.PublicKey, requestID},
 			DataInfo: info,
 		})
 	}
 
-	addresses := []string{c.GetAddress()}
-	return c.SendTransactionAndWaiting(batches, addresses, addresses)
+	// the copies are recorded in the data of the patient shared with the current user
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix(), tpState.MakeDataPrefix(userFrom.Name, userFrom.PublicKey)}
+	inputs := append(addresses, addressFrom, tpState.BlockInfoNamespace, tpState.SettingsNamespace,
+		tpState.MakeAddress(tpState.AddressTypeRequest, requestID, c.GetPublicKey()))
+	return c.SendTransactionAndWaiting(batches, inputs, addresses)
 }
 
-func (c *Client) OpenSharedDataToTrustedParty(usernameTo string) error {
+// OpenSharedDataToTrustedParty shares the data of the current user to the trusted party for the purpose.
+// The data is skipped unless its policy is satisfied by the trusted party.
+func (c *Client) OpenSharedDataToTrustedParty(usernameTo, purpose string) error {
 	err := c.Sync()
 	if err != nil {
 		return err
@@ -354,16 +901,28 @@ func (c *Client) OpenSharedDataToTrustedParty(usernameTo string) error {
 	if err != nil {
 		return err
 	}
+	proxyKeys, err := c.proxyKeys()
+	if err != nil {
+		return err
+	}
 	batches := make([]tpPayload.StoragePayload, 0)
 	for _, sd := range sharedDataList {
-		di, data, err := c.GetPatientData(sd.GetHash())
+		di, _, keyAES, err := c.patientDataKey(sd.GetHash())
 		if err != nil {
 			return err
 		}
+		if !satisfiesPolicy(di, userTo, purpose) {
+			continue
+		}
+		renewed, ok, err := c.renewCopy(di.Hash, userTo.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
 
-		dataName := fmt.Sprintf("shared_by_%s_%s", c.Name, di.Name)
-		keyAES := tpCrypto.GenerateRandomAESKey(lib.AESKeySize)
-		info, err := crypto.GenerateDataInfo(dataName, data, userTo.PublicKey, userTo.Name, tpCrypto.BytesToHex(keyAES), di.AccessType, 0)
+		info, err := c.recipientCopy(di, keyAES, userTo, 0, proxyKeys)
 		if err != nil {
 			return err
 		}
@@ -371,6 +930,7 @@ func (c *Client) OpenSharedDataToTrustedParty(usernameTo string) error {
 		if err != nil {
 			return err
 		}
+		batches = append(batches, renewed...)
 		batches = append(batches, tpPayload.StoragePayload{
 			Action:   tpPayload.UserCreateData,
 			Name:     c.Name,
@@ -378,16 +938,23 @@ func (c *Client) OpenSharedDataToTrustedParty(usernameTo string) error {
 		})
 	}
 
-	addresses := []string{c.GetAddress()}
-	return c.SendTransactionAndWaiting(batches, addresses, addresses)
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	return c.SendTransactionAndWaiting(batches, append(addresses, tpState.SettingsNamespace), addresses)
 }
 
-func (c *Client) RequestData(requestFrom, usernameFrom, accessTypeStr string) error {
+// RequestData sends the request of access to the data of patient shared with the trusted party.
+// If the trusted party is the patient itself, the current user requests access as trusted party.
+// The purpose of the request is evaluated against the policies of the data.
+func (c *Client) RequestData(requestFrom, usernameFrom, accessTypeStr, purpose string) error {
 	err := c.Sync()
 	if err != nil {
 		return err
 	}
-	_, userFrom, err := c.GetUser(usernameFrom)
+	addressFrom, userFrom, err := c.GetUser(usernameFrom)
+	if err != nil {
+		return err
+	}
+	requestFromAddress, userRequestFrom, err := c.GetUser(requestFrom)
 	if err != nil {
 		return err
 	}
@@ -398,92 +965,156 @@ func (c *Client) RequestData(requestFrom, usernameFrom, accessTypeStr string) er
 	if accessType < 0 || accessType > 2 {
 		return errors.New("invalid access type")
 	}
-	nodeMap := make(map[string]storage.INode)
-	for _, n := range userFrom.Root.Repo.INodes {
-		if n.GetAddr() != requestFrom {
-			continue
-		}
-		nodeMap[n.GetHash()] = n
+	settings, err := lib.GetSettings()
+	if err != nil {
+		return err
 	}
-
-	var requests []*models.Request
-	for hash, n := range nodeMap {
-		oid := primitive.NewObjectID()
-		requests = append(requests, &models.Request{
-			OID:          &oid,
-			Hash:         hash,
-			Name:         n.GetName(),
-			RequestFrom:  requestFrom,
-			UsernameFrom: usernameFrom,
-			UsernameTo:   c.Name,
-			Status:       models.Unset,
-			AccessType:   accessType,
-		})
+	if !settings.AllowsAccessType(uint(accessType)) {
+		return fmt.Errorf("access type %d isn't allowed", accessType)
 	}
-	ctx := context.Background()
-	if len(requests) == 0 {
-		return nil
+	err = tpPolicy.ValidateValue(purpose)
+	if err != nil {
+		return err
+	}
+	if requestFrom != usernameFrom && c.User.Role != tpUser.UserRoleResponder {
+		return errors.New("only emergency responders can request as third party")
 	}
-	_, err = models.UpsertRequests(ctx, requests)
+	datas, err := listUserData(userFrom)
 	if err != nil {
 		return err
 	}
-	return nil
+	var hashes []string
+	for _, n := range datas {
+		if n.GetAddr() != requestFrom {
+			continue
+		}
+		hashes = append(hashes, n.GetHash())
+	}
+	if len(hashes) == 0 {
+		return errors.New("no data to request")
+	}
+	req := tpRequest.NewRequest(uuid.New().String(), userRequestFrom.Name, userRequestFrom.PublicKey, usernameFrom, c.Name, c.GetPublicKey(), hashes, uint(accessType))
+	req.Purpose = purpose
+	// critical request is stored for all approvers of the patient
+	if req.IsThirdParty() && req.AccessType == storage.Critical && userFrom.ApprovalThreshold > 0 {
+		req.Approvers = userFrom.Approvers
+		req.ApproverKeys = userFrom.ApproverKeys
+		req.Threshold = userFrom.ApprovalThreshold
+		if req.Approver(req.RequestFromKey) == "" {
+			return fmt.Errorf("%s isn't approver of %s", requestFrom, usernameFrom)
+		}
+	}
+	addresses := tpState.MakeRequestAddresses(req)
+	inputs := append([]string{c.GetAddress(), requestFromAddress, addressFrom, tpState.MakeAddress(tpState.AddressTypeName, usernameFrom, ""), tpState.SettingsNamespace}, addresses...)
+	return c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action:  tpPayload.CreateRequest,
+		Name:    c.Name,
+		Request: *req,
+	}}, inputs, addresses)
 }
 
-func (c *Client) ListRequests() ([]*models.Request, error) {
-	ctx := context.Background()
-	reqs, err := models.GetRequestsByRequestFrom(ctx, []string{c.Name})
+// ListRequests lists the access requests received by the current user, which are not processed yet.
+func (c *Client) ListRequests() ([]*tpRequest.Request, error) {
+	requests, err := lib.ListRequests(c.GetPublicKey())
 	if err != nil {
 		return nil, err
 	}
-	var filtered []*models.Request
-	for _, r := range reqs {
-		if r.Status == 1 || r.Status == 2 {
+	var filtered []*tpRequest.Request
+	for _, r := range requests {
+		m := r.(map[string]interface{})
+		requestBytes, err := base64.StdEncoding.DecodeString(m["data"].(string))
+		if err != nil {
+			continue
+		}
+		req, err := tpRequest.RequestFromBytes(requestBytes)
+		if err != nil {
+			continue
+		}
+		if req.Status != tpRequest.StatusUnset {
 			continue
 		}
-		filtered = append(filtered, r)
+		filtered = append(filtered, req)
 	}
 	return filtered, nil
 }
 
-func (c *Client) ProcessRequest(oidStr string, accept bool) error {
+// ProcessRequest accepts or rejects the access request received by the current user.
+// If accepted, the data is shared with the requester after the decision is stored.
+// The multi-party request is approved by the approvers, and the data is shared only when the
+// threshold of approvals is met, otherwise ErrApprovalPending is returned after the approval is recorded.
+func (c *Client) ProcessRequest(id string, accept bool) error {
 	err := c.Sync()
 	if err != nil {
 		return err
 	}
-	oid, err := primitive.ObjectIDFromHex(oidStr)
+	address := tpState.MakeAddress(tpState.AddressTypeRequest, id, c.GetPublicKey())
+	requestBytes, err := lib.GetStateData(address)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
-	req, err := models.GetRequestByOID(ctx, &oid)
+	req, err := tpRequest.RequestFromBytes(requestBytes)
 	if err != nil {
 		return err
 	}
+	if req.Status != tpRequest.StatusUnset {
+		return errors.New("request is already processed")
+	}
+	addresses := tpState.MakeRequestAddresses(req)
+	if req.IsMultiParty() {
+		if req.RequestFromKey != c.GetPublicKey() && !accept {
+			return errors.New("only the request receiver can reject the request")
+		}
+		approved := req.HasApproved(req.Approver(c.GetPublicKey()))
+		approvals := len(req.Approvals)
+		if !approved {
+			approvals++
+		}
+		if accept && (req.RequestFromKey != c.GetPublicKey() || uint(approvals) < req.Threshold) {
+			if approved {
+				return fmt.Errorf("request is already approved, %d of %d approvals", approvals, req.Threshold)
+			}
+			err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+				Action: tpPayload.ApproveRequest,
+				Name:   c.Name,
+				Target: []string{id},
+			}}, addresses, addresses)
+			if err != nil {
+				return err
+			}
+			return ErrApprovalPending
+		}
+	}
+	requesterAddress := tpState.MakeAddress(tpState.AddressTypeUser, req.UsernameTo, req.UsernameToKey)
+	action := tpPayload.RejectRequest
 	if accept {
-		req.Status = 1
-
-		if req.UsernameFrom != c.Name {
-			err := c.OpenSharedDataToThirdParty(req.UsernameFrom, req.UsernameTo, req.AccessType)
+		action = tpPayload.AcceptRequest
+		if req.IsThirdParty() {
+			requesterBytes, err := lib.GetStateData(requesterAddress)
 			if err != nil {
 				return err
 			}
-		} else {
-			err := c.OpenSharedDataToTrustedParty(req.UsernameTo)
+			requester, err := tpUser.UserFromBytes(requesterBytes)
 			if err != nil {
 				return err
 			}
+			if requester.Role != tpUser.UserRoleResponder {
+				return errors.New("requester isn't emergency responder")
+			}
 		}
-
-	} else {
-		req.Status = 2
 	}
-	_, err = models.UpsertRequests(ctx, []*models.Request{req})
-	if err != nil {
+	// the critical data is shared only after the accepted request is committed
+	err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action: action,
+		Name:   c.Name,
+		Target: []string{id},
+	}}, append(addresses, requesterAddress), addresses)
+	if err != nil || !accept {
 		return err
 	}
-	return nil
+	if req.IsThirdParty() {
+		return c.OpenSharedDataToThirdParty(req.UsernameFrom, req.UsernameTo, int(req.AccessType), req.Purpose, id)
+	}
+	return c.OpenSharedDataToTrustedParty(req.UsernameTo, req.Purpose)
 }
 
 func (c *Client) BatchUpload(path string) ([]error, error) {
@@ -499,17 +1130,18 @@ func (c *Client) BatchUpload(path string) ([]error, error) {
 		return nil, errors.New("no data in csv")
 	}
 
-	var trustedPartyColIdx, accessColIdx *int
+	var trustedPartyColIdx, accessColIdx, categoryColIdx, nameColIdx *int
 	for id, colName := range records[0] {
 		copiedId := id
-		if colName == "trusted_party" {
+		switch colName {
+		case "trusted_party":
 			trustedPartyColIdx = &copiedId
-		}
-		if colName == "access_type" {
+		case "access_type":
 			accessColIdx = &copiedId
-		}
-		if trustedPartyColIdx != nil && accessColIdx != nil {
-			break
+		case "category":
+			categoryColIdx = &copiedId
+		case "record_name":
+			nameColIdx = &copiedId
 		}
 	}
 	columnLen := len(records[0])
@@ -535,9 +1167,44 @@ func (c *Client) BatchUpload(path string) ([]error, error) {
 		if trustedPartyColIdx != nil {
 			trustedParties = strings.Split(row[*trustedPartyColIdx], " ")
 		}
+		// the row of the category is a single record, which properties are the columns
+		if categoryColIdx != nil && row[*categoryColIdx] != "" {
+			category := row[*categoryColIdx]
+			fields := make(map[string]string)
+			for idcol, col := range row {
+				switch records[0][idcol] {
+				case "access_type", "trusted_party", "category", "record_name":
+					continue
+				}
+				fields[records[0][idcol]] = col
+			}
+			data, err := schema.FromFields(category, fields)
+			if err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("csv row %d: invalid %s record: %s", id+2, category, err)))
+				continue
+			}
+			name := category
+			if nameColIdx != nil && row[*nameColIdx] != "" {
+				name = row[*nameColIdx]
+			}
+			di, err := c.CreatePatientData(name, data, uint(accessType), category)
+			if err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("csv row %d: failed to save data: %s", id+2, err)))
+				continue
+			}
+			for _, tp := range trustedParties {
+				err = c.ShareData(di.Hash, tp)
+				if err != nil {
+					errs = append(errs, errors.New(fmt.Sprintf("csv row %d: failed to share with trusted party %s: %s", id+2, tp, err)))
+					continue
+				}
+				fmt.Printf("sharing data with %s \n", tp)
+			}
+			continue
+		}
 		for idcol, col := range row {
 			columnName := records[0][idcol]
-			if columnName == "access_type" || columnName == "trusted_party" {
+			if columnName == "access_type" || columnName == "trusted_party" || columnName == "category" || columnName == "record_name" {
 				continue
 			}
 			if len(col) == 0 {
@@ -545,7 +1212,7 @@ func (c *Client) BatchUpload(path string) ([]error, error) {
 				continue
 			}
 
-			di, err := c.CreatePatientData(columnName, col, uint(accessType))
+			di, err := c.CreatePatientData(columnName, col, uint(accessType), "")
 			if err != nil {
 				errs = append(errs, errors.New(fmt.Sprintf("csv row %d col %d: failed to save data: %s", id+2, idcol+1, err)))
 				continue
@@ -564,22 +1231,112 @@ func (c *Client) BatchUpload(path string) ([]error, error) {
 	return errs, nil
 }
 
-// GetUser get current user data
-func (c *Client) GetUser(username string) (string, *tpUser.User, error) {
-	err := c.Sync()
+// SetDataPolicy sets the access policy of the data owned by the current user and of its shared copies.
+// The empty policy allows any access.
+func (c *Client) SetDataPolicy(hash, p string) error {
+	err := tpPolicy.Validate(p)
+	if err != nil {
+		return err
+	}
+	err = c.Sync()
+	if err != nil {
+		return err
+	}
+	di, err := c.User.Root.GetData(hash, c.User.Name)
+	if err != nil {
+		return err
+	}
+	if di == nil {
+		return errors.New("data doesn't exist")
+	}
+	batches := []tpPayload.StoragePayload{{
+		Action:   tpPayload.UserSetPolicy,
+		Name:     c.Name,
+		DataInfo: storage.DataInfo{Hash: di.Hash, Addr: di.Addr, Policy: p},
+	}}
+	for _, n := range c.sharedCopies(di) {
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserSetPolicy,
+			Name:     c.Name,
+			DataInfo: storage.DataInfo{Hash: n.GetHash(), Addr: n.GetAddr(), Policy: p},
+		})
+	}
+	addresses := []string{c.GetAddress(), c.GetRecordPrefix()}
+	return c.SendTransactionAndWaiting(batches, addresses, addresses)
+}
+
+// satisfiesPolicy reports whether the policy of the data is satisfied by the user for the purpose.
+func satisfiesPolicy(di *storage.DataInfo, u *tpUser.User, purpose string) bool {
+	ok, err := tpPolicy.Evaluate(di.Policy, map[string]string{
+		tpPolicy.AttrRole:    u.Role.String(),
+		tpPolicy.AttrPurpose: purpose,
+		tpPolicy.AttrOrg:     u.Organization,
+	})
 	if err != nil {
-		return "", nil, err
+		lib.Logger.Warnf("invalid policy of data %s: %v", di.Hash, err)
+		return false
+	}
+	return ok
+}
+
+// sharedCopies returns the copies shared by the current user from the data.
+func (c *Client) sharedCopies(di *storage.DataInfo) []storage.INode {
+	// data shared before the source was stored is matched by its name
+	dataName := fmt.Sprintf("shared_by_%s_%s", c.Name, di.Name)
+	var shared []storage.INode
+	for _, n := range c.User.Root.Repo.INodes {
+		if n.GetAddr() == c.User.Name {
+			continue
+		}
+		if n.GetSource() != di.Hash && (n.GetSource() != "" || n.GetName() != dataName) {
+			continue
+		}
+		shared = append(shared, n)
+	}
+	return shared
+}
+
+// GetUser get the user data by username, which is resolved through the name registry.
+// Users created before the name registry are found by scanning every user,
+// and the username must be unique among them.
+func (c *Client) GetUser(username string) (string, *tpUser.User, error) {
+	nameBytes, err := lib.GetStateData(tpState.MakeAddress(tpState.AddressTypeName, username, ""))
+	if err == nil {
+		n, err := tpUser.NameFromBytes(nameBytes)
+		if err != nil {
+			return "", nil, err
+		}
+		address := tpState.MakeAddress(tpState.AddressTypeUser, n.Name, n.PublicKey)
+		userBytes, err := lib.GetStateData(address)
+		if err != nil {
+			return "", nil, errors.New("failed to get user")
+		}
+		u, err := tpUser.UserFromBytes(userBytes)
+		if err != nil {
+			return "", nil, err
+		}
+		c.QueryCache[address] = u
+		return address, u, nil
 	}
 	err = c.ListUsers()
 	if err != nil {
 		return "", nil, errors.New("failed to get user")
 	}
+	var address string
+	var user *tpUser.User
 	for a, u := range c.QueryCache {
-		if u.Name == username {
-			return a, u, nil
+		if u.Name != username {
+			continue
+		}
+		if user != nil {
+			return "", nil, errors.New("username is ambiguous")
 		}
+		address, user = a, u
 	}
-	return "", nil, errors.New("no such user")
+	if user == nil {
+		return "", nil, errors.New("no such user")
+	}
+	return address, user, nil
 }
 
 // ListUsers get the query cache for list shared files.
@@ -588,14 +1345,13 @@ func (c *Client) ListUsers() error {
 	if err != nil {
 		return err
 	}
-	limit := 10000
-	users, err := lib.ListUsers(c.lastQueryEnd, uint(limit))
+	users, err := lib.ListUsers()
 	if err != nil {
 		return err
 	}
 
-	for i := 1; i < len(users); i++ {
-		m := users[i].(map[string]interface{})
+	for _, entry := range users {
+		m := entry.(map[string]interface{})
 		userBytes, err := base64.StdEncoding.DecodeString(m["data"].(string))
 		if err != nil {
 			continue
@@ -610,6 +1366,106 @@ func (c *Client) ListUsers() error {
 	return nil
 }
 
+// UpdateUserRole updates the role and the organization of the user, which only the admin can do.
+func (c *Client) UpdateUserRole(username string, role tpUser.UserRole, organization string) error {
+	address, u, err := c.GetUser(username)
+	if err != nil {
+		return err
+	}
+	target := []string{u.Name, u.PublicKey}
+	if organization != "" {
+		target = append(target, organization)
+	}
+	err = c.SendTransactionAndWaitingForBatch([]tpPayload.StoragePayload{{
+		Action: tpPayload.UpdateUserRole,
+		Name:   c.Name,
+		Target: target,
+		Role:   uint(role),
+	}}, []string{address, tpState.MakeSettingAddress(tpState.SettingAdmins)}, []string{address})
+	if err != nil {
+		return err
+	}
+	delete(c.QueryCache, address)
+	return nil
+}
+
+// ClaimLegacyNames claims the usernames of the users created before the name registry, which only the admin can do.
+// It returns the claimed usernames, and the usernames shared by several legacy users, which aren't claimed.
+func (c *Client) ClaimLegacyNames() ([]string, []string, error) {
+	err := c.ListUsers()
+	if err != nil {
+		return nil, nil, err
+	}
+	users := make(map[string][]*tpUser.User)
+	for _, u := range c.QueryCache {
+		users[u.Name] = append(users[u.Name], u)
+	}
+	var claimed, ambiguous []string
+	var batches []tpPayload.StoragePayload
+	inputs := []string{tpState.MakeSettingAddress(tpState.SettingAdmins)}
+	var outputs []string
+	for name, us := range users {
+		address := tpState.MakeAddress(tpState.AddressTypeName, name, "")
+		if _, err := lib.GetStateData(address); err == nil {
+			continue
+		}
+		if len(us) > 1 {
+			ambiguous = append(ambiguous, name)
+			continue
+		}
+		claimed = append(claimed, name)
+		batches = append(batches, tpPayload.StoragePayload{
+			Action: tpPayload.ClaimLegacyName,
+			Name:   c.Name,
+			Target: []string{name, us[0].PublicKey},
+		})
+		inputs = append(inputs, address, tpState.MakeAddress(tpState.AddressTypeUser, name, us[0].PublicKey))
+		outputs = append(outputs, address)
+	}
+	if len(batches) == 0 {
+		return nil, ambiguous, nil
+	}
+	return claimed, ambiguous, c.SendTransactionAndWaitingForBatch(batches, inputs, outputs)
+}
+
+// PruneExpiredData removes the expired data of the user from the blockchain.
+// If the username is empty, the expired data of the current user is removed.
+func (c *Client) PruneExpiredData(username string) error {
+	err := c.Sync()
+	if err != nil {
+		return err
+	}
+	address, u := c.GetAddress(), c.User
+	if username != "" && username != c.Name {
+		address, u, err = c.GetUser(username)
+		if err != nil {
+			return err
+		}
+	}
+	datas, err := listUserData(u)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	batches := make([]tpPayload.StoragePayload, 0)
+	for _, d := range datas {
+		if !d.IsExpired(now) {
+			continue
+		}
+		batches = append(batches, tpPayload.StoragePayload{
+			Action:   tpPayload.UserPruneData,
+			Name:     u.Name,
+			Target:   []string{u.PublicKey},
+			DataInfo: storage.DataInfo{Hash: d.Hash, Addr: d.Addr},
+		})
+	}
+	if len(batches) == 0 {
+		return errors.New("no expired data")
+	}
+	addresses := []string{address, tpState.MakeRecordPrefix(u.Name, u.PublicKey)}
+	return c.SendTransactionAndWaitingForBatch(batches, append(addresses, tpState.BlockInfoNamespace), addresses)
+}
+
 func (c *Client) RemovedExpiredData() error {
 	ctx := context.Background()
 	now := time.Now().Unix()
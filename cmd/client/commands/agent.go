@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"healthcare-system-sawtooth/client/lib"
+)
+
+// The address the key agent listens on
+var agentAddress string
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run the key agent of identity",
+	Long: `Run the key agent, which signs transactions and decrypts data keys by the private key of identity,
+so the user command given the address of the agent as the key never holds the private key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		lib.Passphrase = readKeystorePassphrase
+		keys, err := lib.LoadKeyProvider(getKeyFile())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		address := agentAddress
+		if address == "" {
+			address = "unix://" + path.Join(lib.DefaultKeyPath, "agent", name+".sock")
+		}
+		listener, err := lib.ListenKeyAgent(address)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		// the listener is closed on interrupt, so the socket is removed
+		sig := make(chan os.Signal, 1)
+		stopped := make(chan struct{})
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			close(stopped)
+			listener.Close()
+		}()
+		fmt.Printf("Key agent of %s is listening on %s\n", keys.PublicKey(), address)
+		err = http.Serve(listener, lib.NewKeyAgentHandler(keys))
+		select {
+		case <-stopped:
+		default:
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().StringVarP(&agentAddress, "listen", "l", "", "the address of the key agent, unix:///path/to/agent.sock, in the directory accessible by the owner only")
+}
@@ -1,6 +1,9 @@
 package commands
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"healthcare-system-sawtooth/client/lib"
 )
@@ -9,10 +12,19 @@ import (
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generate key for identity",
-	Long:  `Generate private and public key for identity of sawtooth blockchain.`,
+	Long: `Generate private and public key for identity of sawtooth blockchain.
+The private key is stored in the keystore encrypted by the passphrase.`,
 	Run: func(cmd *cobra.Command, args []string) {
-
-		lib.GenerateKey(name, lib.DefaultKeyPath)
+		passphrase, err := readPassphrase(true)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		err = lib.GenerateKeystore(name, lib.DefaultKeyPath, passphrase)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	},
 }
 
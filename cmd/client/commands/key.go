@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"healthcare-system-sawtooth/client/lib"
+)
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the keystore of identity",
+	Long:  `Import the private key into the encrypted keystore, or export it from the keystore.`,
+}
+
+// keyImportCmd represents the key import command
+var keyImportCmd = &cobra.Command{
+	Use:   "import <private_key_file>",
+	Short: "Import the private key into the keystore",
+	Long: `Import the private key of plain hex from the file into the new keystore encrypted by the passphrase.
+The keystore is stored in the key file, or named as the user in the key path.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		privateKeyHex, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		passphrase, err := readPassphrase(true)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		err = lib.ImportKey(getKeyFile(), string(privateKeyHex), passphrase)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// keyExportCmd represents the key export command
+var keyExportCmd = &cobra.Command{
+	Use:   "export [<private_key_file>]",
+	Short: "Export the private key from the keystore",
+	Long: `Export the private key from the keystore as plain hex into the file, or print it if the file isn't given.
+The exported private key isn't protected, so it must be kept safe.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase, err := readPassphrase(false)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		privateKeyHex, err := lib.ExportKey(getKeyFile(), passphrase)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			fmt.Println(privateKeyHex)
+			return
+		}
+		err = ioutil.WriteFile(args[0], []byte(privateKeyHex), 0600)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	keyCmd.AddCommand(keyImportCmd)
+	keyCmd.AddCommand(keyExportCmd)
+	rootCmd.AddCommand(keyCmd)
+}
+
+// getKeyFile returns the key file given by the flag, or the key file named as the user in the key path.
+func getKeyFile() string {
+	if lib.PrivateKeyFile != "" {
+		return lib.PrivateKeyFile
+	}
+	return path.Join(lib.DefaultKeyPath, name+".priv")
+}
+
+// readKeystorePassphrase prompts for the passphrase when the key file is loaded.
+// The new passphrase is read only when the legacy key file is upgraded to the keystore.
+func readKeystorePassphrase(isNew bool) ([]byte, error) {
+	if isNew {
+		fmt.Printf("Upgrading the private key %s to the encrypted keystore.\n", getKeyFile())
+	}
+	return readPassphrase(isNew)
+}
+
+// readPassphrase prompts for the passphrase of the keystore. The new passphrase is entered twice.
+func readPassphrase(isNew bool) ([]byte, error) {
+	label := "Passphrase"
+	if isNew {
+		label = "New passphrase"
+	}
+	prompt := promptui.Prompt{Label: label, Mask: '*', Templates: commandTemplates}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	if isNew {
+		if passphrase == "" {
+			return nil, lib.ErrEmptyPassphrase
+		}
+		prompt = promptui.Prompt{Label: "Repeat passphrase", Mask: '*', Templates: commandTemplates}
+		repeated, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+		if repeated != passphrase {
+			return nil, errors.New("passphrases don't match")
+		}
+	}
+	return []byte(passphrase), nil
+}
@@ -6,12 +6,19 @@ import (
 	"fmt"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
-	"healthcare-system-sawtooth/client/db/models"
 	"healthcare-system-sawtooth/client/lib"
 	"healthcare-system-sawtooth/client/user"
+	tpAudit "healthcare-system-sawtooth/tp/audit"
+	tpDelegation "healthcare-system-sawtooth/tp/delegation"
+	tpEvent "healthcare-system-sawtooth/tp/event"
+	tpReKey "healthcare-system-sawtooth/tp/rekey"
+	tpRequest "healthcare-system-sawtooth/tp/request"
 	tpStorage "healthcare-system-sawtooth/tp/storage"
+	tpUser "healthcare-system-sawtooth/tp/user"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var userCommands = []string{
@@ -19,17 +26,44 @@ var userCommands = []string{
 	"sync",
 	"whoami",
 	"create",
+	"update",
+	"history",
 	"share",
+	"revoke",
+	"policy",
+	"delete",
 	"ls",
 	"ls-users",
 	"ls-shared",
 	"get",
 	"get-shared",
+	"upload",
+	"download",
 	"request-as-third-party",
 	"request-as-trusted-party",
 	"list-requests",
 	"process-request",
+	"approvers",
 	"batch-upload",
+	"prune",
+	"audit",
+	"verify",
+	"settings",
+	"role",
+	"claim-names",
+	"delegate",
+	"undelegate",
+	"delegations",
+	"act-as",
+	"rekey",
+	"unrekey",
+	"rekeys",
+	"create-group",
+	"group-info",
+	"group-add",
+	"group-remove",
+	"group-role",
+	"group-leader",
 	"exit",
 }
 
@@ -38,6 +72,9 @@ var (
 	errInvalidPath    = errors.New("invalid path")
 )
 
+// Submit the access receipt when the shared data is read
+var sendReceipts bool
+
 // userCmd represents the user command
 var userCmd = &cobra.Command{
 	Use:   "user",
@@ -49,11 +86,17 @@ communicating with the transaction processor.`,
 			fmt.Println(errors.New("the name of user is required"))
 			os.Exit(0)
 		}
+		// the keystore is decrypted by the passphrase, and the legacy key file is upgraded to the keystore
+		lib.Passphrase = readKeystorePassphrase
 		cli, err := user.NewUserClient(name, lib.PrivateKeyFile)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		cli.SendReceipts = sendReceipts
+		for _, eventType := range tpEvent.NotificationTypes {
+			cli.Subscribe(eventType, printNotification)
+		}
 		if cli.User != nil {
 			fmt.Println("Already register.")
 		} else {
@@ -64,8 +107,12 @@ communicating with the transaction processor.`,
 		}
 		defer cli.Close()
 		for {
+			label := name
+			if cli.IsActing() {
+				label = name + " as " + cli.Name
+			}
 			prompt := promptui.Prompt{
-				Label:     name + " ",
+				Label:     label + " ",
 				Templates: commandTemplates,
 				Validate: func(s string) error {
 					commands := strings.Fields(s)
@@ -135,14 +182,48 @@ communicating with the transaction processor.`,
 			case "create":
 				if len(commands) < 3 {
 					fmt.Println(errMissingOperand)
-				} else if len(commands) > 3 {
+				} else if len(commands) > 4 {
 					fmt.Println(errInvalidPath)
 				} else {
-					_, err = cli.CreatePatientData(commands[1], commands[2], 0)
+					category := ""
+					if len(commands) == 4 {
+						category = commands[3]
+					}
+					_, err = cli.CreatePatientData(commands[1], commands[2], 0, category)
 					if err != nil {
 						fmt.Println(err)
 					}
 				}
+			case "update":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					var followShares bool
+					if len(commands) == 4 && commands[3] == "true" {
+						followShares = true
+					}
+					_, err = cli.UpdatePatientData(commands[1], commands[2], followShares)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "history":
+				if len(commands) < 2 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else {
+					infos, datas, err := cli.GetPatientDataHistory(commands[1])
+					if err != nil {
+						fmt.Println(err)
+					} else {
+						for i, di := range infos {
+							fmt.Printf("Version: %d Hash: %s\n%s\n", di.Version, di.Hash, datas[i])
+						}
+					}
+				}
 			case "share":
 				if len(commands) < 3 {
 					fmt.Println(errMissingOperand)
@@ -154,6 +235,38 @@ communicating with the transaction processor.`,
 						fmt.Println(err)
 					}
 				}
+			case "revoke":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 3 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err = cli.RevokeData(commands[1], commands[2])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "policy":
+				if len(commands) < 2 {
+					fmt.Println(errMissingOperand)
+				} else {
+					// the policy is the rest of the command, and the empty policy allows any access
+					err = cli.SetDataPolicy(commands[1], strings.Join(commands[2:], " "))
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "delete":
+				if len(commands) < 2 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err = cli.DeletePatientData(commands[1])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
 			case "get":
 				if len(commands) < 2 {
 					fmt.Println(errMissingOperand)
@@ -168,7 +281,16 @@ communicating with the transaction processor.`,
 					}
 				}
 			case "ls":
-				iNodes, err := cli.ListPatientData()
+				if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+					continue
+				}
+				var iNodes []tpStorage.INode
+				if len(commands) == 2 {
+					iNodes, err = cli.ListPatientDataByCategory(commands[1])
+				} else {
+					iNodes, err = cli.ListPatientData()
+				}
 				if err != nil {
 					fmt.Println(err)
 				} else {
@@ -190,6 +312,40 @@ communicating with the transaction processor.`,
 						fmt.Println(data)
 					}
 				}
+			case "upload":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					accessType := 0
+					if len(commands) == 4 {
+						accessType, err = strconv.Atoi(commands[3])
+						if err != nil || accessType < 0 {
+							fmt.Println("invalid access type")
+							continue
+						}
+					}
+					err = uploadFile(cli, commands[1], commands[2], uint(accessType))
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "download":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					username := ""
+					if len(commands) == 4 {
+						username = commands[3]
+					}
+					err = downloadFile(cli, commands[1], commands[2], username)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
 			case "ls-shared":
 				if len(commands) < 2 {
 					fmt.Println(errMissingOperand)
@@ -208,10 +364,14 @@ communicating with the transaction processor.`,
 			case "request-as-third-party":
 				if len(commands) < 4 {
 					fmt.Println(errMissingOperand)
-				} else if len(commands) > 4 {
+				} else if len(commands) > 5 {
 					fmt.Println(errInvalidPath)
 				} else {
-					err := cli.RequestData(commands[1], commands[2], commands[3])
+					purpose := ""
+					if len(commands) == 5 {
+						purpose = commands[4]
+					}
+					err := cli.RequestData(commands[1], commands[2], commands[3], purpose)
 					if err != nil {
 						fmt.Println(err)
 					}
@@ -219,10 +379,14 @@ communicating with the transaction processor.`,
 			case "request-as-trusted-party":
 				if len(commands) < 2 {
 					fmt.Println(errMissingOperand)
-				} else if len(commands) > 2 {
+				} else if len(commands) > 3 {
 					fmt.Println(errInvalidPath)
 				} else {
-					err := cli.RequestData(commands[1], commands[1], "0")
+					purpose := ""
+					if len(commands) == 3 {
+						purpose = commands[2]
+					}
+					err := cli.RequestData(commands[1], commands[1], "0", purpose)
 					if err != nil {
 						fmt.Println(err)
 					}
@@ -251,6 +415,27 @@ communicating with the transaction processor.`,
 						fmt.Println(err)
 					}
 				}
+			case "approvers":
+				if len(commands) == 1 {
+					approvers, threshold, err := cli.GetApprovers()
+					if err != nil {
+						fmt.Println(err)
+					} else if threshold == 0 {
+						fmt.Println("Critical requests are approved by single trusted party.")
+					} else {
+						fmt.Printf("Critical requests need %d approvals of: %s\n", threshold, strings.Join(approvers, ", "))
+					}
+					continue
+				}
+				threshold, err := strconv.Atoi(commands[1])
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				err = cli.SetApprovers(threshold, commands[2:])
+				if err != nil {
+					fmt.Println(err)
+				}
 			case "batch-upload":
 				if len(commands) < 2 {
 					fmt.Println(errMissingOperand)
@@ -266,6 +451,252 @@ communicating with the transaction processor.`,
 						fmt.Println(err)
 					}
 				}
+			case "prune":
+				if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else {
+					var username string
+					if len(commands) == 2 {
+						username = commands[1]
+					}
+					err := cli.PruneExpiredData(username)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "audit":
+				receipts, err := cli.ListAuditLog()
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					for _, r := range receipts {
+						printReceipt(r)
+					}
+				}
+			case "delegate":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 5 {
+					fmt.Println(errInvalidPath)
+				} else {
+					var scopes []string
+					if len(commands) >= 4 && commands[3] != "all" {
+						scopes = strings.Split(commands[3], ",")
+					}
+					var expiration int64
+					if len(commands) == 5 {
+						duration, err := time.ParseDuration(commands[4])
+						if err != nil {
+							fmt.Println(err)
+							continue
+						}
+						expiration = time.Now().Add(duration).Unix()
+					}
+					err = cli.GrantDelegation(commands[1], commands[2], scopes, expiration)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "undelegate":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 3 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err = cli.RevokeDelegation(commands[1], commands[2])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "delegations":
+				if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+					continue
+				}
+				patient := cli.Name
+				if len(commands) == 2 {
+					patient = commands[1]
+				}
+				delegations, err := cli.ListDelegations(patient)
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					for _, d := range delegations {
+						printDelegation(d)
+					}
+				}
+			case "rekey":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					var expiration int64
+					if len(commands) == 4 {
+						duration, err := time.ParseDuration(commands[3])
+						if err != nil {
+							fmt.Println(err)
+							continue
+						}
+						expiration = time.Now().Add(duration).Unix()
+					}
+					err = cli.GrantReKey(commands[1], commands[2], expiration)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "unrekey":
+				if len(commands) < 4 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err = cli.RevokeReKey(commands[1], commands[2], commands[3])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "rekeys":
+				if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+					continue
+				}
+				patient := cli.Name
+				if len(commands) == 2 {
+					patient = commands[1]
+				}
+				reKeys, err := cli.ListReKeys(patient)
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					for _, k := range reKeys {
+						printReKey(k)
+					}
+				}
+			case "verify":
+				checked, violations, err := cli.VerifyData()
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				for _, v := range violations {
+					fmt.Printf("%s of %s: %v\n", v.Name, v.Owner, v.Err)
+				}
+				fmt.Printf("Checked %d data, %d integrity violations.\n", checked, len(violations))
+			case "settings":
+				settings, err := lib.LoadSettings()
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					printSettings(settings)
+				}
+			case "act-as":
+				if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else if len(commands) == 2 {
+					err = cli.ActAs(commands[1])
+				} else {
+					err = cli.StopActing()
+				}
+				if err != nil {
+					fmt.Println(err)
+				}
+			case "role":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					role, err := strconv.Atoi(commands[2])
+					if err != nil {
+						fmt.Println(err)
+						continue
+					}
+					organization := ""
+					if len(commands) == 4 {
+						organization = commands[3]
+					}
+					err = cli.UpdateUserRole(commands[1], tpUser.UserRole(role), organization)
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "claim-names":
+				claimed, ambiguous, err := cli.ClaimLegacyNames()
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				fmt.Println("claimed:", strings.Join(claimed, " "))
+				if len(ambiguous) > 0 {
+					fmt.Println("ambiguous, not claimed:", strings.Join(ambiguous, " "))
+				}
+			case "create-group":
+				if len(commands) < 2 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err := cli.CreateGroup(commands[1])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "group-info":
+				if len(commands) < 2 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 2 {
+					fmt.Println(errInvalidPath)
+				} else {
+					g, err := cli.GetGroup(commands[1])
+					if err != nil {
+						fmt.Println(err)
+					} else {
+						printGroup(g)
+					}
+				}
+			case "group-add", "group-role":
+				if len(commands) < 4 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 4 {
+					fmt.Println(errInvalidPath)
+				} else {
+					role, err := strconv.Atoi(commands[3])
+					if err != nil {
+						fmt.Println(err)
+						continue
+					}
+					if commands[0] == "group-add" {
+						err = cli.AddGroupMember(commands[1], commands[2], tpUser.Role(role))
+					} else {
+						err = cli.UpdateGroupMemberRole(commands[1], commands[2], tpUser.Role(role))
+					}
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "group-remove":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 3 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err := cli.RemoveGroupMember(commands[1], commands[2])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
+			case "group-leader":
+				if len(commands) < 3 {
+					fmt.Println(errMissingOperand)
+				} else if len(commands) > 3 {
+					fmt.Println(errInvalidPath)
+				} else {
+					err := cli.TransferGroupLeadership(commands[1], commands[2])
+					if err != nil {
+						fmt.Println(err)
+					}
+				}
 			}
 
 		}
@@ -273,10 +704,47 @@ communicating with the transaction processor.`,
 }
 
 func init() {
+	userCmd.Flags().BoolVar(&sendReceipts, "receipts", true, "submit the access receipt to the audit log when the shared data is read")
 	rootCmd.AddCommand(userCmd)
 }
 
 // printINode display the information of iNode.
+// uploadFile uploads the file as the chunked stream, and prints the hash of the data created.
+func uploadFile(cli *user.Client, name, path string, accessType uint) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := cli.UploadPatientData(name, f, accessType)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Name: %s Hash: %s Size: %d\n", info.Name, info.Hash, info.Size)
+	return nil
+}
+
+// downloadFile writes the data owned by the current user, or shared by the username, to the file.
+// The file is removed if the data fails to be decrypted or verified.
+func downloadFile(cli *user.Client, hash, path, username string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		_, err = cli.DownloadPatientData(hash, f)
+	} else {
+		_, err = cli.DownloadSharedPatientData(hash, username, f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
 func printINode(iNode tpStorage.INode) {
 	data, err := json.MarshalIndent(iNode, "", "\t")
 	if err != nil {
@@ -286,11 +754,92 @@ func printINode(iNode tpStorage.INode) {
 	}
 }
 
-func printRequest(req *models.Request) {
+// printRequest display the information of access request.
+func printRequest(req *tpRequest.Request) {
 	data, err := json.MarshalIndent(req, "", "\t")
 	if err != nil {
 		fmt.Println(err)
 	} else {
 		fmt.Println(string(data))
 	}
+	if req.IsMultiParty() {
+		fmt.Printf("Approved by %d of %d required approvers: %s\n", len(req.Approvals), req.Threshold, strings.Join(req.Approvals, ", "))
+	}
+}
+
+// printReceipt display the receipt of access in the audit log.
+func printReceipt(r *tpAudit.Receipt) {
+	fmt.Printf("%s\t%s read %s (%s) shared by %s, access type %d\n",
+		time.Unix(r.Timestamp, 0).Format(time.RFC3339), r.Reader, r.Name, r.Hash, r.Owner, r.AccessType)
+}
+
+// printDelegation display the delegation of patient.
+func printDelegation(d *tpDelegation.Delegation) {
+	scopes := "all"
+	if len(d.Scopes) > 0 {
+		scopes = strings.Join(d.Scopes, ",")
+	}
+	expiration := "never"
+	if d.Expiration != 0 {
+		expiration = time.Unix(d.Expiration, 0).Format(time.RFC3339)
+	}
+	fmt.Printf("%s delegates %s to %s, expires %s\n", d.Patient, scopes, d.Delegate, expiration)
+}
+
+// printReKey display the re-encryption key of patient.
+func printReKey(k *tpReKey.ReKey) {
+	expiration := "never"
+	if k.Expiration != 0 {
+		expiration = time.Unix(k.Expiration, 0).Format(time.RFC3339)
+	}
+	fmt.Printf("%s allows %s to forward data to %s, expires %s\n", k.Patient, k.Proxy, k.Recipient, expiration)
+}
+
+// printSettings display the settings of the network.
+func printSettings(s *lib.Settings) {
+	limit := func(v int64) string {
+		if v == 0 {
+			return "unlimited"
+		}
+		return strconv.FormatInt(v, 10)
+	}
+	ttl := "unlimited"
+	if s.EmergencyTTL > 0 {
+		ttl = s.EmergencyTTL.String()
+	}
+	fmt.Println("Emergency access ttl:", ttl)
+	fmt.Println("Allowed access types:", s.AccessTypes)
+	fmt.Println("Max data per user:", limit(s.MaxRecords))
+	fmt.Println("Max data size:", limit(s.MaxDataSize))
+	fmt.Println("Max size per user:", limit(s.MaxUserSize))
+}
+
+// printGroup display the information of group.
+func printGroup(g *tpUser.Group) {
+	data, err := json.MarshalIndent(g, "", "\t")
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(string(data))
+	}
+}
+
+// printNotification display the event notified to the user.
+func printNotification(eventType string, attributes map[string]string) {
+	switch eventType {
+	case tpEvent.DataShared:
+		fmt.Printf("\n%s shared data with you: %s\n", attributes[tpEvent.AttrOwner], attributes[tpEvent.AttrHash])
+	case tpEvent.DataRevoked:
+		fmt.Printf("\n%s revoked data shared with you: %s\n", attributes[tpEvent.AttrOwner], attributes[tpEvent.AttrHash])
+	case tpEvent.RequestCreated:
+		fmt.Printf("\n%s sent you the access request: %s\n", attributes[tpEvent.AttrOwner], attributes[tpEvent.AttrRequestID])
+	case tpEvent.RequestProcessed:
+		status := "rejected"
+		if attributes[tpEvent.AttrStatus] == strconv.Itoa(int(tpRequest.StatusAccepted)) {
+			status = "accepted"
+		}
+		fmt.Printf("\n%s %s your access request: %s\n", attributes[tpEvent.AttrOwner], status, attributes[tpEvent.AttrRequestID])
+	case tpEvent.RequestApproved:
+		fmt.Printf("\n%s approved the access request: %s\n", attributes[tpEvent.AttrOwner], attributes[tpEvent.AttrRequestID])
+	}
 }
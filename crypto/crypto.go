@@ -75,11 +75,17 @@ func GenerateRandomAESKey(len int) []byte {
 }
 
 // Convert between Hex and Bytes
+// The invalid hex is converted to nil, use DecodeHex to check it.
 func HexToBytes(str string) []byte {
 	data, _ := hex.DecodeString(str)
 	return data
 }
 
+// DecodeHex converts the hex to bytes, and reports the invalid hex.
+func DecodeHex(str string) ([]byte, error) {
+	return hex.DecodeString(str)
+}
+
 func BytesToHex(data []byte) string {
 	return hex.EncodeToString(data)
 }
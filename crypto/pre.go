@@ -0,0 +1,305 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	ellcurv "github.com/btcsuite/btcd/btcec"
+)
+
+// Proxy re-encryption on secp256k1, following the key encapsulation of Umbral without threshold.
+// The data is encrypted for the delegator by the key derived from the capsule, the delegator issues
+// the re-encryption key to the delegatee, and the proxy holding it converts the capsule for the delegatee,
+// learning neither the key nor the data. The proxy colluding with the delegatee can recover the private key
+// of the delegator, so the re-encryption key is only given to the trusted proxy.
+//
+// The delegator encrypts the data for the proxy key, the separate key pair derived from its private key
+// by ProxyKeyPair, so the collusion recovers the proxy key but not the private key signing the transactions.
+//
+// The ciphertext is the magic "pre", the type, the capsule, the nonce and the data sealed by AES-256-GCM
+// with the capsule as the associated data:
+//
+//	type 1: E, V (compressed points), s (32 bytes)
+//	type 2: E, V, s of the original capsule, then E', V', X (compressed points) of the re-encryption
+var proxyMagic = []byte("pre")
+
+const (
+	proxyTypeCapsule     byte = 1
+	proxyTypeReEncrypted byte = 2
+
+	pointSize   = 33
+	scalarSize  = 32
+	capsuleSize = 2*pointSize + scalarSize
+	reKeySize   = scalarSize + pointSize
+	nonceSize   = 12
+)
+
+// Errors of proxy re-encryption
+var (
+	ErrInvalidProxyCiphertext = errors.New("invalid proxy re-encryption ciphertext")
+	ErrInvalidReEncryptionKey = errors.New("invalid re-encryption key")
+	ErrInvalidPrivateKey      = errors.New("invalid private key")
+)
+
+// ProxyKeyPair derives the proxy key pair of the private key, hex encoded. The data is encrypted by ProxyEncryption
+// for the proxy public key, and the re-encryption key is issued by the proxy private key.
+func ProxyKeyPair(privateKey string) (string, string, error) {
+	a, err := parsePrivateScalar(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+	k := hashToScalar([]byte("proxy-key"), scalarBytes(a))
+	return BytesToHex(scalarBytes(k)), BytesToHex(scalarBaseMult(k).SerializeCompressed()), nil
+}
+
+// IsProxyCiphertext reports whether the data, hex encoded, is encrypted by ProxyEncryption or ProxyReEncryption.
+func IsProxyCiphertext(data string) bool {
+	b, err := DecodeHex(data)
+	return err == nil && len(b) > len(proxyMagic) && bytes.HasPrefix(b, proxyMagic)
+}
+
+// ProxyEncryption encrypts the data, hex encoded, for the public key, so that it can be re-encrypted by the proxy.
+func ProxyEncryption(publicKey, data string) ([]byte, error) {
+	pub, err := ellcurv.ParsePubKey(HexToBytes(publicKey), ellcurv.S256())
+	if err != nil {
+		return nil, err
+	}
+	curve := ellcurv.S256()
+	r, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	u, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	e := scalarBaseMult(r)
+	v := scalarBaseMult(u)
+	h := hashToScalar([]byte("capsule"), e.SerializeCompressed(), v.SerializeCompressed())
+	s := new(big.Int).Mul(r, h)
+	s.Add(s, u)
+	s.Mod(s, curve.N)
+	capsule := append(append(e.SerializeCompressed(), v.SerializeCompressed()...), scalarBytes(s)...)
+
+	// K = (r + u) * pk
+	ru := new(big.Int).Add(r, u)
+	ru.Mod(ru, curve.N)
+	x, y := curve.ScalarMult(pub.X, pub.Y, ru.Bytes())
+	key := deriveKey(&ellcurv.PublicKey{Curve: curve, X: x, Y: y})
+	return seal(append(append(append([]byte{}, proxyMagic...), proxyTypeCapsule), capsule...), capsule, key, HexToBytes(data))
+}
+
+// ReEncryptionKey generates the key, which re-encrypts the data encrypted for the private key to the public key.
+func ReEncryptionKey(privateKey, publicKeyTo string) ([]byte, error) {
+	a, err := parsePrivateScalar(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	pubTo, err := ellcurv.ParsePubKey(HexToBytes(publicKeyTo), ellcurv.S256())
+	if err != nil {
+		return nil, err
+	}
+	curve := ellcurv.S256()
+	xa, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	xaPub := scalarBaseMult(xa)
+	sx, sy := curve.ScalarMult(pubTo.X, pubTo.Y, xa.Bytes())
+	d := hashToScalar([]byte("rekey"), xaPub.SerializeCompressed(), pubTo.SerializeCompressed(),
+		(&ellcurv.PublicKey{Curve: curve, X: sx, Y: sy}).SerializeCompressed())
+	// rk = a / d
+	rk := new(big.Int).ModInverse(d, curve.N)
+	rk.Mul(rk, a)
+	rk.Mod(rk, curve.N)
+	return append(scalarBytes(rk), xaPub.SerializeCompressed()...), nil
+}
+
+// ProxyReEncryption converts the data encrypted by ProxyEncryption using the re-encryption key, hex encoded.
+// The data isn't decrypted, and the capsule is verified before the conversion.
+func ProxyReEncryption(reKey, data string) ([]byte, error) {
+	rkBytes := HexToBytes(reKey)
+	if len(rkBytes) != reKeySize {
+		return nil, ErrInvalidReEncryptionKey
+	}
+	in := HexToBytes(data)
+	header := len(proxyMagic) + 1
+	if len(in) < header+capsuleSize+nonceSize || !bytes.HasPrefix(in, proxyMagic) || in[len(proxyMagic)] != proxyTypeCapsule {
+		return nil, ErrInvalidProxyCiphertext
+	}
+	capsule := in[header : header+capsuleSize]
+	e, v, err := verifyCapsule(capsule)
+	if err != nil {
+		return nil, err
+	}
+	curve := ellcurv.S256()
+	rk := new(big.Int).SetBytes(rkBytes[:scalarSize])
+	ex, ey := curve.ScalarMult(e.X, e.Y, rk.Bytes())
+	vx, vy := curve.ScalarMult(v.X, v.Y, rk.Bytes())
+
+	out := append([]byte{}, proxyMagic...)
+	out = append(out, proxyTypeReEncrypted)
+	out = append(out, capsule...)
+	out = append(out, (&ellcurv.PublicKey{Curve: curve, X: ex, Y: ey}).SerializeCompressed()...)
+	out = append(out, (&ellcurv.PublicKey{Curve: curve, X: vx, Y: vy}).SerializeCompressed()...)
+	out = append(out, rkBytes[scalarSize:]...)
+	return append(out, in[header+capsuleSize:]...), nil
+}
+
+// ProxyDecryption decrypts the data encrypted by ProxyEncryption for the private key,
+// or re-encrypted for it by ProxyReEncryption.
+func ProxyDecryption(privateKey, data string) ([]byte, error) {
+	a, err := parsePrivateScalar(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	curve := ellcurv.S256()
+	in := HexToBytes(data)
+	header := len(proxyMagic) + 1
+	if len(in) < header+capsuleSize+nonceSize || !bytes.HasPrefix(in, proxyMagic) {
+		return nil, ErrInvalidProxyCiphertext
+	}
+	capsule := in[header : header+capsuleSize]
+	e, v, err := verifyCapsule(capsule)
+	if err != nil {
+		return nil, err
+	}
+	rest := in[header+capsuleSize:]
+	var kx, ky *big.Int
+	switch in[len(proxyMagic)] {
+	case proxyTypeCapsule:
+		// K = a * (E + V)
+		x, y := curve.Add(e.X, e.Y, v.X, v.Y)
+		kx, ky = curve.ScalarMult(x, y, a.Bytes())
+	case proxyTypeReEncrypted:
+		if len(rest) < 3*pointSize+nonceSize {
+			return nil, ErrInvalidProxyCiphertext
+		}
+		points := make([]*ellcurv.PublicKey, 3)
+		for i := range points {
+			points[i], err = ellcurv.ParsePubKey(rest[i*pointSize:(i+1)*pointSize], curve)
+			if err != nil {
+				return nil, ErrInvalidProxyCiphertext
+			}
+		}
+		rest = rest[3*pointSize:]
+		// K = d * (E' + V'), where d * rk = a
+		xaPub := points[2]
+		sx, sy := curve.ScalarMult(xaPub.X, xaPub.Y, a.Bytes())
+		d := hashToScalar([]byte("rekey"), xaPub.SerializeCompressed(), scalarBaseMult(a).SerializeCompressed(),
+			(&ellcurv.PublicKey{Curve: curve, X: sx, Y: sy}).SerializeCompressed())
+		x, y := curve.Add(points[0].X, points[0].Y, points[1].X, points[1].Y)
+		kx, ky = curve.ScalarMult(x, y, d.Bytes())
+	default:
+		return nil, ErrInvalidProxyCiphertext
+	}
+	key := deriveKey(&ellcurv.PublicKey{Curve: curve, X: kx, Y: ky})
+	gcm, err := newProxyGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gcm.Open(nil, rest[:nonceSize], rest[nonceSize:], capsule)
+	if err != nil {
+		return nil, ErrInvalidProxyCiphertext
+	}
+	return out, nil
+}
+
+// verifyCapsule checks s * G == V + h * E, so the proxy re-encrypts only the capsules made by ProxyEncryption.
+func verifyCapsule(capsule []byte) (*ellcurv.PublicKey, *ellcurv.PublicKey, error) {
+	curve := ellcurv.S256()
+	e, err := ellcurv.ParsePubKey(capsule[:pointSize], curve)
+	if err != nil {
+		return nil, nil, ErrInvalidProxyCiphertext
+	}
+	v, err := ellcurv.ParsePubKey(capsule[pointSize:2*pointSize], curve)
+	if err != nil {
+		return nil, nil, ErrInvalidProxyCiphertext
+	}
+	s := new(big.Int).SetBytes(capsule[2*pointSize:])
+	h := hashToScalar([]byte("capsule"), capsule[:pointSize], capsule[pointSize:2*pointSize])
+	sx, sy := curve.ScalarBaseMult(scalarBytes(s))
+	hx, hy := curve.ScalarMult(e.X, e.Y, h.Bytes())
+	x, y := curve.Add(v.X, v.Y, hx, hy)
+	if sx.Cmp(x) != 0 || sy.Cmp(y) != 0 {
+		return nil, nil, ErrInvalidProxyCiphertext
+	}
+	return e, v, nil
+}
+
+func seal(header, capsule, key, data []byte) ([]byte, error) {
+	gcm, err := newProxyGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, data, capsule), nil
+}
+
+func newProxyGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomScalar() (*big.Int, error) {
+	priv, err := ellcurv.NewPrivateKey(ellcurv.S256())
+	if err != nil {
+		return nil, err
+	}
+	return priv.D, nil
+}
+
+// parsePrivateScalar parses the private key, hex encoded, which must be the scalar in [1, N-1].
+func parsePrivateScalar(privateKey string) (*big.Int, error) {
+	b, err := DecodeHex(privateKey)
+	if err != nil || len(b) != scalarSize {
+		return nil, ErrInvalidPrivateKey
+	}
+	k := new(big.Int).SetBytes(b)
+	if k.Sign() == 0 || k.Cmp(ellcurv.S256().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	return k, nil
+}
+
+func scalarBaseMult(k *big.Int) *ellcurv.PublicKey {
+	x, y := ellcurv.S256().ScalarBaseMult(k.Bytes())
+	return &ellcurv.PublicKey{Curve: ellcurv.S256(), X: x, Y: y}
+}
+
+// hashToScalar hashes the domain and the inputs by SHA-512 to the non-zero scalar.
+func hashToScalar(domain []byte, inputs ...[]byte) *big.Int {
+	h := sha512.New()
+	h.Write(domain)
+	for _, in := range inputs {
+		h.Write(in)
+	}
+	n := new(big.Int).Sub(ellcurv.S256().N, big.NewInt(1))
+	k := new(big.Int).SetBytes(h.Sum(nil))
+	k.Mod(k, n)
+	return k.Add(k, big.NewInt(1))
+}
+
+func scalarBytes(k *big.Int) []byte {
+	b := make([]byte, scalarSize)
+	return k.FillBytes(b)
+}
+
+// deriveKey derives the AES-256 key from the shared point.
+func deriveKey(p *ellcurv.PublicKey) []byte {
+	h := sha256.Sum256(append([]byte("pre-key"), p.SerializeCompressed()...))
+	return h[:]
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	ellcurv "github.com/btcsuite/btcd/btcec"
+)
+
+func newKeyPair(t *testing.T) (string, string) {
+	priv, err := ellcurv.NewPrivateKey(ellcurv.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BytesToHex(priv.Serialize()), BytesToHex(priv.PubKey().SerializeCompressed())
+}
+
+func TestProxyReEncryption(t *testing.T) {
+	signingA, _ := newKeyPair(t)
+	privA, pubA, err := ProxyKeyPair(signingA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privB, pubB := newKeyPair(t)
+	privC, _ := newKeyPair(t)
+	key := GenerateRandomAESKey(256)
+
+	encrypted, err := ProxyEncryption(pubA, BytesToHex(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsProxyCiphertext(BytesToHex(encrypted)) {
+		t.Error("expected proxy ciphertext")
+	}
+	out, err := ProxyDecryption(privA, BytesToHex(encrypted))
+	if err != nil || !bytes.Equal(out, key) {
+		t.Fatalf("failed to decrypt by delegator: %v", err)
+	}
+	if _, err = ProxyDecryption(privB, BytesToHex(encrypted)); err == nil {
+		t.Error("expected error of delegatee before re-encryption")
+	}
+	if _, err = ProxyDecryption(signingA, BytesToHex(encrypted)); err == nil {
+		t.Error("expected error of signing key of delegator")
+	}
+
+	reKey, err := ReEncryptionKey(privA, pubB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reEncrypted, err := ProxyReEncryption(BytesToHex(reKey), BytesToHex(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = ProxyDecryption(privB, BytesToHex(reEncrypted))
+	if err != nil || !bytes.Equal(out, key) {
+		t.Fatalf("failed to decrypt by delegatee: %v", err)
+	}
+	if _, err = ProxyDecryption(privC, BytesToHex(reEncrypted)); err == nil {
+		t.Error("expected error of other user")
+	}
+	if _, err = ProxyReEncryption(BytesToHex(reKey), BytesToHex(reEncrypted)); err == nil {
+		t.Error("expected error of re-encrypting twice")
+	}
+
+	// the capsule changed by the proxy is rejected
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(proxyMagic)+1+capsuleSize-1] ^= 1
+	if _, err = ProxyReEncryption(BytesToHex(reKey), BytesToHex(tampered)); err != ErrInvalidProxyCiphertext {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestProxyKeyPair(t *testing.T) {
+	priv, pub := newKeyPair(t)
+	proxyPriv, proxyPub, err := ProxyKeyPair(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxyPriv == priv || proxyPub == pub {
+		t.Error("proxy key pair is the signing key pair")
+	}
+	if again, _, _ := ProxyKeyPair(priv); again != proxyPriv {
+		t.Error("proxy key pair isn't deterministic")
+	}
+
+	n := BytesToHex(ellcurv.S256().N.Bytes())
+	for _, key := range []string{"", "zz", "00", strings.Repeat("00", scalarSize), n, strings.Repeat("ff", scalarSize), priv + "00"} {
+		if _, _, err = ProxyKeyPair(key); err != ErrInvalidPrivateKey {
+			t.Errorf("%q: unexpected error %v", key, err)
+		}
+		if _, err = ReEncryptionKey(key, pub); err != ErrInvalidPrivateKey {
+			t.Errorf("%q: unexpected error of re-encryption key %v", key, err)
+		}
+		if _, err = ProxyDecryption(key, "00"); err != ErrInvalidPrivateKey {
+			t.Errorf("%q: unexpected error of decryption %v", key, err)
+		}
+	}
+}
@@ -265,7 +265,7 @@ func patientCreateAndShareData(t *testing.T, stats *tachymeter.Tachymeter, wg *s
 	data := RandStringRunes(memory)
 
 	start := time.Now()
-	dataInfo, err := cli.CreatePatientData(dataName, data, 0)
+	dataInfo, err := cli.CreatePatientData(dataName, data, 0, "")
 	if err != nil {
 		t.Fatal(err)
 	}
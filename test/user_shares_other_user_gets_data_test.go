@@ -49,7 +49,7 @@ func Test_User_Shares_Other_User_Gets_Data_100_times(t *testing.T) {
 		randInt = 20
 	}
 	data := RandStringRunes(randInt)
-	dataInfo, err := cli.CreatePatientData(dataName, data, 0)
+	dataInfo, err := cli.CreatePatientData(dataName, data, 0, "")
 	if err != nil {
 		t.Fatal(err)
 	}
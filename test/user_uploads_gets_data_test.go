@@ -39,7 +39,7 @@ func Test_User_Uploads_Gets_Data_100_times(t *testing.T) {
 		data := RandStringRunes(randInt)
 
 		start := time.Now()
-		dataInfo, err := cli.CreatePatientData(dataName, data, 0)
+		dataInfo, err := cli.CreatePatientData(dataName, data, 0, "")
 		if err != nil {
 			t.Error(err)
 			fails++
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+// Receipt records the access of the reader to the data shared by the owner.
+// It is stored in the audit log of the owner, and of the patient the data originates from.
+type Receipt struct {
+	ID         string
+	Reader     string
+	ReaderKey  string
+	Owner      string
+	Hash       string
+	Name       string
+	AccessType uint
+	Timestamp  int64
+}
+
+// NewReceipt is the construct for Receipt.
+// The ID is the signature of the transaction submitting the receipt.
+func NewReceipt(id, reader, readerKey, owner, hash, name string, accessType uint, timestamp int64) *Receipt {
+	return &Receipt{
+		ID:         id,
+		Reader:     reader,
+		ReaderKey:  readerKey,
+		Owner:      owner,
+		Hash:       hash,
+		Name:       name,
+		AccessType: accessType,
+		Timestamp:  timestamp,
+	}
+}
+
+// ToBytes encodes the receipt as the versioned Receipt message.
+func (r *Receipt) ToBytes() []byte {
+	e := protos.NewVersionedEncoder()
+	e.String(2, r.ID)
+	e.String(3, r.Reader)
+	e.String(4, r.ReaderKey)
+	e.String(5, r.Owner)
+	e.String(6, r.Hash)
+	e.String(7, r.Name)
+	e.Uint(8, uint64(r.AccessType))
+	e.Int(9, r.Timestamp)
+	return e.ToBytes()
+}
+
+// ReceiptFromBytes decodes the receipt from the versioned Receipt message.
+func ReceiptFromBytes(data []byte) (*Receipt, error) {
+	r := &Receipt{}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		var v uint64
+		switch f.Num {
+		case 2:
+			r.ID, err = f.String()
+		case 3:
+			r.Reader, err = f.String()
+		case 4:
+			r.ReaderKey, err = f.String()
+		case 5:
+			r.Owner, err = f.String()
+		case 6:
+			r.Hash, err = f.String()
+		case 7:
+			r.Name, err = f.String()
+		case 8:
+			v, err = f.Uint()
+			r.AccessType = uint(v)
+		case 9:
+			r.Timestamp, err = f.Int()
+		}
+		return
+	})
+	return r, err
+}
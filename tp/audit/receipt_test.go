@@ -0,0 +1,26 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+func TestReceiptBytes(t *testing.T) {
+	r := NewReceipt("signature", "doctor", "02", "patient", "ab", "record", 1, 1600000000)
+	decoded, err := ReceiptFromBytes(r.ToBytes())
+	if err != nil || !reflect.DeepEqual(decoded, r) {
+		t.Errorf("unexpected receipt %+v, %v", decoded, err)
+	}
+
+	// the receipt is always versioned, and the newer schema can't be decoded
+	newer := protowire.AppendTag(nil, protos.SchemaVersionField, protowire.VarintType)
+	newer = protowire.AppendVarint(newer, protos.SchemaVersion+1)
+	for _, data := range [][]byte{nil, []byte("receipt"), newer} {
+		if _, err = ReceiptFromBytes(data); err == nil {
+			t.Errorf("invalid receipt %x is decoded", data)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package delegation
+
+import (
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+// Scopes of the actions the delegate can do on behalf of the patient
+var (
+	ScopeCreate  = "create"  // create, update, delete data and set its policy
+	ScopeShare   = "share"   // share and revoke data, and request access
+	ScopeProcess = "process" // accept and reject access requests
+)
+
+// Scopes lists all the scopes.
+var Scopes = []string{ScopeCreate, ScopeShare, ScopeProcess}
+
+// Delegation authorizes the delegate to act on behalf of the patient.
+// It is granted by the patient, or by the admin for the patient who can't manage keys, e.g. minor.
+type Delegation struct {
+	Patient     string
+	PatientKey  string
+	Delegate    string
+	DelegateKey string
+	Scopes      []string // The empty scopes allow all actions.
+	Expiration  int64    // The delegation without expiration never expires.
+	GrantedBy   string
+}
+
+// NewDelegation is the construct for Delegation.
+func NewDelegation(patient, patientKey, delegate, delegateKey string, scopes []string, expiration int64, grantedBy string) *Delegation {
+	return &Delegation{
+		Patient:     patient,
+		PatientKey:  patientKey,
+		Delegate:    delegate,
+		DelegateKey: delegateKey,
+		Scopes:      scopes,
+		Expiration:  expiration,
+		GrantedBy:   grantedBy,
+	}
+}
+
+// ValidScope reports whether the scope is one of the scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the delegation is expired at the unix time.
+func (d *Delegation) IsExpired(now int64) bool {
+	return d.Expiration != 0 && d.Expiration <= now
+}
+
+// HasScope reports whether the delegation allows the actions of the scope.
+func (d *Delegation) HasScope(scope string) bool {
+	if len(d.Scopes) == 0 {
+		return true
+	}
+	for _, s := range d.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ToBytes encodes the delegation as the versioned Delegation message.
+func (d *Delegation) ToBytes() []byte {
+	e := protos.NewVersionedEncoder()
+	e.String(2, d.Patient)
+	e.String(3, d.PatientKey)
+	e.String(4, d.Delegate)
+	e.String(5, d.DelegateKey)
+	e.Strings(6, d.Scopes)
+	e.Int(7, d.Expiration)
+	e.String(8, d.GrantedBy)
+	return e.ToBytes()
+}
+
+// DelegationFromBytes decodes the delegation from the versioned Delegation message.
+func DelegationFromBytes(data []byte) (*Delegation, error) {
+	d := &Delegation{}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		var scope string
+		switch f.Num {
+		case 2:
+			d.Patient, err = f.String()
+		case 3:
+			d.PatientKey, err = f.String()
+		case 4:
+			d.Delegate, err = f.String()
+		case 5:
+			d.DelegateKey, err = f.String()
+		case 6:
+			scope, err = f.String()
+			d.Scopes = append(d.Scopes, scope)
+		case 7:
+			d.Expiration, err = f.Int()
+		case 8:
+			d.GrantedBy, err = f.String()
+		}
+		return
+	})
+	return d, err
+}
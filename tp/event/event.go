@@ -0,0 +1,44 @@
+package event
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+)
+
+// Types of events emitted by the transaction processor
+var (
+	UserCreated      = "healthcare/user-created"
+	DataShared       = "healthcare/data-shared"
+	DataRevoked      = "healthcare/data-revoked"
+	RequestCreated   = "healthcare/request-created"
+	RequestProcessed = "healthcare/request-processed"
+	RequestApproved  = "healthcare/request-approved"
+)
+
+// Types of events notified to the recipient
+var NotificationTypes = []string{DataShared, DataRevoked, RequestCreated, RequestProcessed, RequestApproved}
+
+// Keys of event attributes
+var (
+	AttrUsername  = "username"
+	AttrPublicKey = "public_key"
+	AttrOwner     = "owner"
+	AttrRecipient = "recipient"
+	AttrHash      = "hash"
+	AttrRequestID = "request_id"
+	AttrStatus    = "status"
+)
+
+// Add emits the event with the attributes in the key and value pairs.
+func Add(context *processor.Context, eventType string, pairs ...string) error {
+	attributes := make([]processor.Attribute, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		attributes = append(attributes, processor.Attribute{Key: pairs[i], Value: pairs[i+1]})
+	}
+	err := context.AddEvent(eventType, attributes, nil)
+	if err != nil {
+		return &processor.InternalError{Msg: fmt.Sprint("failed to add event: ", err)}
+	}
+	return nil
+}
@@ -2,11 +2,16 @@ package handler
 
 import (
 	"fmt"
+	"strconv"
+
 	"github.com/hyperledger/sawtooth-sdk-go/logging"
 	"github.com/hyperledger/sawtooth-sdk-go/processor"
 	"github.com/hyperledger/sawtooth-sdk-go/protobuf/processor_pb2"
+	"healthcare-system-sawtooth/tp/delegation"
+	"healthcare-system-sawtooth/tp/event"
 	"healthcare-system-sawtooth/tp/payload"
 	"healthcare-system-sawtooth/tp/state"
+	tpUser "healthcare-system-sawtooth/tp/user"
 )
 
 var logger = logging.Get()
@@ -47,20 +52,361 @@ func (h *Handler) Apply(request *processor_pb2.TpProcessRequest, context *proces
 	}
 	st := state.NewStorageState(context)
 
-	logger.Debugf("Healthcare txn %v: user %v: payload: Name='%v', Action='%v', Target='%v', DataInfo='%v'", request.Signature, user, pl.Name, pl.Action, pl.DataInfo)
+	logger.Debugf("Healthcare txn %v: user %v: payload: Name='%v', Action='%v', Target='%v', DataInfo='%v'", request.Signature, user, pl.Name, pl.Action, pl.Target, pl.DataInfo)
+
+	// the delegate acts on behalf of the patient, so the state of the patient is changed
+	if pl.OnBehalf != "" {
+		user, err = checkOnBehalf(st, pl, user)
+		if err != nil {
+			return err
+		}
+	}
 
 	switch pl.Action {
 	// Base Action
 	case payload.CreateUser:
-		if len(pl.Target) != 1 || pl.Target[0] == "" {
+		if len(pl.Target) != 1 {
 			return &processor.InvalidTransactionError{Msg: "username is nil"}
 		}
-		return st.CreateUser(pl.Target[0], user)
+		err = validateUsername("username", pl.Target[0])
+		if err != nil {
+			return err
+		}
+		err = st.CreateUser(pl.Target[0], user)
+		if err != nil {
+			return err
+		}
+		return event.Add(context, event.UserCreated, event.AttrUsername, pl.Target[0], event.AttrPublicKey, user)
+
+	case payload.UpdateUserRole:
+		// the organization of the user is optionally targeted after the user
+		err = validateUserRole(pl.Target, pl.Role)
+		if err != nil {
+			return err
+		}
+		organization := ""
+		if len(pl.Target) == 3 {
+			organization = pl.Target[2]
+		}
+		return st.UpdateUserRole(user, pl.Target[0], pl.Target[1], tpUser.UserRole(pl.Role), organization)
+
+	case payload.ClaimLegacyName:
+		if len(pl.Target) != 2 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "user is nil"}
+		}
+		err = validatePublicKey("user public key", pl.Target[1])
+		if err != nil {
+			return err
+		}
+		return st.ClaimLegacyName(user, pl.Target[0], pl.Target[1])
 
 	case payload.UserCreateData:
-		return st.CreateUserData(pl.Name, user, pl.DataInfo)
+		err = validateDataInfo(pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		// data shared with the user by the owner is targeted by its name and public key,
+		// and the critical data by the id of the accepted request too
+		if len(pl.Target) == 2 || len(pl.Target) == 3 {
+			if pl.DataInfo.Source == "" {
+				return &processor.InvalidTransactionError{Msg: "source is nil"}
+			}
+			err = validatePublicKey("data owner key", pl.Target[1])
+			if err != nil {
+				return err
+			}
+			var requestID string
+			if len(pl.Target) == 3 {
+				requestID = pl.Target[2]
+			}
+			err = st.ShareUserData(pl.Name, user, pl.Target[0], pl.Target[1], requestID, pl.DataInfo)
+		} else {
+			err = st.CreateUserData(pl.Name, user, pl.DataInfo)
+		}
+		if err != nil || pl.DataInfo.Addr == pl.Name {
+			return err
+		}
+		return event.Add(context, event.DataShared, event.AttrOwner, pl.Name, event.AttrRecipient, pl.DataInfo.Addr, event.AttrHash, pl.DataInfo.Hash)
+
+	case payload.UserPruneData:
+		if pl.DataInfo.Hash == "" || pl.DataInfo.Addr == "" {
+			return &processor.InvalidTransactionError{Msg: "data is nil"}
+		}
+		err = validateDataRef(pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		// expired data of any user can be pruned by anyone
+		if len(pl.Target) == 1 {
+			err = st.PruneExpiredUserData(pl.Name, pl.Target[0], pl.DataInfo.Hash, pl.DataInfo.Addr)
+		} else {
+			err = st.PruneExpiredUserData(pl.Name, user, pl.DataInfo.Hash, pl.DataInfo.Addr)
+		}
+		if err != nil || pl.DataInfo.Addr == pl.Name {
+			return err
+		}
+		return event.Add(context, event.DataRevoked, event.AttrOwner, pl.Name, event.AttrRecipient, pl.DataInfo.Addr, event.AttrHash, pl.DataInfo.Hash)
+
+	case payload.UserUpdateData:
+		err = validateDataInfo(pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		if pl.DataInfo.Prev == "" {
+			return &processor.InvalidTransactionError{Msg: "previous version is nil"}
+		}
+		return st.UpdateUserData(pl.Name, user, pl.DataInfo)
+
+	case payload.UserRevokeData:
+		err = validateDataRef(pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		err = st.RevokeUserData(pl.Name, user, pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		return event.Add(context, event.DataRevoked, event.AttrOwner, pl.Name, event.AttrRecipient, pl.DataInfo.Addr, event.AttrHash, pl.DataInfo.Hash)
+
+	case payload.UserDeleteData:
+		err = validateHash("data hash", pl.DataInfo.Hash)
+		if err != nil {
+			return err
+		}
+		return st.DeleteUserData(pl.Name, user, pl.DataInfo)
+
+	case payload.UserAccessData:
+		if len(pl.Target) != 2 || pl.Target[0] == "" || pl.Target[1] == "" {
+			return &processor.InvalidTransactionError{Msg: "data owner is nil"}
+		}
+		if pl.DataInfo.Hash == "" {
+			return &processor.InvalidTransactionError{Msg: "data is nil"}
+		}
+		err = validateHash("data hash", pl.DataInfo.Hash)
+		if err != nil {
+			return err
+		}
+		return st.AccessUserData(pl.Name, user, pl.Target[0], pl.Target[1], pl.DataInfo.Hash, request.Signature)
+
+	case payload.UserSetPolicy:
+		if pl.DataInfo.Hash == "" || pl.DataInfo.Addr == "" {
+			return &processor.InvalidTransactionError{Msg: "data is nil"}
+		}
+		err = validateDataRef(pl.DataInfo)
+		if err != nil {
+			return err
+		}
+		return st.SetUserDataPolicy(pl.Name, user, pl.DataInfo.Hash, pl.DataInfo.Addr, pl.DataInfo.Policy)
+
+	case payload.UserSetApprovers:
+		// the threshold is targeted before the names of the approvers
+		if len(pl.Target) == 0 {
+			return &processor.InvalidTransactionError{Msg: "threshold is nil"}
+		}
+		threshold, err := strconv.ParseUint(pl.Target[0], 10, 32)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprint("invalid threshold: ", pl.Target[0])}
+		}
+		for _, approver := range pl.Target[1:] {
+			// users created before the validation may have any username, so only the length is checked
+			if approver == "" || len(approver) > MaxUsernameLength {
+				return &processor.InvalidTransactionError{Msg: "approver is nil"}
+			}
+		}
+		return st.SetApprovers(pl.Name, user, uint(threshold), pl.Target[1:])
+
+	// Group Action
+	case payload.CreateGroup:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "group name is nil"}
+		}
+		if len(pl.Target[0]) > MaxNameLength {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprintf("group name is longer than %d", MaxNameLength)}
+		}
+		return st.CreateGroup(pl.Target[0], pl.Name, user)
+
+	case payload.GroupAddMember:
+		err = checkGroupMemberTarget(pl.Target)
+		if err != nil {
+			return err
+		}
+		if !tpUser.ValidRole(tpUser.Role(pl.Role)) {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid Role: ", pl.Role)}
+		}
+		return st.AddGroupMember(pl.Target[0], user, pl.Target[1], pl.Target[2], tpUser.Role(pl.Role))
+
+	case payload.GroupRemoveMember:
+		err = checkGroupMemberTarget(pl.Target)
+		if err != nil {
+			return err
+		}
+		return st.RemoveGroupMember(pl.Target[0], user, pl.Target[1], pl.Target[2])
+
+	case payload.GroupUpdateMemberRole:
+		err = checkGroupMemberTarget(pl.Target)
+		if err != nil {
+			return err
+		}
+		if !tpUser.ValidRole(tpUser.Role(pl.Role)) {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid Role: ", pl.Role)}
+		}
+		return st.UpdateGroupMemberRole(pl.Target[0], user, pl.Target[2], tpUser.Role(pl.Role))
+
+	case payload.GroupUpdateLeader:
+		err = checkGroupMemberTarget(pl.Target)
+		if err != nil {
+			return err
+		}
+		return st.UpdateGroupLeader(pl.Target[0], user, pl.Target[2])
+
+	// Request Action
+	case payload.CreateRequest:
+		err = validateRequest(pl.Request)
+		if err != nil {
+			return err
+		}
+		r, err := st.CreateRequest(pl.Name, user, pl.Request)
+		if err != nil {
+			return err
+		}
+		// the approvers of multi-party request are notified as well
+		recipients := append([]string{r.RequestFrom}, r.Approvers...)
+		for i, recipient := range recipients {
+			if i > 0 && recipient == r.RequestFrom {
+				continue
+			}
+			err = event.Add(context, event.RequestCreated, event.AttrOwner, pl.Name, event.AttrRecipient, recipient, event.AttrRequestID, r.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case payload.AcceptRequest, payload.RejectRequest:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "request id is nil"}
+		}
+		r, err := st.ProcessRequest(pl.Target[0], user, pl.Action == payload.AcceptRequest)
+		if err != nil {
+			return err
+		}
+		return event.Add(context, event.RequestProcessed, event.AttrOwner, r.RequestFrom, event.AttrRecipient, r.UsernameTo, event.AttrRequestID, r.ID, event.AttrStatus, fmt.Sprint(r.Status))
+
+	case payload.ApproveRequest:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "request id is nil"}
+		}
+		r, err := st.ApproveRequest(pl.Target[0], user)
+		if err != nil {
+			return err
+		}
+		// both the request receiver, who opens the data, and the requester are notified
+		for _, recipient := range []string{r.RequestFrom, r.UsernameTo} {
+			err = event.Add(context, event.RequestApproved, event.AttrOwner, r.Approver(user), event.AttrRecipient, recipient, event.AttrRequestID, r.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	// Delegation Action
+	case payload.GrantDelegation:
+		err = validateDelegation(pl.Delegation)
+		if err != nil {
+			return err
+		}
+		return st.GrantDelegation(user, pl.Delegation)
+
+	case payload.RevokeDelegation:
+		if len(pl.Target) != 3 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "delegation is nil"}
+		}
+		err = validatePublicKey("patient key", pl.Target[1])
+		if err != nil {
+			return err
+		}
+		err = validatePublicKey("delegate key", pl.Target[2])
+		if err != nil {
+			return err
+		}
+		return st.RevokeDelegation(user, pl.Target[0], pl.Target[1], pl.Target[2])
+
+	case payload.GrantReKey:
+		err = validateReKey(pl.ReKey)
+		if err != nil {
+			return err
+		}
+		return st.GrantReKey(user, pl.ReKey)
+
+	case payload.RevokeReKey:
+		if len(pl.Target) != 4 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "re-encryption key is nil"}
+		}
+		err = validatePublicKey("patient key", pl.Target[1])
+		if err != nil {
+			return err
+		}
+		err = validatePublicKey("proxy key", pl.Target[2])
+		if err != nil {
+			return err
+		}
+		err = validatePublicKey("recipient key", pl.Target[3])
+		if err != nil {
+			return err
+		}
+		return st.RevokeReKey(user, pl.Target[0], pl.Target[1], pl.Target[2], pl.Target[3])
 
 	default:
 		return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid Action: ", pl.Action)}
 	}
 }
+
+// Checks the signer is the delegate allowed to do the action on behalf of the patient,
+// and returns the public key of the patient
+func checkOnBehalf(st *state.StorageState, pl *payload.StoragePayload, signer string) (string, error) {
+	err := validatePublicKey("patient key", pl.OnBehalf)
+	if err != nil {
+		return "", err
+	}
+	d, err := st.GetDelegation(pl.Name, pl.OnBehalf, signer)
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		return "", &processor.InvalidTransactionError{Msg: "signer isn't delegate of the patient"}
+	}
+	var scope string
+	switch pl.Action {
+	case payload.UserCreateData:
+		// the copy of the data created by the delegate is shared with the delegate to read it
+		if len(pl.Target) == 0 && (pl.DataInfo.Addr == pl.Name || pl.DataInfo.Addr == d.Delegate) {
+			scope = delegation.ScopeCreate
+		} else {
+			scope = delegation.ScopeShare
+		}
+	case payload.UserUpdateData, payload.UserDeleteData, payload.UserPruneData, payload.UserSetPolicy:
+		scope = delegation.ScopeCreate
+	case payload.UserRevokeData, payload.UserSetApprovers, payload.CreateRequest:
+		scope = delegation.ScopeShare
+	case payload.AcceptRequest, payload.RejectRequest, payload.ApproveRequest:
+		scope = delegation.ScopeProcess
+	default:
+		return "", &processor.InvalidTransactionError{Msg: "action can't be done on behalf of the patient"}
+	}
+	err = st.VerifyDelegation(d, scope)
+	if err != nil {
+		return "", err
+	}
+	return pl.OnBehalf, nil
+}
+
+// Group member actions target the group name, the member name and the member public key
+func checkGroupMemberTarget(target []string) error {
+	if len(target) != 3 || target[0] == "" {
+		return &processor.InvalidTransactionError{Msg: "group name is nil"}
+	}
+	if target[1] == "" || target[2] == "" {
+		return &processor.InvalidTransactionError{Msg: "group member is nil"}
+	}
+	return nil
+}
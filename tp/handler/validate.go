@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/delegation"
+	"healthcare-system-sawtooth/tp/rekey"
+	"healthcare-system-sawtooth/tp/request"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+// Limits of the payload fields
+const (
+	MaxUsernameLength = 64
+	MaxNameLength     = 256
+	MaxIDLength       = 64
+	MaxKeyLength      = 1024 // bytes of the encrypted key of data
+	MaxRequestHashes  = 1000
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// Usernames of new users consist of letters, digits and ._@- characters
+func validateUsername(field, username string) error {
+	if username == "" {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("%s is nil", field)}
+	}
+	if len(username) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("%s is longer than %d", field, MaxUsernameLength)}
+	}
+	if !usernamePattern.MatchString(username) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("%s contains invalid characters", field)}
+	}
+	return nil
+}
+
+// Public keys are compressed secp256k1 keys in hex
+func validatePublicKey(field, publicKey string) error {
+	b, err := crypto.DecodeHex(publicKey)
+	if err != nil || len(b) != 33 {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("%s isn't valid public key", field)}
+	}
+	return nil
+}
+
+// Hashes of data are SHA-512 in lowercase hex
+func validateHash(field, hash string) error {
+	b, err := crypto.DecodeHex(hash)
+	if err != nil || len(b) != 64 || crypto.BytesToHex(b) != hash {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("%s isn't valid SHA-512 hex", field)}
+	}
+	return nil
+}
+
+// Addresses of data are the usernames of the owner or the recipient.
+// Users created before the validation may have any username, so only the length is checked.
+func validateAddr(addr string) error {
+	if addr == "" {
+		return &processor.InvalidTransactionError{Msg: "data address is nil"}
+	}
+	if len(addr) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("data address is longer than %d", MaxUsernameLength)}
+	}
+	return nil
+}
+
+func validateAccessType(accessType uint) error {
+	if accessType > storage.Critical {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid AccessType: ", accessType)}
+	}
+	return nil
+}
+
+// Validates the data targeted by hash and address
+func validateDataRef(info storage.DataInfo) error {
+	err := validateHash("data hash", info.Hash)
+	if err != nil {
+		return err
+	}
+	return validateAddr(info.Addr)
+}
+
+// Validates the information of the data to be stored
+func validateDataInfo(info storage.DataInfo) error {
+	if info.Name == "" {
+		return &processor.InvalidTransactionError{Msg: "data name is nil"}
+	}
+	if len(info.Name) > MaxNameLength {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("data name is longer than %d", MaxNameLength)}
+	}
+	err := validateDataRef(info)
+	if err != nil {
+		return err
+	}
+	if info.Size < 0 {
+		return &processor.InvalidTransactionError{Msg: "data size is negative"}
+	}
+	// the copy shared with the trusted party holding the re-encryption key has the forward key only
+	if info.Key != "" || info.ForwardKey == "" || info.Source == "" {
+		key, err := crypto.DecodeHex(info.Key)
+		if err != nil || len(key) == 0 {
+			return &processor.InvalidTransactionError{Msg: "data key isn't valid hex"}
+		}
+		if len(key) > MaxKeyLength {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprintf("data key is longer than %d bytes", MaxKeyLength)}
+		}
+	}
+	if info.ForwardKey != "" {
+		key, err := crypto.DecodeHex(info.ForwardKey)
+		if err != nil || len(key) == 0 || len(key) > MaxKeyLength {
+			return &processor.InvalidTransactionError{Msg: "data forward key isn't valid"}
+		}
+	}
+	err = validateAccessType(info.AccessType)
+	if err != nil {
+		return err
+	}
+	if info.Source != "" {
+		err = validateHash("data source", info.Source)
+		if err != nil {
+			return err
+		}
+	}
+	if info.Prev != "" {
+		err = validateHash("previous version", info.Prev)
+		if err != nil {
+			return err
+		}
+	}
+	if info.Expiration < 0 {
+		return &processor.InvalidTransactionError{Msg: "expiration is negative"}
+	}
+	return nil
+}
+
+// Validates the user targeted by name, public key and optionally organization, and the role granted to the user
+func validateUserRole(target []string, role uint) error {
+	if len(target) < 2 || len(target) > 3 || target[0] == "" || target[1] == "" {
+		return &processor.InvalidTransactionError{Msg: "user is nil"}
+	}
+	err := validatePublicKey("user public key", target[1])
+	if err != nil {
+		return err
+	}
+	if uint(user.UserRole(role)) != role || !user.ValidUserRole(user.UserRole(role)) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid Role: ", role)}
+	}
+	return nil
+}
+
+// Validates the access request to be created
+func validateRequest(req request.Request) error {
+	if req.ID == "" {
+		return &processor.InvalidTransactionError{Msg: "request id is nil"}
+	}
+	if len(req.ID) > MaxIDLength {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("request id is longer than %d", MaxIDLength)}
+	}
+	if req.RequestFrom == "" || req.RequestFromKey == "" || req.UsernameFrom == "" {
+		return &processor.InvalidTransactionError{Msg: "request receiver is nil"}
+	}
+	err := validatePublicKey("request receiver key", req.RequestFromKey)
+	if err != nil {
+		return err
+	}
+	err = validateAccessType(req.AccessType)
+	if err != nil {
+		return err
+	}
+	if len(req.Hashes) == 0 {
+		return &processor.InvalidTransactionError{Msg: "requested data is nil"}
+	}
+	if len(req.Hashes) > MaxRequestHashes {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("request has more than %d data", MaxRequestHashes)}
+	}
+	for _, hash := range req.Hashes {
+		err = validateHash("requested data hash", hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validates the delegation to be granted
+func validateDelegation(d delegation.Delegation) error {
+	// users created before the validation may have any username, so only the length is checked
+	if d.Patient == "" || len(d.Patient) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: "patient is nil"}
+	}
+	err := validatePublicKey("patient key", d.PatientKey)
+	if err != nil {
+		return err
+	}
+	if d.Delegate == "" || len(d.Delegate) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: "delegate is nil"}
+	}
+	err = validatePublicKey("delegate key", d.DelegateKey)
+	if err != nil {
+		return err
+	}
+	if len(d.Scopes) > len(delegation.Scopes) {
+		return &processor.InvalidTransactionError{Msg: "too many scopes"}
+	}
+	if d.Expiration < 0 {
+		return &processor.InvalidTransactionError{Msg: "expiration is negative"}
+	}
+	return nil
+}
+
+// Validates the re-encryption key to be issued
+func validateReKey(k rekey.ReKey) error {
+	if k.Patient == "" || len(k.Patient) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: "patient is nil"}
+	}
+	if k.Proxy == "" || len(k.Proxy) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: "proxy is nil"}
+	}
+	if k.Recipient == "" || len(k.Recipient) > MaxUsernameLength {
+		return &processor.InvalidTransactionError{Msg: "recipient is nil"}
+	}
+	err := validatePublicKey("patient key", k.PatientKey)
+	if err != nil {
+		return err
+	}
+	err = validatePublicKey("proxy key", k.ProxyKey)
+	if err != nil {
+		return err
+	}
+	err = validatePublicKey("recipient key", k.RecipientKey)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.DecodeHex(k.Key)
+	if err != nil || len(key) == 0 || len(key) > MaxKeyLength {
+		return &processor.InvalidTransactionError{Msg: "re-encryption key isn't valid"}
+	}
+	if k.Expiration < 0 {
+		return &processor.InvalidTransactionError{Msg: "expiration is negative"}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+func TestValidateDataInfo(t *testing.T) {
+	hash := crypto.SHA512HexFromBytes([]byte("data"))
+	valid := storage.DataInfo{Name: "blood type", Hash: hash, Key: "0a0b", Addr: "patientA", AccessType: storage.Critical}
+	if err := validateDataInfo(valid); err != nil {
+		t.Fatal(err)
+	}
+	proxyOnly := valid
+	proxyOnly.Key, proxyOnly.ForwardKey, proxyOnly.Source = "", "0a0b", hash
+	if err := validateDataInfo(proxyOnly); err != nil {
+		t.Errorf("copy with forward key only: %v", err)
+	}
+	invalid := []func(info *storage.DataInfo){
+		func(info *storage.DataInfo) { info.Name = "" },
+		func(info *storage.DataInfo) { info.Name = strings.Repeat("a", MaxNameLength+1) },
+		func(info *storage.DataInfo) { info.Hash = hash[:64] },
+		func(info *storage.DataInfo) { info.Hash = strings.ToUpper(hash) },
+		func(info *storage.DataInfo) { info.Key = "0a0" },
+		func(info *storage.DataInfo) { info.Key = "" },
+		func(info *storage.DataInfo) { info.Addr = "" },
+		func(info *storage.DataInfo) { info.AccessType = 3 },
+		func(info *storage.DataInfo) { info.Size = -1 },
+		func(info *storage.DataInfo) { info.Source = "source" },
+		func(info *storage.DataInfo) { info.ForwardKey = "0a0" },
+		func(info *storage.DataInfo) { info.Key, info.ForwardKey = "", "0a0b" },
+	}
+	for i, change := range invalid {
+		info := valid
+		change(&info)
+		if err := validateDataInfo(info); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	for _, name := range []string{"patientA", "doctor_b", "0b2c1f9e-6f1a-4c3e-8f3b-2d2b7a4b1c5d"} {
+		if err := validateUsername("username", name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "patient A", "a/b", strings.Repeat("a", MaxUsernameLength+1)} {
+		if err := validateUsername("username", name); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestValidateUserRole(t *testing.T) {
+	key := "02" + crypto.SHA256HexFromBytes([]byte("doctor"))
+	cases := []struct {
+		target []string
+		role   uint
+		ok     bool
+	}{
+		{[]string{"doctor", key}, uint(user.UserRolePractitioner), true},
+		{[]string{"doctor", key, "HospitalA"}, uint(user.UserRoleResponder), true},
+		{[]string{"doctor", key}, uint(user.UserRoleAdmin), true}, // rejected by the state, as admins follow the setting
+		{[]string{"doctor", key}, uint(user.UserRoleAdmin) + 1, false},
+		{[]string{"doctor", key}, 256, false}, // not truncated to the patient
+		{[]string{"doctor"}, 0, false},
+		{[]string{"", key}, 0, false},
+		{[]string{"doctor", ""}, 0, false},
+		{[]string{"doctor", "0a0b"}, 0, false},
+		{[]string{"doctor", key, "HospitalA", "extra"}, 0, false},
+	}
+	for i, c := range cases {
+		if err := validateUserRole(c.target, c.role); (err == nil) != c.ok {
+			t.Errorf("case %d: unexpected result %v", i, err)
+		}
+	}
+}
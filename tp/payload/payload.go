@@ -3,8 +3,13 @@ package payload
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/tp/delegation"
+	"healthcare-system-sawtooth/tp/protos"
+	"healthcare-system-sawtooth/tp/rekey"
+	"healthcare-system-sawtooth/tp/request"
 	"healthcare-system-sawtooth/tp/storage"
 )
 
@@ -12,13 +17,54 @@ const _ = proto.ProtoPackageIsVersion3
 
 // Common action
 var (
-	Unset      uint = 0
-	CreateUser uint = 1
+	Unset          uint = 0
+	CreateUser     uint = 1
+	UpdateUserRole uint = 2
+	// Claims the username of the user created before the name registry, which only the admin can do
+	ClaimLegacyName uint = 3
 )
 
 // User action
 var (
 	UserCreateData uint = 10
+	UserRevokeData uint = 11
+	UserDeleteData uint = 12
+	UserUpdateData uint = 13
+	UserPruneData  uint = 14
+	UserAccessData uint = 15
+	UserSetPolicy  uint = 16
+	// Sets the trusted parties who approve critical requests
+	UserSetApprovers uint = 17
+)
+
+// Group action
+var (
+	CreateGroup           uint = 20
+	GroupAddMember        uint = 21
+	GroupRemoveMember     uint = 22
+	GroupUpdateMemberRole uint = 23
+	GroupUpdateLeader     uint = 24
+)
+
+// Request action
+var (
+	CreateRequest uint = 30
+	AcceptRequest uint = 31
+	RejectRequest uint = 32
+	// Records the approval of multi-party request
+	ApproveRequest uint = 33
+)
+
+// Delegation action
+var (
+	GrantDelegation  uint = 40
+	RevokeDelegation uint = 41
+)
+
+// Proxy re-encryption action
+var (
+	GrantReKey  uint = 50
+	RevokeReKey uint = 51
 )
 
 // Payload data model received by the transaction processor
@@ -27,25 +73,121 @@ type StoragePayload struct {
 	Name     string           `default:""`
 	Target   []string         `default:"nil"`
 	Key      string           `default:""`
+	Role     uint             `default:"0"`
 	DataInfo storage.DataInfo `default:"DataInfo{}"`
+	Request  request.Request  `default:"Request{}"`
+	// Public key of the patient the signer acts on behalf of
+	OnBehalf   string                `default:""`
+	Delegation delegation.Delegation `default:"Delegation{}"`
+	ReKey      rekey.ReKey           `default:"ReKey{}"`
 }
 
 // Creates new payload data model
+// Both the versioned StoragePayload message and legacy gob encoding are accepted.
 func StoragePayloadFromBytes(payloadData []byte) (*StoragePayload, error) {
 	if payloadData == nil {
 		return nil, &processor.InvalidTransactionError{Msg: "Must contain payload"}
 	}
 	pl := &StoragePayload{}
-	buf := bytes.NewBuffer(payloadData)
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(pl)
-	return pl, err
+	if !protos.IsVersioned(payloadData) {
+		buf := bytes.NewBuffer(payloadData)
+		dec := gob.NewDecoder(buf)
+		err := dec.Decode(pl)
+		return pl, err
+	}
+	err := protos.DecodeVersioned(payloadData, func(f protos.Field) (err error) {
+		var v uint64
+		var b []byte
+		switch f.Num {
+		case 2:
+			v, err = f.Uint()
+			pl.Action = uint(v)
+		case 3:
+			pl.Name, err = f.String()
+		case 4:
+			b, err = f.Bytes()
+			pl.Target = append(pl.Target, string(b))
+		case 5:
+			pl.Key, err = f.String()
+		case 6:
+			v, err = f.Uint()
+			pl.Role = uint(v)
+		case 7:
+			var info *storage.DataInfo
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			info, err = storage.DataInfoFromProto(b)
+			if err != nil {
+				return
+			}
+			pl.DataInfo = *info
+		case 8:
+			var req *request.Request
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			req, err = request.RequestFromBytes(b)
+			if err != nil {
+				return
+			}
+			pl.Request = *req
+		case 9:
+			pl.OnBehalf, err = f.String()
+		case 10:
+			var d *delegation.Delegation
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			d, err = delegation.DelegationFromBytes(b)
+			if err != nil {
+				return
+			}
+			pl.Delegation = *d
+		case 11:
+			var k *rekey.ReKey
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			k, err = rekey.ReKeyFromBytes(b)
+			if err != nil {
+				return
+			}
+			pl.ReKey = *k
+		}
+		return
+	})
+	if err != nil {
+		return nil, &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid payload: ", err)}
+	}
+	return pl, nil
 }
 
 // Converts new payload data model to bytes
+// The payload is encoded as the versioned StoragePayload message.
 func (ssp *StoragePayload) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(ssp)
-	return buf.Bytes()
+	e := protos.NewVersionedEncoder()
+	e.Uint(2, uint64(ssp.Action))
+	e.String(3, ssp.Name)
+	e.Strings(4, ssp.Target)
+	e.String(5, ssp.Key)
+	e.Uint(6, uint64(ssp.Role))
+	if info := ssp.DataInfo.ToProto(); len(info) > 0 {
+		e.Message(7, info)
+	}
+	if ssp.Request.ID != "" {
+		e.Message(8, ssp.Request.ToBytes())
+	}
+	e.String(9, ssp.OnBehalf)
+	if ssp.Delegation.DelegateKey != "" {
+		e.Message(10, ssp.Delegation.ToBytes())
+	}
+	if ssp.ReKey.RecipientKey != "" {
+		e.Message(11, ssp.ReKey.ToBytes())
+	}
+	return e.ToBytes()
 }
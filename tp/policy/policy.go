@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Policy language of the access to the data:
+//
+//	policy    = term { "OR" term }
+//	term      = condition { "AND" condition }
+//	condition = attribute ( "=" | "!=" ) value
+//
+// For example, "role=practitioner AND purpose=emergency AND org=HospitalA".
+// The empty policy allows any access.
+
+// Attributes of the requester evaluated by the policy
+var (
+	AttrRole    = "role"
+	AttrPurpose = "purpose"
+	AttrOrg     = "org"
+)
+
+// Values of the role attribute
+var Roles = []string{"patient", "practitioner", "responder", "admin"}
+
+// MaxLength is the maximum length of the policy.
+const MaxLength = 256
+
+type condition struct {
+	attribute string
+	value     string
+	negative  bool
+}
+
+// Policy is the parsed policy, the disjunction of the conjunctions of conditions.
+type Policy struct {
+	terms [][]condition
+}
+
+// Parse parses the policy, and validates its attributes and values.
+func Parse(s string) (*Policy, error) {
+	if len(s) > MaxLength {
+		return nil, fmt.Errorf("policy is longer than %d", MaxLength)
+	}
+	p := &Policy{}
+	tokens := strings.Fields(s)
+	if len(tokens) == 0 {
+		return p, nil
+	}
+	term := make([]condition, 0)
+	for i, token := range tokens {
+		if i%2 == 1 {
+			switch token {
+			case "AND":
+			case "OR":
+				p.terms = append(p.terms, term)
+				term = make([]condition, 0)
+			default:
+				return nil, fmt.Errorf("expected AND or OR: %s", token)
+			}
+			continue
+		}
+		c, err := parseCondition(token)
+		if err != nil {
+			return nil, err
+		}
+		term = append(term, c)
+	}
+	if len(tokens)%2 == 0 {
+		return nil, errors.New("policy ends with operator")
+	}
+	p.terms = append(p.terms, term)
+	return p, nil
+}
+
+// Validate reports the error of the policy.
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
+// ValidateValue reports the error of the value of attribute, such as the purpose of request.
+// The empty value is valid and never satisfies the condition.
+func ValidateValue(value string) error {
+	if len(value) > MaxLength {
+		return fmt.Errorf("value is longer than %d", MaxLength)
+	}
+	if strings.ContainsAny(value, "= \t\r\n") {
+		return fmt.Errorf("invalid value: %s", value)
+	}
+	return nil
+}
+
+// Evaluate reports whether the attributes of the requester satisfy the policy.
+func (p *Policy) Evaluate(attributes map[string]string) bool {
+	if len(p.terms) == 0 {
+		return true
+	}
+	for _, term := range p.terms {
+		satisfied := true
+		for _, c := range term {
+			if (attributes[c.attribute] == c.value) == c.negative {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate parses the policy, and reports whether the attributes of the requester satisfy it.
+func Evaluate(s string, attributes map[string]string) (bool, error) {
+	p, err := Parse(s)
+	if err != nil {
+		return false, err
+	}
+	return p.Evaluate(attributes), nil
+}
+
+func parseCondition(token string) (condition, error) {
+	c := condition{}
+	sep := "="
+	if strings.Contains(token, "!=") {
+		sep = "!="
+		c.negative = true
+	}
+	parts := strings.SplitN(token, sep, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return c, fmt.Errorf("invalid condition: %s", token)
+	}
+	c.attribute, c.value = parts[0], parts[1]
+	if strings.ContainsAny(c.value, "=!") {
+		return c, fmt.Errorf("invalid condition: %s", token)
+	}
+	switch c.attribute {
+	case AttrRole:
+		for _, role := range Roles {
+			if role == c.value {
+				return c, nil
+			}
+		}
+		return c, fmt.Errorf("invalid role: %s", c.value)
+	case AttrPurpose, AttrOrg:
+		return c, nil
+	default:
+		return c, fmt.Errorf("invalid attribute: %s", c.attribute)
+	}
+}
@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"",
+		"role=practitioner",
+		"role=practitioner AND purpose=emergency AND org=HospitalA",
+		"role=responder OR role=practitioner AND org!=HospitalB",
+	}
+	for _, s := range valid {
+		if err := Validate(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	invalid := []string{
+		"role=doctor",
+		"name=patientA",
+		"role=practitioner AND",
+		"role=practitioner purpose=emergency",
+		"AND role=practitioner",
+		"role=",
+	}
+	for _, s := range invalid {
+		if err := Validate(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	attributes := map[string]string{AttrRole: "practitioner", AttrPurpose: "emergency", AttrOrg: "HospitalA"}
+	cases := map[string]bool{
+		"": true,
+		"role=practitioner AND purpose=emergency AND org=HospitalA": true,
+		"role=practitioner AND org=HospitalB":                       false,
+		"role=responder OR org=HospitalA":                           true,
+		"role=responder OR role=practitioner AND org!=HospitalA":    false,
+	}
+	for s, expected := range cases {
+		ok, err := Evaluate(s, attributes)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if ok != expected {
+			t.Errorf("%q: expected %v", s, expected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package protos
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// SchemaVersion is the version of healthcare.proto written by this package.
+const SchemaVersion uint64 = 1
+
+// Field number of the schema version in the versioned messages.
+const SchemaVersionField protowire.Number = 1
+
+// Encoder writes the fields of protobuf message deterministically.
+// The fields must be written in the field number order.
+// Scalar fields with zero values are omitted as in proto3.
+type Encoder struct {
+	buf []byte
+}
+
+// NewEncoder is the construct for Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{buf: make([]byte, 0)}
+}
+
+// NewVersionedEncoder returns the Encoder with the schema version written.
+func NewVersionedEncoder() *Encoder {
+	e := NewEncoder()
+	e.Uint(SchemaVersionField, SchemaVersion)
+	return e
+}
+
+// Uint writes the uint32 or uint64 field.
+func (e *Encoder) Uint(num protowire.Number, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, v)
+}
+
+// Int writes the int64 field.
+func (e *Encoder) Int(num protowire.Number, v int64) {
+	e.Uint(num, uint64(v))
+}
+
+// Bool writes the bool field.
+func (e *Encoder) Bool(num protowire.Number, v bool) {
+	if v {
+		e.Uint(num, 1)
+	}
+}
+
+// String writes the string field.
+func (e *Encoder) String(num protowire.Number, v string) {
+	if v == "" {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendString(e.buf, v)
+}
+
+// Strings writes the repeated string field.
+func (e *Encoder) Strings(num protowire.Number, vs []string) {
+	for _, v := range vs {
+		e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+		e.buf = protowire.AppendString(e.buf, v)
+	}
+}
+
+// Message writes the embedded message field.
+// Nil message is omitted, empty message is written.
+func (e *Encoder) Message(num protowire.Number, v []byte) {
+	if v == nil {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, v)
+}
+
+// ToBytes returns the encoded message.
+func (e *Encoder) ToBytes() []byte {
+	return e.buf
+}
+
+// Field is the field of decoded protobuf message.
+type Field struct {
+	Num    protowire.Number
+	Type   protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// Uint returns the value of uint32 or uint64 field.
+func (f Field) Uint() (uint64, error) {
+	if f.Type != protowire.VarintType {
+		return 0, fmt.Errorf("field %d: expected varint", f.Num)
+	}
+	return f.varint, nil
+}
+
+// Int returns the value of int64 field.
+func (f Field) Int() (int64, error) {
+	v, err := f.Uint()
+	return int64(v), err
+}
+
+// Bool returns the value of bool field.
+func (f Field) Bool() (bool, error) {
+	v, err := f.Uint()
+	return v != 0, err
+}
+
+// String returns the value of string field.
+func (f Field) String() (string, error) {
+	v, err := f.Bytes()
+	return string(v), err
+}
+
+// Bytes returns the value of bytes or embedded message field.
+func (f Field) Bytes() ([]byte, error) {
+	if f.Type != protowire.BytesType {
+		return nil, fmt.Errorf("field %d: expected length-delimited", f.Num)
+	}
+	return f.bytes, nil
+}
+
+// Decode calls the handler for every field of protobuf message in the order of appearance.
+func Decode(data []byte, handler func(f Field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		f := Field{Num: num, Type: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		err := handler(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeVersioned decodes the versioned message.
+// The schema version must be the first field, and must not be newer than SchemaVersion.
+func DecodeVersioned(data []byte, handler func(f Field) error) error {
+	if !IsVersioned(data) {
+		return errors.New("schema version is missing")
+	}
+	return Decode(data, func(f Field) error {
+		if f.Num != SchemaVersionField {
+			return handler(f)
+		}
+		v, err := f.Uint()
+		if err != nil {
+			return err
+		}
+		if v > SchemaVersion {
+			return fmt.Errorf("unsupported schema version: %d", v)
+		}
+		return nil
+	})
+}
+
+// IsVersioned reports whether the data is the versioned protobuf message: the schema version,
+// which isn't 0, is the first field, and the rest of the data consists of well-formed fields.
+// Legacy gob encoded data starts with the length of the type definition,
+// which is always longer than the tag of schema version.
+func IsVersioned(data []byte) bool {
+	num, typ, n := protowire.ConsumeTag(data)
+	if n <= 0 || num != SchemaVersionField || typ != protowire.VarintType {
+		return false
+	}
+	v, m := protowire.ConsumeVarint(data[n:])
+	if m <= 0 || v == 0 {
+		return false
+	}
+	return Decode(data[n+m:], func(Field) error { return nil }) == nil
+}
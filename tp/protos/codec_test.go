@@ -0,0 +1,251 @@
+package protos_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"healthcare-system-sawtooth/tp/audit"
+	"healthcare-system-sawtooth/tp/delegation"
+	"healthcare-system-sawtooth/tp/payload"
+	"healthcare-system-sawtooth/tp/protos"
+	"healthcare-system-sawtooth/tp/rekey"
+	"healthcare-system-sawtooth/tp/request"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+func testData() *storage.Data {
+	return &storage.Data{Name: "record", Hash: "ab", Size: 10, KeyIndex: "cd", Addr: "alice", AccessType: storage.Critical,
+		Source: "ef", Version: 2, Prev: "01", Expiration: 1600000000, Next: "02", Origin: "bob", Policy: "role:doctor",
+		Category: "allergy", ForwardKey: "03", Copies: []storage.DataRef{{Owner: "alice", OwnerKey: "04", Hash: "ab", Addr: "bob"}}}
+}
+
+func testRoot() *storage.Root {
+	repo := storage.NewRepo("home")
+	repo.INodes = append(repo.INodes, testData())
+	keys := storage.NewFileKeyMap()
+	keys.Keys = append(keys.Keys, &storage.FileKey{Index: "cd", Used: 1, Key: "05", Published: true})
+	return storage.NewRoot(repo, keys)
+}
+
+func testRequest() *request.Request {
+	r := request.NewRequest("id", "doctor", "06", "alice", "responder", "07", []string{"ab", "ef"}, storage.Critical)
+	r.Status = request.StatusAccepted
+	r.Purpose = "treatment"
+	r.Approvers = []string{"doctor", "nurse"}
+	r.ApproverKeys = []string{"06", "08"}
+	r.Threshold = 2
+	r.Approvals = []string{"nurse", "doctor"}
+	return r
+}
+
+// goldenCase is the message of healthcare.proto named by the case with every field set, and its encoding.
+type goldenCase struct {
+	name   string
+	value  interface{}
+	encode func() []byte
+	decode func([]byte) (interface{}, error)
+	golden string
+}
+
+// bytes returns the encoding of the value by the codec.
+func (c goldenCase) bytes() []byte {
+	if c.encode != nil {
+		return c.encode()
+	}
+	return c.value.(interface{ ToBytes() []byte }).ToBytes()
+}
+
+var goldenCases = []goldenCase{
+	{
+		name: "User",
+		value: &user.User{Name: "alice", PublicKey: "04", Groups: []string{"cardiology"}, Root: testRoot(),
+			Role: user.UserRoleResponder, Organization: "hospital", Records: 3, DataSize: 30,
+			Approvers: []string{"doctor"}, ApproverKeys: []string{"06"}, ApprovalThreshold: 1},
+		decode: func(b []byte) (interface{}, error) { return user.UserFromBytes(b) },
+		golden: "08011205616c6963651a023034220a63617264696f6c6f67792a7f0a6d0a04686f6d652a650a067265636f726412026162180a220263642a05616c69636530023a02656640024a0230315080a0f8fa055a140a05616c696365120230341a0261622203626f62620230326a03626f62720b726f6c653a646f63746f727a07616c6c657267798201023033120e0a0c0a02636410011a023035200130023a08686f73706974616c4003481e5206646f63746f725a0230366001",
+	},
+	{
+		name:   "Name",
+		value:  user.NewName("alice", "04"),
+		decode: func(b []byte) (interface{}, error) { return user.NameFromBytes(b) },
+		golden: "08011205616c6963651a023034",
+	},
+	{
+		name:   "Group",
+		value:  user.NewGroup("cardiology", "04", map[string]user.Role{"04": user.RoleOwner, "06": user.RoleGuest}, testRoot()),
+		decode: func(b []byte) (interface{}, error) { return user.GroupFromBytes(b) },
+		golden: "0801120a63617264696f6c6f67791a02303422060a023034100422060a02303610012a7f0a6d0a04686f6d652a650a067265636f726412026162180a220263642a05616c69636530023a02656640024a0230315080a0f8fa055a140a05616c696365120230341a0261622203626f62620230326a03626f62720b726f6c653a646f63746f727a07616c6c657267798201023033120e0a0c0a02636410011a0230352001",
+	},
+	{
+		name:   "Request",
+		value:  testRequest(),
+		decode: func(b []byte) (interface{}, error) { return request.RequestFromBytes(b) },
+		golden: "0801120269641a06646f63746f72220230362a05616c6963653209726573706f6e6465723a0230374202616242026566480250015a0974726561746d656e746206646f63746f7262056e757273656a0230366a02303870027a056e757273657a06646f63746f72",
+	},
+	{
+		name:   "ReKey",
+		value:  rekey.NewReKey("alice", "04", "doctor", "06", "responder", "07", "09", 1600000000),
+		decode: func(b []byte) (interface{}, error) { return rekey.ReKeyFromBytes(b) },
+		golden: "08011205616c6963651a0230342206646f63746f722a0230363209726573706f6e6465723a023037420230394880a0f8fa05",
+	},
+	{
+		name:   "Receipt",
+		value:  audit.NewReceipt("id", "doctor", "06", "alice", "ab", "record", storage.Critical, 1600000000),
+		decode: func(b []byte) (interface{}, error) { return audit.ReceiptFromBytes(b) },
+		golden: "0801120269641a06646f63746f72220230362a05616c696365320261623a067265636f726440024880a0f8fa05",
+	},
+	{
+		name: "Delegation",
+		value: &delegation.Delegation{Patient: "alice", PatientKey: "04", Delegate: "doctor", DelegateKey: "06",
+			Scopes: []string{"create", "share"}, Expiration: 1600000000, GrantedBy: "04"},
+		decode: func(b []byte) (interface{}, error) { return delegation.DelegationFromBytes(b) },
+		golden: "08011205616c6963651a0230342206646f63746f722a0230363206637265617465320573686172653880a0f8fa0542023034",
+	},
+	{
+		name:   "DataRecord",
+		value:  testData(),
+		encode: func() []byte { return testData().ToRecord() },
+		decode: func(b []byte) (interface{}, error) { return storage.DataFromRecord(b) },
+		golden: "080112650a067265636f726412026162180a220263642a05616c69636530023a02656640024a0230315080a0f8fa055a140a05616c696365120230341a0261622203626f62620230326a03626f62720b726f6c653a646f63746f727a07616c6c657267798201023033",
+	},
+	{
+		name:   "KeyRecord",
+		value:  &storage.FileKey{Index: "cd", Used: 2, Key: "05", Published: true},
+		encode: func() []byte { return (&storage.FileKey{Index: "cd", Used: 2, Key: "05", Published: true}).ToRecord() },
+		decode: func(b []byte) (interface{}, error) { return storage.FileKeyFromRecord(b) },
+		golden: "0801120c0a02636410021a0230352001",
+	},
+	{
+		name: "StoragePayload",
+		value: &payload.StoragePayload{Action: payload.UserCreateData, Name: "alice", Target: []string{"doctor", "06"},
+			Key: "0a", Role: 1, OnBehalf: "04",
+			DataInfo: storage.DataInfo{Name: "record", Size: 10, Hash: "ab", Key: "05", Addr: "doctor", AccessType: storage.Regular,
+				Source: "ef", Version: 2, Prev: "01", Expiration: 1600000000, Origin: "bob", Policy: "role:doctor",
+				Category: "allergy", ForwardKey: "03"},
+			Request: *testRequest(),
+			Delegation: delegation.Delegation{Patient: "alice", PatientKey: "04", Delegate: "doctor", DelegateKey: "06",
+				Scopes: []string{"all"}, Expiration: 1600000000, GrantedBy: "04"},
+			ReKey: *rekey.NewReKey("alice", "04", "doctor", "06", "responder", "07", "09", 1600000000)},
+		decode: func(b []byte) (interface{}, error) { return payload.StoragePayloadFromBytes(b) },
+		golden: "0801100a1a05616c6963652206646f63746f72220230362a02306130013a4b0a067265636f7264100a1a026162220230352a06646f63746f7230013a02656640024a0230315080a0f8fa055a03626f62620b726f6c653a646f63746f726a07616c6c657267797202303342670801120269641a06646f63746f72220230362a05616c6963653209726573706f6e6465723a0230374202616242026566480250015a0974726561746d656e746206646f63746f7262056e757273656a0230366a02303870027a056e757273657a06646f63746f724a023034522808011205616c6963651a0230342206646f63746f722a0230363203616c6c3880a0f8fa05420230345a3208011205616c6963651a0230342206646f63746f722a0230363209726573706f6e6465723a023037420230394880a0f8fa05",
+	},
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	for _, c := range goldenCases {
+		data := c.bytes()
+		if hex.EncodeToString(data) != c.golden {
+			t.Errorf("%s: unexpected encoding\n%x", c.name, data)
+		}
+		if !protos.IsVersioned(data) {
+			t.Errorf("%s: encoding isn't versioned", c.name)
+		}
+		decoded, err := c.decode(data)
+		if err != nil {
+			t.Errorf("%s: failed to decode: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, c.value) {
+			t.Errorf("%s: unexpected decoded message\n%+v\n%+v", c.name, decoded, c.value)
+		}
+	}
+}
+
+// gobEncode encodes the value as the legacy state and payloads were encoded.
+func gobEncode(t *testing.T, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGobMigration(t *testing.T) {
+	// the legacy messages have only the fields known before the versioned encoding
+	repo := storage.NewRepo("home")
+	repo.INodes = append(repo.INodes, &storage.Data{Name: "record", Hash: "ab", Size: 10, KeyIndex: "cd", Addr: "alice", AccessType: storage.Critical})
+	keys := storage.NewFileKeyMap()
+	keys.Keys = append(keys.Keys, &storage.FileKey{Index: "cd", Used: 1, Key: "05"})
+	root := storage.NewRoot(repo, keys)
+	cases := []struct {
+		name   string
+		value  interface{ ToBytes() []byte }
+		decode func([]byte) (interface{}, error)
+	}{
+		{
+			name:   "User",
+			value:  &user.User{Name: "alice", PublicKey: "04", Groups: []string{"cardiology"}, Root: root},
+			decode: func(b []byte) (interface{}, error) { return user.UserFromBytes(b) },
+		},
+		{
+			name:   "Group",
+			value:  user.NewGroup("cardiology", "04", map[string]user.Role{"04": user.RoleOwner}, root),
+			decode: func(b []byte) (interface{}, error) { return user.GroupFromBytes(b) },
+		},
+		{
+			name:   "Request",
+			value:  request.NewRequest("id", "doctor", "06", "alice", "responder", "07", []string{"ab"}, storage.Regular),
+			decode: func(b []byte) (interface{}, error) { return request.RequestFromBytes(b) },
+		},
+		{
+			name: "StoragePayload",
+			value: &payload.StoragePayload{Action: payload.UserCreateData, Name: "alice", Target: []string{"doctor"},
+				DataInfo: storage.DataInfo{Name: "record", Size: 10, Hash: "ab", Key: "05", Addr: "doctor", AccessType: storage.Regular}},
+			decode: func(b []byte) (interface{}, error) { return payload.StoragePayloadFromBytes(b) },
+		},
+	}
+	for _, c := range cases {
+		legacy := gobEncode(t, c.value)
+		if protos.IsVersioned(legacy) {
+			t.Errorf("%s: gob encoding is versioned", c.name)
+		}
+		decoded, err := c.decode(legacy)
+		if err != nil {
+			t.Errorf("%s: failed to decode gob: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, c.value) {
+			t.Errorf("%s: unexpected decoded gob\n%+v\n%+v", c.name, decoded, c.value)
+		}
+		// the legacy message is rewritten in the versioned encoding
+		migrated := decoded.(interface{ ToBytes() []byte }).ToBytes()
+		if !protos.IsVersioned(migrated) {
+			t.Errorf("%s: migrated encoding isn't versioned", c.name)
+		}
+		decoded, err = c.decode(migrated)
+		if err != nil || !reflect.DeepEqual(decoded, c.value) {
+			t.Errorf("%s: unexpected migrated message %+v, %v", c.name, decoded, err)
+		}
+	}
+}
+
+func TestIsVersioned(t *testing.T) {
+	version := protowire.AppendVarint(protowire.AppendTag(nil, protos.SchemaVersionField, protowire.VarintType), protos.SchemaVersion)
+	name := protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), "alice")
+	cases := []struct {
+		name      string
+		data      []byte
+		versioned bool
+	}{
+		{"empty", nil, false},
+		{"version", version, true},
+		{"version and field", append(append([]byte{}, version...), name...), true},
+		{"version 0", protowire.AppendVarint(protowire.AppendTag(nil, protos.SchemaVersionField, protowire.VarintType), 0), false},
+		{"truncated version", version[:1], false},
+		{"version as bytes", protowire.AppendString(protowire.AppendTag(nil, protos.SchemaVersionField, protowire.BytesType), "1"), false},
+		{"version isn't first", append(append([]byte{}, name...), version...), false},
+		{"truncated field", append(append([]byte{}, version...), name[:len(name)-1]...), false},
+		{"invalid field number", append(append([]byte{}, version...), 0x00, 0x01), false},
+		{"gob", gobEncode(t, request.NewRequest("id", "doctor", "06", "alice", "responder", "07", nil, storage.Regular)), false},
+	}
+	for _, c := range cases {
+		if protos.IsVersioned(c.data) != c.versioned {
+			t.Errorf("%s: expected versioned %v", c.name, c.versioned)
+		}
+	}
+}
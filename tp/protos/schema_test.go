@@ -0,0 +1,148 @@
+package protos_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// scalarTypes are the scalar types used by healthcare.proto.
+var scalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+}
+
+// parseSchema builds the descriptor of the schema, without protoc.
+// The schema has only messages of scalar, message and repeated fields, so only they are parsed.
+func parseSchema(t *testing.T, filename string) protoreflect.FileDescriptor {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	separated := strings.NewReplacer("{", " { ", "}", " } ", ";", " ; ", "=", " = ").Replace(strings.Join(lines, "\n"))
+	tokens := strings.Fields(separated)
+	file := &descriptorpb.FileDescriptorProto{Name: proto.String(filename)}
+	var message *descriptorpb.DescriptorProto
+	for i := 0; i < len(tokens); {
+		switch {
+		case tokens[i] == "syntax":
+			file.Syntax = proto.String(strings.Trim(tokens[i+2], `"`))
+			i += 4
+		case tokens[i] == "package":
+			file.Package = proto.String(tokens[i+1])
+			i += 3
+		case tokens[i] == "option":
+			for tokens[i] != ";" {
+				i++
+			}
+			i++
+		case tokens[i] == "message":
+			message = &descriptorpb.DescriptorProto{Name: proto.String(tokens[i+1])}
+			file.MessageType = append(file.MessageType, message)
+			i += 3
+		case tokens[i] == "}":
+			message = nil
+			i++
+		case message != nil:
+			label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+			if tokens[i] == "repeated" {
+				label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+				i++
+			}
+			number, err := strconv.Atoi(tokens[i+3])
+			if err != nil || tokens[i+2] != "=" || tokens[i+4] != ";" {
+				t.Fatalf("invalid field of %s: %v", message.GetName(), tokens[i:i+5])
+			}
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(tokens[i+1]),
+				Number: proto.Int32(int32(number)),
+				Label:  label.Enum(),
+			}
+			if typ, ok := scalarTypes[tokens[i]]; ok {
+				field.Type = typ.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + file.GetPackage() + "." + tokens[i])
+			}
+			message.Field = append(message.Field, field)
+			i += 5
+		default:
+			t.Fatalf("unexpected token %s", tokens[i])
+		}
+	}
+	fd, err := protodesc.NewFile(file, new(protoregistry.Files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+// checkUnknownFields reports the fields of the message and its messages, which aren't in the schema
+// or don't match the type of the field.
+func checkUnknownFields(t *testing.T, name string, m protoreflect.Message) {
+	if len(m.GetUnknown()) > 0 {
+		t.Errorf("%s: unknown fields in %s: %x", name, m.Descriptor().Name(), m.GetUnknown())
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				checkUnknownFields(t, name, v.List().Get(i).Message())
+			}
+		default:
+			checkUnknownFields(t, name, v.Message())
+		}
+		return true
+	})
+}
+
+func TestSchema(t *testing.T) {
+	fd := parseSchema(t, "healthcare.proto")
+	for _, c := range goldenCases {
+		md := fd.Messages().ByName(protoreflect.Name(c.name))
+		if md == nil {
+			t.Errorf("%s isn't in the schema", c.name)
+			continue
+		}
+		data := c.bytes()
+		m := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(data, m); err != nil {
+			t.Errorf("%s: failed to decode by the schema: %v", c.name, err)
+			continue
+		}
+		checkUnknownFields(t, c.name, m)
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if !m.Has(fields.Get(i)) {
+				t.Errorf("%s: %s isn't encoded", c.name, fields.Get(i).Name())
+			}
+		}
+		// the deterministic encoding by the schema is the same as the encoding by the codec
+		out, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		if err != nil {
+			t.Errorf("%s: failed to encode by the schema: %v", c.name, err)
+		} else if !bytes.Equal(out, data) {
+			t.Errorf("%s: unexpected encoding by the schema\n%x\n%x", c.name, out, data)
+		}
+	}
+}
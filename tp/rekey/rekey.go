@@ -0,0 +1,79 @@
+package rekey
+
+import (
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+// ReKey is the proxy re-encryption key issued by the patient, which allows the proxy, i.e. the trusted party,
+// to re-encrypt the keys of the data of the patient for the recipient, i.e. the third party,
+// without decrypting them. The re-encryption key is encrypted for the proxy.
+type ReKey struct {
+	Patient      string
+	PatientKey   string
+	Proxy        string
+	ProxyKey     string
+	Recipient    string
+	RecipientKey string
+	Key          string
+	Expiration   int64 // The re-encryption key without expiration never expires.
+}
+
+// NewReKey is the construct for ReKey.
+func NewReKey(patient, patientKey, proxy, proxyKey, recipient, recipientKey, key string, expiration int64) *ReKey {
+	return &ReKey{
+		Patient:      patient,
+		PatientKey:   patientKey,
+		Proxy:        proxy,
+		ProxyKey:     proxyKey,
+		Recipient:    recipient,
+		RecipientKey: recipientKey,
+		Key:          key,
+		Expiration:   expiration,
+	}
+}
+
+// IsExpired reports whether the re-encryption key is expired at the unix time.
+func (k *ReKey) IsExpired(now int64) bool {
+	return k.Expiration != 0 && k.Expiration <= now
+}
+
+// ToBytes encodes the re-encryption key as the versioned ReKey message.
+func (k *ReKey) ToBytes() []byte {
+	e := protos.NewVersionedEncoder()
+	e.String(2, k.Patient)
+	e.String(3, k.PatientKey)
+	e.String(4, k.Proxy)
+	e.String(5, k.ProxyKey)
+	e.String(6, k.Recipient)
+	e.String(7, k.RecipientKey)
+	e.String(8, k.Key)
+	e.Int(9, k.Expiration)
+	return e.ToBytes()
+}
+
+// ReKeyFromBytes decodes the re-encryption key from the versioned ReKey message.
+func ReKeyFromBytes(data []byte) (*ReKey, error) {
+	k := &ReKey{}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		switch f.Num {
+		case 2:
+			k.Patient, err = f.String()
+		case 3:
+			k.PatientKey, err = f.String()
+		case 4:
+			k.Proxy, err = f.String()
+		case 5:
+			k.ProxyKey, err = f.String()
+		case 6:
+			k.Recipient, err = f.String()
+		case 7:
+			k.RecipientKey, err = f.String()
+		case 8:
+			k.Key, err = f.String()
+		case 9:
+			k.Expiration, err = f.Int()
+		}
+		return
+	})
+	return k, err
+}
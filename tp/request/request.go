@@ -0,0 +1,184 @@
+package request
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+var (
+	StatusUnset    uint = 0
+	StatusAccepted uint = 1
+	StatusRejected uint = 2
+)
+
+// Request of access to the data of patient.
+// RequestFrom is the user who processes the request, it is either trusted party
+// for third party requests, or patient itself for trusted party requests.
+type Request struct {
+	ID             string
+	RequestFrom    string
+	RequestFromKey string
+	UsernameFrom   string
+	UsernameTo     string
+	UsernameToKey  string
+	Hashes         []string
+	AccessType     uint
+	Status         uint
+	Purpose        string
+	// Trusted parties who approve critical requests, snapshotted from the patient.
+	// The request is opened only when Threshold of them approved it.
+	Approvers    []string
+	ApproverKeys []string
+	Threshold    uint
+	Approvals    []string
+}
+
+func NewRequest(id, requestFrom, requestFromKey, usernameFrom, usernameTo, usernameToKey string, hashes []string, accessType uint) *Request {
+	return &Request{
+		ID:             id,
+		RequestFrom:    requestFrom,
+		RequestFromKey: requestFromKey,
+		UsernameFrom:   usernameFrom,
+		UsernameTo:     usernameTo,
+		UsernameToKey:  usernameToKey,
+		Hashes:         hashes,
+		AccessType:     accessType,
+		Status:         StatusUnset,
+	}
+}
+
+// IsThirdParty reports whether the request is sent by the third party.
+func (r *Request) IsThirdParty() bool {
+	return r.RequestFrom != r.UsernameFrom
+}
+
+// IsMultiParty reports whether the request needs the approvals of several trusted parties.
+func (r *Request) IsMultiParty() bool {
+	return r.Threshold > 0
+}
+
+// Approver returns the name of the approver with the public key, or empty string if it isn't approver.
+func (r *Request) Approver(publicKey string) string {
+	for i, key := range r.ApproverKeys {
+		if key == publicKey && i < len(r.Approvers) {
+			return r.Approvers[i]
+		}
+	}
+	return ""
+}
+
+// HasApproved reports whether the approver has approved the request.
+func (r *Request) HasApproved(name string) bool {
+	for _, a := range r.Approvals {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Approve records the approval of the approver with the public key.
+// It returns false if the request is processed, or the user isn't approver or has approved already.
+func (r *Request) Approve(publicKey string) bool {
+	name := r.Approver(publicKey)
+	if name == "" || r.Status != StatusUnset || r.HasApproved(name) {
+		return false
+	}
+	r.Approvals = append(r.Approvals, name)
+	return true
+}
+
+// IsApproved reports whether the request has enough approvals to be accepted.
+func (r *Request) IsApproved() bool {
+	return uint(len(r.Approvals)) >= r.Threshold
+}
+
+// Process updates the status of the request.
+// Only the requests, which are not processed yet, can be processed.
+func (r *Request) Process(publicKey string, accept bool) bool {
+	if r.RequestFromKey != publicKey || r.Status != StatusUnset {
+		return false
+	}
+	if accept {
+		r.Status = StatusAccepted
+	} else {
+		r.Status = StatusRejected
+	}
+	return true
+}
+
+// ToBytes encodes the request as the versioned Request message.
+func (r *Request) ToBytes() []byte {
+	e := protos.NewVersionedEncoder()
+	e.String(2, r.ID)
+	e.String(3, r.RequestFrom)
+	e.String(4, r.RequestFromKey)
+	e.String(5, r.UsernameFrom)
+	e.String(6, r.UsernameTo)
+	e.String(7, r.UsernameToKey)
+	e.Strings(8, r.Hashes)
+	e.Uint(9, uint64(r.AccessType))
+	e.Uint(10, uint64(r.Status))
+	e.String(11, r.Purpose)
+	e.Strings(12, r.Approvers)
+	e.Strings(13, r.ApproverKeys)
+	e.Uint(14, uint64(r.Threshold))
+	e.Strings(15, r.Approvals)
+	return e.ToBytes()
+}
+
+// RequestFromBytes decodes the request from both the versioned Request message and legacy gob encoding.
+func RequestFromBytes(data []byte) (*Request, error) {
+	r := &Request{}
+	if !protos.IsVersioned(data) {
+		buf := bytes.NewBuffer(data)
+		dec := gob.NewDecoder(buf)
+		err := dec.Decode(r)
+		return r, err
+	}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		var v uint64
+		var str string
+		switch f.Num {
+		case 2:
+			r.ID, err = f.String()
+		case 3:
+			r.RequestFrom, err = f.String()
+		case 4:
+			r.RequestFromKey, err = f.String()
+		case 5:
+			r.UsernameFrom, err = f.String()
+		case 6:
+			r.UsernameTo, err = f.String()
+		case 7:
+			r.UsernameToKey, err = f.String()
+		case 8:
+			str, err = f.String()
+			r.Hashes = append(r.Hashes, str)
+		case 9:
+			v, err = f.Uint()
+			r.AccessType = uint(v)
+		case 10:
+			v, err = f.Uint()
+			r.Status = uint(v)
+		case 11:
+			r.Purpose, err = f.String()
+		case 12:
+			str, err = f.String()
+			r.Approvers = append(r.Approvers, str)
+		case 13:
+			str, err = f.String()
+			r.ApproverKeys = append(r.ApproverKeys, str)
+		case 14:
+			v, err = f.Uint()
+			r.Threshold = uint(v)
+		case 15:
+			str, err = f.String()
+			r.Approvals = append(r.Approvals, str)
+		}
+		return
+	})
+	return r, err
+}
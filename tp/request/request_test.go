@@ -0,0 +1,35 @@
+package request
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApprove(t *testing.T) {
+	r := NewRequest("id", "doctorA", "keyA", "patient", "responder", "keyR", []string{"hash"}, 2)
+	r.Approvers = []string{"doctorA", "doctorB", "doctorC"}
+	r.ApproverKeys = []string{"keyA", "keyB", "keyC"}
+	r.Threshold = 2
+	if r.Approve("keyR") {
+		t.Error("requester approved the request")
+	}
+	if !r.Approve("keyB") || r.IsApproved() {
+		t.Error("unexpected approval of doctorB")
+	}
+	if r.Approve("keyB") {
+		t.Error("doctorB approved the request twice")
+	}
+	if !r.Approve("keyA") || !r.IsApproved() {
+		t.Error("request isn't approved by doctorA and doctorB")
+	}
+	if !r.Process("keyA", true) || r.Approve("keyC") {
+		t.Error("processed request is approved")
+	}
+	decoded, err := RequestFromBytes(r.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, decoded) {
+		t.Errorf("decoded request %+v, expected %+v", decoded, r)
+	}
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/tp/request"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+// Sets the trusted parties who approve critical requests to the data of the user.
+// The user and the approvers must be in the name registry, and the threshold 0 removes the approvers.
+func (sss *StorageState) SetApprovers(username, publicKey string, threshold uint, approvers []string) error {
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	// critical requests look up the approvers of the patient by its name
+	n, err := sss.GetName(username)
+	if err != nil {
+		return err
+	}
+	if n == nil || n.PublicKey != publicKey {
+		return &processor.InvalidTransactionError{Msg: "user isn't in the name registry"}
+	}
+	if threshold == 0 && len(approvers) > 0 {
+		return &processor.InvalidTransactionError{Msg: "threshold must be positive"}
+	}
+	if threshold > uint(len(approvers)) {
+		return &processor.InvalidTransactionError{Msg: "threshold is greater than the number of approvers"}
+	}
+	if len(approvers) > user.MaxApprovers {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("more than %d approvers", user.MaxApprovers)}
+	}
+	keys := make([]string, 0, len(approvers))
+	for i, name := range approvers {
+		for _, other := range approvers[:i] {
+			if other == name {
+				return &processor.InvalidTransactionError{Msg: fmt.Sprint("duplicate approver: ", name)}
+			}
+		}
+		n, err := sss.GetName(name)
+		if err != nil {
+			return err
+		}
+		if n == nil {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprint("approver doesn't exists: ", name)}
+		}
+		if n.PublicKey == publicKey {
+			return &processor.InvalidTransactionError{Msg: "patient can't approve its own requests"}
+		}
+		keys = append(keys, n.PublicKey)
+	}
+	u.SetApprovers(approvers, keys, threshold)
+	return sss.saveUser(u, address)
+}
+
+// Records the approval of the multi-party request by the approver, and returns the request.
+func (sss *StorageState) ApproveRequest(id, publicKey string) (*request.Request, error) {
+	r, err := sss.GetRequest(MakeAddress(AddressTypeRequest, id, publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsMultiParty() {
+		return nil, &processor.InvalidTransactionError{Msg: "request doesn't need approvals"}
+	}
+	if r.Status != request.StatusUnset {
+		return nil, &processor.InvalidTransactionError{Msg: "request is already processed"}
+	}
+	if !r.Approve(publicKey) {
+		return nil, &processor.InvalidTransactionError{Msg: "request is already approved by the user"}
+	}
+	return r, sss.saveRequest(r)
+}
+
+// Snapshots the approvers of the patient into the critical request.
+// The request receiver must be one of the approvers, as the data is opened by it.
+// The request names the patient only by username, so the patient without name registry entry is rejected
+// rather than skipping the approvals the patient may require.
+func (sss *StorageState) setRequestApprovers(r *request.Request) error {
+	n, err := sss.GetName(r.UsernameFrom)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return &processor.InvalidTransactionError{Msg: "patient isn't in the name registry, the name must be claimed before critical requests"}
+	}
+	patient, err := sss.GetUser(MakeAddress(AddressTypeUser, n.Name, n.PublicKey))
+	if err != nil {
+		return err
+	}
+	if patient.ApprovalThreshold == 0 {
+		return nil
+	}
+	r.Approvers = patient.Approvers
+	r.ApproverKeys = patient.ApproverKeys
+	r.Threshold = patient.ApprovalThreshold
+	if r.Approver(r.RequestFromKey) == "" {
+		return &processor.InvalidTransactionError{Msg: "request receiver isn't approver of the patient"}
+	}
+	return nil
+}
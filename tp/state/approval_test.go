@@ -0,0 +1,42 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"healthcare-system-sawtooth/tp/request"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+func TestSetRequestApprovers(t *testing.T) {
+	sss, _ := newMockState(1600000000)
+	createTestUsers(t, sss, "patient", "unprotected", "doctorA", "doctorB", "doctorC")
+	// the patient created before the name registry can't be resolved by username
+	if err := sss.saveUser(user.GenerateUser("legacy", testKey("legacy")), MakeAddress(AddressTypeUser, "legacy", testKey("legacy"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := sss.SetApprovers("patient", testKey("patient"), 2, []string{"doctorA", "doctorB"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		patient, receiver string
+		approvers         []string
+		ok                bool
+	}{
+		{"patient", "doctorA", []string{"doctorA", "doctorB"}, true},
+		{"patient", "doctorC", nil, false}, // the receiver opens the data, so it must approve
+		{"unprotected", "doctorC", nil, true},
+		{"legacy", "doctorA", nil, false},
+		{"stranger", "doctorA", nil, false},
+	}
+	for _, c := range cases {
+		r := request.NewRequest("id", c.receiver, testKey(c.receiver), c.patient, "responder", testKey("responder"), []string{testHash("record")}, storage.Critical)
+		err := sss.setRequestApprovers(r)
+		if (err == nil) != c.ok {
+			t.Errorf("%s to %s: unexpected result %v", c.patient, c.receiver, err)
+		} else if c.ok && !reflect.DeepEqual(r.Approvers, c.approvers) {
+			t.Errorf("%s to %s: unexpected approvers %v", c.patient, c.receiver, r.Approvers)
+		}
+	}
+}
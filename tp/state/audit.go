@@ -0,0 +1,66 @@
+package state
+
+import (
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/tp/audit"
+)
+
+// Records the access of the user to the data shared by the owner.
+// The receipt is appended to the audit log of the owner, and of the patient the data originates from.
+// The access must not be expired.
+func (sss *StorageState) AccessUserData(username, publicKey, ownerName, ownerKey, hash, id string) error {
+	_, err := sss.GetUser(MakeAddress(AddressTypeUser, username, publicKey))
+	if err != nil {
+		return err
+	}
+	grant, err := sss.GetUserData(ownerName, ownerKey, hash, username)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return &processor.InvalidTransactionError{Msg: "data isn't shared with the user"}
+	}
+	now, err := sss.GetBlockTimestamp()
+	if err != nil {
+		return err
+	}
+	if grant.IsExpired(now) {
+		return &processor.InvalidTransactionError{Msg: "access to the data is expired"}
+	}
+	r := audit.NewReceipt(id, username, publicKey, ownerName, hash, grant.Name, grant.AccessType, now)
+	err = sss.saveReceipt(r, MakeAuditAddress(ownerName, ownerKey, id))
+	if err != nil || grant.Origin == "" {
+		return err
+	}
+	// the patient registered before the name registry can't be resolved
+	patient, err := sss.GetName(grant.Origin)
+	if err != nil || patient == nil {
+		return err
+	}
+	address := MakeAuditAddress(patient.Name, patient.PublicKey, id)
+	if address == MakeAuditAddress(ownerName, ownerKey, id) {
+		return nil
+	}
+	return sss.saveReceipt(r, address)
+}
+
+// Appends the receipt to the audit log, the receipt already in the log can't be overwritten.
+func (sss *StorageState) saveReceipt(r *audit.Receipt, address string) error {
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return err
+	}
+	if len(results[address]) > 0 {
+		return &processor.InvalidTransactionError{Msg: "receipt already exists"}
+	}
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: r.ToBytes(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"testing"
+
+	"healthcare-system-sawtooth/tp/audit"
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+// getReceipt returns the receipt in the audit log of the user by id, or nil if it doesn't exist.
+func getReceipt(t *testing.T, c *mockContext, name, id string) *audit.Receipt {
+	data, ok := c.state[MakeAuditAddress(name, testKey(name), id)]
+	if !ok {
+		return nil
+	}
+	r, err := audit.ReceiptFromBytes(data)
+	if err != nil {
+		t.Fatalf("failed to decode receipt: %v", err)
+	}
+	return r
+}
+
+func TestAccessUserData(t *testing.T) {
+	now := int64(1600000000)
+	sss, c := newMockState(now)
+	createTestUsers(t, sss, "patient", "doctor", "responder")
+	record := testData("record", "doctor", storage.Regular)
+	record.Expiration = now + 60
+	if err := sss.CreateUserData("patient", testKey("patient"), record); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sss.AccessUserData("doctor", testKey("doctor"), "patient", testKey("patient"), record.Hash, "read"); err != nil {
+		t.Fatal(err)
+	}
+	expected := audit.NewReceipt("read", "doctor", testKey("doctor"), "patient", record.Hash, record.Name, storage.Regular, now)
+	if r := getReceipt(t, c, "patient", "read"); r == nil || *r != *expected {
+		t.Errorf("unexpected receipt of owner %+v", r)
+	}
+	if r := getReceipt(t, c, "doctor", "read"); r != nil {
+		t.Errorf("receipt is stored in the log of the reader: %+v", r)
+	}
+
+	// the receipt of the data shared further is stored in the log of the patient too
+	further := testData("record", "responder", storage.Regular)
+	further.Expiration = record.Expiration
+	further.Source = record.Hash
+	if err := sss.ShareUserData("doctor", testKey("doctor"), "patient", testKey("patient"), "", further); err != nil {
+		t.Fatal(err)
+	}
+	if err := sss.AccessUserData("responder", testKey("responder"), "doctor", testKey("doctor"), further.Hash, "further"); err != nil {
+		t.Fatal(err)
+	}
+	expected = audit.NewReceipt("further", "responder", testKey("responder"), "doctor", further.Hash, further.Name, storage.Regular, now)
+	for _, name := range []string{"doctor", "patient"} {
+		if r := getReceipt(t, c, name, "further"); r == nil || *r != *expected {
+			t.Errorf("unexpected receipt of %s %+v", name, r)
+		}
+	}
+
+	cases := []struct {
+		name, reader, owner, hash, id string
+	}{
+		{"duplicate", "doctor", "patient", record.Hash, "read"},
+		{"not shared", "responder", "patient", record.Hash, "not-shared"},
+		{"unknown data", "doctor", "patient", testHash("unknown"), "unknown-data"},
+		{"unknown reader", "stranger", "patient", record.Hash, "unknown-reader"},
+	}
+	for _, tc := range cases {
+		if err := sss.AccessUserData(tc.reader, testKey(tc.reader), tc.owner, testKey(tc.owner), tc.hash, tc.id); err == nil {
+			t.Errorf("%s: access is recorded", tc.name)
+		}
+	}
+	if r := getReceipt(t, c, "patient", "read"); r == nil || r.Reader != "doctor" {
+		t.Errorf("duplicate receipt overwrites the receipt: %+v", r)
+	}
+	if r := getReceipt(t, c, "patient", "not-shared"); r != nil {
+		t.Errorf("receipt of access to data which isn't shared: %+v", r)
+	}
+
+	c.setBlockTimestamp(now + 60)
+	if err := sss.AccessUserData("doctor", testKey("doctor"), "patient", testKey("patient"), record.Hash, "expired"); err == nil {
+		t.Errorf("expired access is recorded")
+	}
+}
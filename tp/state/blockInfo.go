@@ -0,0 +1,82 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Block info transaction family stores information of the committed blocks.
+// It's used as the deterministic source of time in the transaction processor.
+var (
+	BlockInfoNamespace     = "00b10c"
+	BlockInfoConfigAddress = BlockInfoNamespace + "01" + strings.Repeat("0", 62)
+)
+
+// Field numbers of BlockInfoConfig.latest_block and BlockInfo.timestamp
+const (
+	blockInfoConfigLatestBlock protowire.Number = 1
+	blockInfoTimestamp         protowire.Number = 5
+)
+
+// MakeBlockInfoAddress returns the address of the block info by block number.
+func MakeBlockInfoAddress(blockNum uint64) string {
+	return fmt.Sprintf("%s00%062x", BlockInfoNamespace, blockNum)
+}
+
+// Gets the timestamp of the latest block in unix seconds
+func (sss *StorageState) GetBlockTimestamp() (int64, error) {
+	results, err := sss.context.GetState([]string{BlockInfoConfigAddress})
+	if err != nil {
+		return 0, err
+	}
+	if len(results[BlockInfoConfigAddress]) == 0 {
+		return 0, &processor.InvalidTransactionError{Msg: "block info doesn't exists"}
+	}
+	latestBlock, err := getVarintField(results[BlockInfoConfigAddress], blockInfoConfigLatestBlock)
+	if err != nil {
+		return 0, &processor.InternalError{Msg: fmt.Sprint("failed to decode block info config: ", err)}
+	}
+	address := MakeBlockInfoAddress(latestBlock)
+	results, err = sss.context.GetState([]string{address})
+	if err != nil {
+		return 0, err
+	}
+	if len(results[address]) == 0 {
+		return 0, &processor.InvalidTransactionError{Msg: "block info doesn't exists"}
+	}
+	timestamp, err := getVarintField(results[address], blockInfoTimestamp)
+	if err != nil {
+		return 0, &processor.InternalError{Msg: fmt.Sprint("failed to decode block info: ", err)}
+	}
+	return int64(timestamp), nil
+}
+
+// getVarintField returns the value of varint field in the protobuf message.
+// The field of zero value is omitted by proto3, so 0 is returned if the field doesn't exist.
+// If the field is repeated, the last value wins as in protobuf.
+func getVarintField(data []byte, field protowire.Number) (uint64, error) {
+	var value uint64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num == field {
+			if typ != protowire.VarintType {
+				return 0, fmt.Errorf("invalid wire type %d of field %d", typ, field)
+			}
+			value, n = protowire.ConsumeVarint(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return value, nil
+}
@@ -0,0 +1,47 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestGetBlockTimestamp(t *testing.T) {
+	// the fields of zero value are omitted, so the empty config points to the block 0
+	targetCount := protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 256)
+	blockNum := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 7)
+	timestamp := protowire.AppendVarint(protowire.AppendTag(nil, blockInfoTimestamp, protowire.VarintType), 1600000000)
+	latestBlock := protowire.AppendVarint(protowire.AppendTag(nil, blockInfoConfigLatestBlock, protowire.VarintType), 7)
+	cases := []struct {
+		name              string
+		config, blockInfo []byte
+		block             uint64
+		expected          int64
+		ok                bool
+	}{
+		{"latest block", latestBlock, append(append([]byte{}, blockNum...), timestamp...), 7, 1600000000, true},
+		{"empty config", targetCount, timestamp, 0, 1600000000, true},
+		{"timestamp 0", latestBlock, blockNum, 7, 0, true},
+		{"last value wins", append(append([]byte{}, targetCount...), latestBlock...), timestamp, 7, 1600000000, true},
+		{"malformed config", latestBlock[:1], timestamp, 0, 0, false},
+		{"latest block as bytes", protowire.AppendString(protowire.AppendTag(nil, blockInfoConfigLatestBlock, protowire.BytesType), "7"), timestamp, 0, 0, false},
+		{"malformed block info", latestBlock, timestamp[:2], 7, 0, false},
+	}
+	for _, c := range cases {
+		ctx := &mockContext{state: map[string][]byte{
+			BlockInfoConfigAddress:        c.config,
+			MakeBlockInfoAddress(c.block): c.blockInfo,
+		}}
+		timestamp, err := NewStorageState(ctx).GetBlockTimestamp()
+		if (err == nil) != c.ok || timestamp != c.expected {
+			t.Errorf("%s: unexpected timestamp %d, %v", c.name, timestamp, err)
+		}
+	}
+
+	// the block info transaction processor isn't running
+	_, err := NewStorageState(&mockContext{state: map[string][]byte{}}).GetBlockTimestamp()
+	if _, ok := err.(*processor.InvalidTransactionError); !ok {
+		t.Errorf("unexpected error without block info %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/tp/delegation"
+)
+
+// Gets the delegation of the patient to the delegate.
+// If the delegation doesn't exist, nil will be returned.
+func (sss *StorageState) GetDelegation(patient, patientKey, delegateKey string) (*delegation.Delegation, error) {
+	address := MakeDelegationAddress(patient, patientKey, delegateKey)
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) == 0 {
+		return nil, nil
+	}
+	d, err := delegation.DelegationFromBytes(results[address])
+	if err != nil {
+		return nil, &processor.InternalError{Msg: fmt.Sprint("failed to decode delegation: ", err)}
+	}
+	return d, nil
+}
+
+// Grants the delegation of the patient to the delegate.
+// The delegation is granted by the patient, or by the admin for the patient who can't manage keys.
+// The existing delegation to the delegate is replaced.
+func (sss *StorageState) GrantDelegation(signerKey string, d delegation.Delegation) error {
+	if signerKey != d.PatientKey {
+		isAdmin, err := sss.IsAdmin(signerKey)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			return &processor.InvalidTransactionError{Msg: "only the patient or admins can grant delegation"}
+		}
+	}
+	if d.DelegateKey == d.PatientKey {
+		return &processor.InvalidTransactionError{Msg: "patient can't delegate to itself"}
+	}
+	_, err := sss.GetUser(MakeAddress(AddressTypeUser, d.Patient, d.PatientKey))
+	if err != nil {
+		return err
+	}
+	_, err = sss.GetUser(MakeAddress(AddressTypeUser, d.Delegate, d.DelegateKey))
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: "delegate doesn't exists"}
+	}
+	for _, scope := range d.Scopes {
+		if !delegation.ValidScope(scope) {
+			return &processor.InvalidTransactionError{Msg: fmt.Sprint("invalid scope: ", scope)}
+		}
+	}
+	if d.Expiration != 0 {
+		now, err := sss.GetBlockTimestamp()
+		if err != nil {
+			return err
+		}
+		if d.Expiration <= now {
+			return &processor.InvalidTransactionError{Msg: "expiration must be in the future"}
+		}
+	}
+	r := delegation.NewDelegation(d.Patient, d.PatientKey, d.Delegate, d.DelegateKey, d.Scopes, d.Expiration, signerKey)
+	return sss.saveDelegation(r, MakeDelegationAddress(d.Patient, d.PatientKey, d.DelegateKey))
+}
+
+// Revokes the delegation of the patient to the delegate.
+// The delegation is revoked by the patient, the admin or the delegate itself.
+func (sss *StorageState) RevokeDelegation(signerKey, patient, patientKey, delegateKey string) error {
+	d, err := sss.GetDelegation(patient, patientKey, delegateKey)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "delegation doesn't exist"}
+	}
+	if signerKey != patientKey && signerKey != delegateKey {
+		isAdmin, err := sss.IsAdmin(signerKey)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			return &processor.InvalidTransactionError{Msg: "only the patient, the delegate or admins can revoke delegation"}
+		}
+	}
+	return sss.deleteRecord(MakeDelegationAddress(patient, patientKey, delegateKey))
+}
+
+// Verifies the delegation of the patient allows the delegate to act on behalf of the patient in the scope
+func (sss *StorageState) VerifyDelegation(d *delegation.Delegation, scope string) error {
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "signer isn't delegate of the patient"}
+	}
+	if !d.HasScope(scope) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("delegation doesn't allow %s", scope)}
+	}
+	if d.Expiration == 0 {
+		return nil
+	}
+	now, err := sss.GetBlockTimestamp()
+	if err != nil {
+		return err
+	}
+	if d.IsExpired(now) {
+		return &processor.InvalidTransactionError{Msg: "delegation is expired"}
+	}
+	return nil
+}
+
+func (sss *StorageState) saveDelegation(d *delegation.Delegation, address string) error {
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: d.ToBytes(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	return nil
+}
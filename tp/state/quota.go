@@ -0,0 +1,58 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+)
+
+// Accounts the new data of the user against the quotas set in the settings
+func (sss *StorageState) addUsage(username, publicKey string, size int64) error {
+	maxDataSize, err := sss.GetIntSetting(SettingMaxDataSize, DefaultMaxDataSize)
+	if err != nil {
+		return err
+	}
+	if maxDataSize > 0 && size > maxDataSize {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("data is larger than %d bytes", maxDataSize)}
+	}
+	maxRecords, err := sss.GetIntSetting(SettingMaxRecords, DefaultMaxRecords)
+	if err != nil {
+		return err
+	}
+	maxUserSize, err := sss.GetIntSetting(SettingMaxUserSize, DefaultMaxUserSize)
+	if err != nil {
+		return err
+	}
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	if maxRecords > 0 && u.Records >= uint64(maxRecords) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("user has reached the limit of %d data", maxRecords)}
+	}
+	if maxUserSize > 0 && u.DataSize+size > maxUserSize {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("user has reached the limit of %d bytes", maxUserSize)}
+	}
+	u.Records++
+	u.DataSize += size
+	return sss.saveUser(u, address)
+}
+
+// Releases the quotas used by the removed data of the user
+func (sss *StorageState) releaseUsage(username, publicKey string, size int64) error {
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	// data stored before the accounting isn't counted
+	if u.Records > 0 {
+		u.Records--
+	}
+	u.DataSize -= size
+	if u.DataSize < 0 {
+		u.DataSize = 0
+	}
+	return sss.saveUser(u, address)
+}
@@ -0,0 +1,236 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/policy"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+// Gets the data of the user by hash and address.
+// If the data doesn't exist, nil will be returned.
+func (sss *StorageState) GetUserData(username, publicKey, hash, addr string) (*storage.Data, error) {
+	dataBytes, err := sss.getRecord(MakeDataAddress(username, publicKey, hash, addr))
+	if err != nil {
+		return nil, err
+	}
+	if len(dataBytes) > 0 {
+		d, err := storage.DataFromRecord(dataBytes)
+		if err != nil {
+			return nil, &processor.InternalError{Msg: fmt.Sprint("failed to decode data: ", err)}
+		}
+		return d, nil
+	}
+	// data of the legacy user is still stored in the user
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, username, publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if u.Root == nil || u.Root.Repo == nil {
+		return nil, nil
+	}
+	return u.Root.Repo.FindData(hash, addr), nil
+}
+
+// Gets the user whose data will be changed.
+// Data and keys of the legacy user are moved from the user to their own addresses.
+func (sss *StorageState) getUserForData(username, publicKey string) (*user.User, error) {
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Root == nil {
+		return u, nil
+	}
+	var datas []*storage.Data
+	if u.Root.Repo != nil {
+		for _, iNode := range u.Root.Repo.INodes {
+			switch iNode.(type) {
+			case *storage.Data:
+				datas = append(datas, iNode.(*storage.Data))
+			}
+		}
+	}
+	// versions updated before the next version was stored are linked by their previous version
+	for _, d := range datas {
+		if prev := u.Root.Repo.FindData(d.Prev, d.Addr); prev != nil && prev.Next == "" {
+			prev.Next = d.Hash
+		}
+	}
+	for _, d := range datas {
+		err = sss.saveData(username, publicKey, d)
+		if err != nil {
+			return nil, err
+		}
+		u.Records++
+		u.DataSize += d.Size
+	}
+	if u.Root.Keys != nil {
+		for _, key := range u.Root.Keys.Keys {
+			err = sss.setRecord(MakeKeyAddress(username, publicKey, key.Index), key.ToRecord())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	u.Root = nil
+	return u, sss.saveUser(u, address)
+}
+
+// Stores the data with the key used to encrypt it
+func (sss *StorageState) createData(username, publicKey string, info storage.DataInfo) error {
+	d, err := sss.GetUserData(username, publicKey, info.Hash, info.Addr)
+	if err != nil {
+		return err
+	}
+	if d != nil {
+		return &processor.InvalidTransactionError{Msg: "data already exists"}
+	}
+	if !storage.ValidCategory(info.Category) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprint("invalid category: ", info.Category)}
+	}
+	err = policy.Validate(info.Policy)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid policy: %v", err)}
+	}
+	err = sss.checkAccessType(info.AccessType)
+	if err != nil {
+		return err
+	}
+	err = sss.addUsage(username, publicKey, info.Size)
+	if err != nil {
+		return err
+	}
+	// the copy shared with the trusted party holding the re-encryption key has the forward key only
+	var keyIndex string
+	if info.Key != "" {
+		keyIndex, err = sss.addKey(username, publicKey, info.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return sss.saveData(username, publicKey, storage.NewDataFromInfo(info, keyIndex))
+}
+
+func (sss *StorageState) saveData(username, publicKey string, d *storage.Data) error {
+	return sss.setRecord(MakeDataAddress(username, publicKey, d.Hash, d.Addr), d.ToRecord())
+}
+
+// Removes the data and releases the key used to encrypt it.
+// The previous version of the data can be updated again.
+func (sss *StorageState) deleteData(username, publicKey string, d *storage.Data) error {
+	err := sss.deleteRecord(MakeDataAddress(username, publicKey, d.Hash, d.Addr))
+	if err != nil {
+		return err
+	}
+	if d.KeyIndex != "" {
+		err = sss.removeKey(username, publicKey, d.KeyIndex)
+		if err != nil {
+			return err
+		}
+	}
+	err = sss.releaseUsage(username, publicKey, d.Size)
+	if err != nil {
+		return err
+	}
+	if d.Prev == "" {
+		return nil
+	}
+	prev, err := sss.GetUserData(username, publicKey, d.Prev, d.Addr)
+	if err != nil {
+		return err
+	}
+	if prev == nil || prev.Next != d.Hash {
+		return nil
+	}
+	prev.Next = ""
+	return sss.saveData(username, publicKey, prev)
+}
+
+// Gets the key of the user by index.
+// If the key doesn't exist, nil will be returned.
+func (sss *StorageState) getKey(username, publicKey, index string) (*storage.FileKey, error) {
+	keyBytes, err := sss.getRecord(MakeKeyAddress(username, publicKey, index))
+	if err != nil {
+		return nil, err
+	}
+	if len(keyBytes) == 0 {
+		return nil, nil
+	}
+	key, err := storage.FileKeyFromRecord(keyBytes)
+	if err != nil {
+		return nil, &processor.InternalError{Msg: fmt.Sprint("failed to decode key: ", err)}
+	}
+	return key, nil
+}
+
+// Adds the key used by the data, and returns its index
+func (sss *StorageState) addKey(username, publicKey, key string) (string, error) {
+	index := crypto.SHA512HexFromHex(key)
+	fileKey, err := sss.getKey(username, publicKey, index)
+	if err != nil {
+		return "", err
+	}
+	if fileKey == nil {
+		fileKey = &storage.FileKey{Index: index, Key: key}
+	}
+	fileKey.Used++
+	return index, sss.setRecord(MakeKeyAddress(username, publicKey, index), fileKey.ToRecord())
+}
+
+// Decreases the used count of key, the key which is not used anymore is removed
+func (sss *StorageState) removeKey(username, publicKey, index string) error {
+	fileKey, err := sss.getKey(username, publicKey, index)
+	if err != nil || fileKey == nil {
+		return err
+	}
+	fileKey.Used--
+	address := MakeKeyAddress(username, publicKey, index)
+	if fileKey.Used <= 0 {
+		return sss.deleteRecord(address)
+	}
+	return sss.setRecord(address, fileKey.ToRecord())
+}
+
+func (sss *StorageState) getRecord(address string) ([]byte, error) {
+	recordBytes, ok := sss.recordCache[address]
+	if ok {
+		return recordBytes, nil
+	}
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	sss.recordCache[address] = results[address]
+	return results[address], nil
+}
+
+func (sss *StorageState) setRecord(address string, recordBytes []byte) error {
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: recordBytes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	sss.recordCache[address] = recordBytes
+	return nil
+}
+
+func (sss *StorageState) deleteRecord(address string) error {
+	addresses, err := sss.context.DeleteState([]string{address})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in delete response"}
+	}
+	sss.recordCache[address] = nil
+	return nil
+}
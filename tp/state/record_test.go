@@ -0,0 +1,235 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+func TestGetUserForDataMigration(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	createTestUsers(t, sss, "migrated")
+	// the legacy user stores the data and the keys in the root,
+	// and the second version was updated before the next version was stored
+	legacy := user.GenerateUser("legacy", testKey("legacy"))
+	legacy.Root = storage.GenerateRoot()
+	v1 := testData("record", "legacy", storage.Regular)
+	v2 := testData("record-v2", "legacy", storage.Regular)
+	v2.Key = v1.Key
+	v2.Version = 2
+	v2.Prev = v1.Hash
+	shared := testData("record", "doctor", storage.Critical)
+	for _, info := range []storage.DataInfo{v1, v2, shared} {
+		if err := legacy.Root.CreateData(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	address := MakeAddress(AddressTypeUser, "legacy", testKey("legacy"))
+	if err := sss.saveUser(legacy, address); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data of the legacy user is read from the root before the migration
+	d, err := sss.GetUserData("legacy", testKey("legacy"), shared.Hash, "doctor")
+	if err != nil || d == nil || d.Name != shared.Name {
+		t.Errorf("legacy data isn't found: %+v, %v", d, err)
+	}
+
+	u, err := sss.getUserForData("legacy", testKey("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Root != nil || u.Records != 3 || u.DataSize != v1.Size+v2.Size+shared.Size {
+		t.Errorf("unexpected migrated user %+v", u)
+	}
+	// the migration is stored, so it's read without the cache
+	sss = NewStorageState(c)
+	u, err = sss.GetUser(address)
+	if err != nil || u.Root != nil || u.Records != 3 {
+		t.Errorf("migrated user isn't stored: %+v, %v", u, err)
+	}
+	for _, info := range []storage.DataInfo{v1, v2, shared} {
+		d, err := sss.GetUserData("legacy", testKey("legacy"), info.Hash, info.Addr)
+		if err != nil || d == nil || d.Name != info.Name || d.KeyIndex != crypto.SHA512HexFromHex(info.Key) {
+			t.Errorf("%s isn't migrated: %+v, %v", info.Name, d, err)
+		}
+	}
+	d, _ = sss.GetUserData("legacy", testKey("legacy"), v1.Hash, v1.Addr)
+	if d == nil || d.Next != v2.Hash {
+		t.Errorf("previous version isn't linked to the next: %+v", d)
+	}
+	for _, info := range []storage.DataInfo{v1, shared} {
+		key, err := sss.getKey("legacy", testKey("legacy"), crypto.SHA512HexFromHex(info.Key))
+		if err != nil || key == nil || key.Key != info.Key {
+			t.Errorf("key of %s isn't migrated: %+v, %v", info.Name, key, err)
+		}
+	}
+	key, _ := sss.getKey("legacy", testKey("legacy"), crypto.SHA512HexFromHex(v1.Key))
+	if key == nil || key.Used != 2 {
+		t.Errorf("unexpected used count of shared key: %+v", key)
+	}
+
+	// the migrated user is returned as it is
+	stored := len(c.state)
+	u, err = sss.getUserForData("migrated", testKey("migrated"))
+	if err != nil || u.Root != nil || u.Records != 0 || len(c.state) != stored {
+		t.Errorf("unexpected user %+v, %v", u, err)
+	}
+	if _, err = sss.getUserForData("stranger", testKey("stranger")); err == nil {
+		t.Errorf("data of unknown user")
+	}
+}
+
+func TestCreateData(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	createTestUsers(t, sss, "patient")
+	c.setSetting(SettingAccessTypes, fmt.Sprint(storage.Regular))
+	invalid := func(name string, f func(info *storage.DataInfo)) storage.DataInfo {
+		info := testData(name, "patient", storage.Regular)
+		f(&info)
+		return info
+	}
+	record := testData("record", "patient", storage.Regular)
+	cases := []struct {
+		name string
+		info storage.DataInfo
+		ok   bool
+	}{
+		{"record", record, true},
+		{"exists", record, false},
+		{"category", invalid("category", func(info *storage.DataInfo) { info.Category = "unknown" }), false},
+		{"policy", invalid("policy", func(info *storage.DataInfo) { info.Policy = "role=doctor" }), false},
+		{"access type", invalid("access type", func(info *storage.DataInfo) { info.AccessType = storage.Critical }), false},
+		{"quota", invalid("quota", func(info *storage.DataInfo) { info.Size = DefaultMaxDataSize + 1 }), false},
+		{"same key", invalid("same key", func(info *storage.DataInfo) { info.Key = record.Key }), true},
+	}
+	for _, tc := range cases {
+		if err := sss.createData("patient", testKey("patient"), tc.info); (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected result %v", tc.name, err)
+		}
+	}
+	for _, tc := range cases[2:6] {
+		if d, _ := sss.GetUserData("patient", testKey("patient"), tc.info.Hash, tc.info.Addr); d != nil {
+			t.Errorf("%s: invalid data is stored", tc.name)
+		}
+	}
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, "patient", testKey("patient")))
+	if err != nil || u.Records != 2 || u.DataSize != 2*record.Size {
+		t.Errorf("unexpected usage %+v, %v", u, err)
+	}
+	key, err := sss.getKey("patient", testKey("patient"), crypto.SHA512HexFromHex(record.Key))
+	if err != nil || key == nil || key.Used != 2 {
+		t.Errorf("unexpected key %+v, %v", key, err)
+	}
+}
+
+func TestDeleteData(t *testing.T) {
+	sss, _ := newMockState(1600000000)
+	createTestUsers(t, sss, "patient")
+	v1 := testData("record", "patient", storage.Regular)
+	v2 := testData("record-v2", "patient", storage.Regular)
+	v2.Key = v1.Key
+	v2.Prev = v1.Hash
+	for _, info := range []storage.DataInfo{v1, v2} {
+		if err := sss.createData("patient", testKey("patient"), info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev, _ := sss.GetUserData("patient", testKey("patient"), v1.Hash, v1.Addr)
+	prev.Next = v2.Hash
+	if err := sss.saveData("patient", testKey("patient"), prev); err != nil {
+		t.Fatal(err)
+	}
+	index := crypto.SHA512HexFromHex(v1.Key)
+
+	// the previous version can be updated again, and the key is still used by it
+	d, _ := sss.GetUserData("patient", testKey("patient"), v2.Hash, v2.Addr)
+	if err := sss.deleteData("patient", testKey("patient"), d); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := sss.GetUserData("patient", testKey("patient"), v2.Hash, v2.Addr); d != nil {
+		t.Errorf("data isn't deleted: %+v", d)
+	}
+	prev, _ = sss.GetUserData("patient", testKey("patient"), v1.Hash, v1.Addr)
+	if prev == nil || prev.Next != "" {
+		t.Errorf("next version of previous version isn't cleared: %+v", prev)
+	}
+	if key, _ := sss.getKey("patient", testKey("patient"), index); key == nil || key.Used != 1 {
+		t.Errorf("unexpected key %+v", key)
+	}
+
+	// the key isn't used anymore
+	if err := sss.deleteData("patient", testKey("patient"), prev); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := sss.getKey("patient", testKey("patient"), index); key != nil {
+		t.Errorf("unused key isn't removed: %+v", key)
+	}
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, "patient", testKey("patient")))
+	if err != nil || u.Records != 0 || u.DataSize != 0 {
+		t.Errorf("usage isn't released: %+v, %v", u, err)
+	}
+}
+
+func TestAddAndRemoveKey(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	key := testHash("key")
+	index := crypto.SHA512HexFromHex(key)
+	for i := 1; i <= 2; i++ {
+		added, err := sss.addKey("patient", testKey("patient"), key)
+		if err != nil || added != index {
+			t.Fatalf("unexpected index %s, %v", added, err)
+		}
+		fileKey, _ := sss.getKey("patient", testKey("patient"), index)
+		if fileKey == nil || fileKey.Key != key || fileKey.Used != i {
+			t.Errorf("unexpected key %+v after %d adds", fileKey, i)
+		}
+	}
+	for i := 1; i >= 0; i-- {
+		if err := sss.removeKey("patient", testKey("patient"), index); err != nil {
+			t.Fatal(err)
+		}
+		fileKey, _ := sss.getKey("patient", testKey("patient"), index)
+		if i == 0 && fileKey != nil || i > 0 && (fileKey == nil || fileKey.Used != i) {
+			t.Errorf("unexpected key %+v after remove", fileKey)
+		}
+	}
+	if _, ok := c.state[MakeKeyAddress("patient", testKey("patient"), index)]; ok {
+		t.Errorf("unused key is still stored")
+	}
+	// removing the unknown key is ignored
+	if err := sss.removeKey("patient", testKey("patient"), index); err != nil {
+		t.Errorf("failed to remove unknown key: %v", err)
+	}
+}
+
+func TestCreateAndDeleteProxyCopy(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	createTestUsers(t, sss, "patient")
+	// the copy shared with the trusted party holding the re-encryption key has the forward key only
+	info := testData("record", "doctor", storage.Critical)
+	info.Key, info.ForwardKey, info.Source = "", testHash("forward"), testHash("record")
+	stored := len(c.state)
+	if err := sss.createData("patient", testKey("patient"), info); err != nil {
+		t.Fatal(err)
+	}
+	d, err := sss.GetUserData("patient", testKey("patient"), info.Hash, info.Addr)
+	if err != nil || d == nil || d.KeyIndex != "" || d.ForwardKey != info.ForwardKey {
+		t.Errorf("unexpected copy %+v, %v", d, err)
+	}
+	if _, ok := c.state[MakeKeyAddress("patient", testKey("patient"), crypto.SHA512HexFromHex(""))]; ok {
+		t.Errorf("empty key is stored")
+	}
+	if err := sss.deleteData("patient", testKey("patient"), d); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := sss.GetUserData("patient", testKey("patient"), info.Hash, info.Addr); d != nil {
+		t.Errorf("copy isn't deleted: %+v", d)
+	}
+	if len(c.state) != stored {
+		t.Errorf("unexpected records are left: %d", len(c.state)-stored)
+	}
+}
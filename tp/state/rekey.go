@@ -0,0 +1,77 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/tp/rekey"
+)
+
+// Gets the re-encryption key of the patient from the proxy to the recipient.
+// If the re-encryption key doesn't exist, nil will be returned.
+func (sss *StorageState) GetReKey(patient, patientKey, proxyKey, recipientKey string) (*rekey.ReKey, error) {
+	address := MakeReKeyAddress(patient, patientKey, proxyKey, recipientKey)
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) == 0 {
+		return nil, nil
+	}
+	k, err := rekey.ReKeyFromBytes(results[address])
+	if err != nil {
+		return nil, &processor.InternalError{Msg: fmt.Sprint("failed to decode re-encryption key: ", err)}
+	}
+	return k, nil
+}
+
+// Issues the re-encryption key of the patient, which allows the proxy to re-encrypt the keys of the data
+// of the patient for the recipient. Only the patient can issue it, because it's derived from the private key of the patient.
+// The existing re-encryption key from the proxy to the recipient is replaced.
+func (sss *StorageState) GrantReKey(signerKey string, k rekey.ReKey) error {
+	if signerKey != k.PatientKey {
+		return &processor.InvalidTransactionError{Msg: "only the patient can issue re-encryption key"}
+	}
+	if k.ProxyKey == k.PatientKey || k.RecipientKey == k.PatientKey || k.ProxyKey == k.RecipientKey {
+		return &processor.InvalidTransactionError{Msg: "patient, proxy and recipient must be different"}
+	}
+	_, err := sss.GetUser(MakeAddress(AddressTypeUser, k.Patient, k.PatientKey))
+	if err != nil {
+		return err
+	}
+	_, err = sss.GetUser(MakeAddress(AddressTypeUser, k.Proxy, k.ProxyKey))
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: "proxy doesn't exists"}
+	}
+	_, err = sss.GetUser(MakeAddress(AddressTypeUser, k.Recipient, k.RecipientKey))
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: "recipient doesn't exists"}
+	}
+	if k.Expiration != 0 {
+		now, err := sss.GetBlockTimestamp()
+		if err != nil {
+			return err
+		}
+		if k.Expiration <= now {
+			return &processor.InvalidTransactionError{Msg: "expiration must be in the future"}
+		}
+	}
+	r := rekey.NewReKey(k.Patient, k.PatientKey, k.Proxy, k.ProxyKey, k.Recipient, k.RecipientKey, k.Key, k.Expiration)
+	return sss.setRecord(MakeReKeyAddress(k.Patient, k.PatientKey, k.ProxyKey, k.RecipientKey), r.ToBytes())
+}
+
+// Revokes the re-encryption key of the patient from the proxy to the recipient.
+// The re-encryption key is revoked by the patient or the proxy.
+func (sss *StorageState) RevokeReKey(signerKey, patient, patientKey, proxyKey, recipientKey string) error {
+	k, err := sss.GetReKey(patient, patientKey, proxyKey, recipientKey)
+	if err != nil {
+		return err
+	}
+	if k == nil {
+		return &processor.InvalidTransactionError{Msg: "re-encryption key doesn't exist"}
+	}
+	if signerKey != patientKey && signerKey != proxyKey {
+		return &processor.InvalidTransactionError{Msg: "only the patient or the proxy can revoke re-encryption key"}
+	}
+	return sss.deleteRecord(MakeReKeyAddress(patient, patientKey, proxyKey, recipientKey))
+}
@@ -0,0 +1,216 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/protos"
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+// Settings transaction family stores the on-chain configuration of the validator network.
+var SettingsNamespace = "000000"
+
+// Keys of the settings used by the transaction processor
+var (
+	// Comma separated public keys of the admins
+	SettingAdmins = "healthcare.admins"
+	// Maximum number of data stored by the user, including the copies shared by the user
+	SettingMaxRecords = "healthcare.max_records"
+	// Maximum size of the data in bytes
+	SettingMaxDataSize = "healthcare.max_data_size"
+	// Maximum total size of the data stored by the user in bytes
+	SettingMaxUserSize = "healthcare.max_user_size"
+	// Time to live of the access to the data opened to the third party, e.g. 5m or seconds
+	SettingEmergencyTTL = "healthcare.emergency.ttl"
+	// Comma separated access types allowed for the data and the requests
+	SettingAccessTypes = "healthcare.access_types"
+)
+
+// Values of the settings used when the settings don't exist.
+// The quota or the time to live set to 0 is unlimited.
+var (
+	DefaultMaxRecords   int64 = 10000
+	DefaultMaxDataSize  int64 = 128 * 1024 * 1024
+	DefaultMaxUserSize  int64 = 1024 * 1024 * 1024
+	DefaultEmergencyTTL       = 5 * time.Minute
+	DefaultAccessTypes        = []uint{storage.Unset, storage.Regular, storage.Critical}
+)
+
+// MakeSettingAddress returns the address of the setting by key.
+// The key is split into at most 4 parts, and each part is hashed separately.
+func MakeSettingAddress(key string) string {
+	parts := strings.SplitN(key, ".", 4)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	address := SettingsNamespace
+	for _, part := range parts {
+		address += crypto.SHA256HexFromBytes([]byte(part))[:16]
+	}
+	return address
+}
+
+// Gets the value of the setting by key.
+// If the setting doesn't exist, empty string will be returned.
+func (sss *StorageState) GetSetting(key string) (string, error) {
+	address := MakeSettingAddress(key)
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return "", err
+	}
+	value, err := DecodeSetting(results[address], key)
+	if err != nil {
+		return "", &processor.InternalError{Msg: fmt.Sprint("failed to decode setting: ", err)}
+	}
+	return value, nil
+}
+
+// Gets the integer value of the setting by key.
+// If the setting doesn't exist, the default value will be returned.
+func (sss *StorageState) GetIntSetting(key string, defaultValue int64) (int64, error) {
+	value, err := sss.GetSetting(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := ParseIntSetting(value, defaultValue)
+	if err != nil {
+		return 0, &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid setting %s: %s", key, value)}
+	}
+	return v, nil
+}
+
+// Gets the duration value of the setting by key.
+// If the setting doesn't exist, the default value will be returned.
+func (sss *StorageState) GetDurationSetting(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, err := sss.GetSetting(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := ParseDurationSetting(value, defaultValue)
+	if err != nil {
+		return 0, &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid setting %s: %s", key, value)}
+	}
+	return v, nil
+}
+
+// Checks whether the access type is allowed by the settings
+func (sss *StorageState) checkAccessType(accessType uint) error {
+	value, err := sss.GetSetting(SettingAccessTypes)
+	if err != nil {
+		return err
+	}
+	accessTypes, err := ParseAccessTypesSetting(value)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid setting %s: %s", SettingAccessTypes, value)}
+	}
+	if !AllowsAccessType(accessTypes, accessType) {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("access type %d isn't allowed", accessType)}
+	}
+	return nil
+}
+
+// DecodeSetting returns the value of the key from the Setting message stored at the address of the key.
+// If the key isn't in the message, empty string will be returned.
+func DecodeSetting(data []byte, key string) (string, error) {
+	var value string
+	// Setting message stores the entries of the keys sharing the address
+	err := protos.Decode(data, func(f protos.Field) error {
+		if f.Num != 1 {
+			return nil
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		var entryKey, entryValue string
+		err = protos.Decode(b, func(f protos.Field) (err error) {
+			switch f.Num {
+			case 1:
+				entryKey, err = f.String()
+			case 2:
+				entryValue, err = f.String()
+			}
+			return
+		})
+		if err == nil && entryKey == key {
+			value = entryValue
+		}
+		return err
+	})
+	return value, err
+}
+
+// ParseIntSetting parses the non-negative integer setting, or returns the default value if it's empty.
+func ParseIntSetting(value string, defaultValue int64) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultValue, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid integer: %s", value)
+	}
+	return v, nil
+}
+
+// ParseDurationSetting parses the non-negative duration setting, e.g. 5m, or the number of seconds.
+// The default value is returned if the setting is empty.
+func ParseDurationSetting(value string, defaultValue time.Duration) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultValue, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		value = fmt.Sprint(seconds, "s")
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	return v, nil
+}
+
+// ParseAccessTypesSetting parses the comma separated access types, or returns all access types if it's empty.
+func ParseAccessTypesSetting(value string) ([]uint, error) {
+	if strings.TrimSpace(value) == "" {
+		return DefaultAccessTypes, nil
+	}
+	var accessTypes []uint
+	for _, part := range strings.Split(value, ",") {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+		if err != nil || uint(v) > storage.Critical {
+			return nil, fmt.Errorf("invalid access type: %s", part)
+		}
+		accessTypes = append(accessTypes, uint(v))
+	}
+	return accessTypes, nil
+}
+
+// AllowsAccessType reports whether the access type is one of the allowed access types.
+func AllowsAccessType(accessTypes []uint, accessType uint) bool {
+	for _, t := range accessTypes {
+		if t == accessType {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the public key is in the admin set
+func (sss *StorageState) IsAdmin(publicKey string) (bool, error) {
+	admins, err := sss.GetSetting(SettingAdmins)
+	if err != nil {
+		return false, err
+	}
+	for _, admin := range strings.Split(admins, ",") {
+		if strings.TrimSpace(admin) == publicKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"healthcare-system-sawtooth/tp/storage"
+)
+
+func TestParseDurationSetting(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"", DefaultEmergencyTTL, true},
+		{"10m", 10 * time.Minute, true},
+		{" 90 ", 90 * time.Second, true},
+		{"0", 0, true},
+		{"-5m", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		v, err := ParseDurationSetting(c.value, DefaultEmergencyTTL)
+		if (err == nil) != c.valid || v != c.expected {
+			t.Errorf("%q: unexpected result %v, %v", c.value, v, err)
+		}
+	}
+}
+
+func TestParseAccessTypesSetting(t *testing.T) {
+	accessTypes, err := ParseAccessTypesSetting("")
+	if err != nil || !reflect.DeepEqual(accessTypes, DefaultAccessTypes) {
+		t.Errorf("unexpected default access types %v, %v", accessTypes, err)
+	}
+	accessTypes, err = ParseAccessTypesSetting("0, 1")
+	if err != nil || !AllowsAccessType(accessTypes, storage.Regular) || AllowsAccessType(accessTypes, storage.Critical) {
+		t.Errorf("unexpected access types %v, %v", accessTypes, err)
+	}
+	for _, value := range []string{"3", "1,,2", "critical"} {
+		if _, err = ParseAccessTypesSetting(value); err == nil {
+			t.Errorf("%q: expected error", value)
+		}
+	}
+}
@@ -2,41 +2,71 @@ package state
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/hyperledger/sawtooth-sdk-go/processor"
 	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/policy"
+	"healthcare-system-sawtooth/tp/request"
 	"healthcare-system-sawtooth/tp/storage"
 	"healthcare-system-sawtooth/tp/user"
+	"time"
 )
 
 type AddressType uint8
 
 var (
 	// User namespace address type
-	AddressTypeUser  AddressType = 0
-	AddressTypeGroup AddressType = 1
+	AddressTypeUser    AddressType = 0
+	AddressTypeGroup   AddressType = 1
+	AddressTypeRequest AddressType = 2
+	AddressTypeName    AddressType = 3
 )
 
 var (
-	Namespace      = crypto.SHA512HexFromBytes([]byte("Healthcare"))[:6]
-	UserNamespace  = crypto.SHA256HexFromBytes([]byte("User"))[:4]
-	GroupNamespace = crypto.SHA256HexFromBytes([]byte("Group"))[:4]
+	Namespace           = crypto.SHA512HexFromBytes([]byte("Healthcare"))[:6]
+	UserNamespace       = crypto.SHA256HexFromBytes([]byte("User"))[:4]
+	GroupNamespace      = crypto.SHA256HexFromBytes([]byte("Group"))[:4]
+	RequestNamespace    = crypto.SHA256HexFromBytes([]byte("Request"))[:4]
+	RecordNamespace     = crypto.SHA256HexFromBytes([]byte("Record"))[:4]
+	AuditNamespace      = crypto.SHA256HexFromBytes([]byte("Audit"))[:4]
+	NameNamespace       = crypto.SHA256HexFromBytes([]byte("Name"))[:4]
+	DelegationNamespace = crypto.SHA256HexFromBytes([]byte("Delegation"))[:4]
+	ReKeyNamespace      = crypto.SHA256HexFromBytes([]byte("ReKey"))[:4]
 )
 
+// Record types under the record prefix of the user
+var (
+	RecordTypeData = "01"
+	RecordTypeKey  = "02"
+)
+
+// Context is the state of the blockchain read and written by the transaction processor.
+// It's implemented by processor.Context.
+type Context interface {
+	GetState(addresses []string) (map[string][]byte, error)
+	SetState(pairs map[string][]byte) ([]string, error)
+	DeleteState(addresses []string) ([]string, error)
+}
+
 // Storage state struct
 type StorageState struct {
-	context    *processor.Context
-	userCache  map[string][]byte
-	groupCache map[string][]byte
-	seaCache   map[string][]byte
+	context      Context
+	userCache    map[string][]byte
+	groupCache   map[string][]byte
+	requestCache map[string][]byte
+	recordCache  map[string][]byte
+	seaCache     map[string][]byte
 }
 
 // Creates new storage state struct
-func NewStorageState(context *processor.Context) *StorageState {
+func NewStorageState(context Context) *StorageState {
 	return &StorageState{
-		context:    context,
-		userCache:  make(map[string][]byte),
-		groupCache: make(map[string][]byte),
-		seaCache:   make(map[string][]byte),
+		context:      context,
+		userCache:    make(map[string][]byte),
+		groupCache:   make(map[string][]byte),
+		requestCache: make(map[string][]byte),
+		recordCache:  make(map[string][]byte),
+		seaCache:     make(map[string][]byte),
 	}
 }
 
@@ -57,21 +87,126 @@ func (sss *StorageState) GetUser(address string) (*user.User, error) {
 	return nil, &processor.InvalidTransactionError{Msg: "user doesn't exists"}
 }
 
-// Creates new user data
+// Creates new user data and claims the username in the name registry.
+// The user created before the name registry claims the username by creating itself again.
 func (sss *StorageState) CreateUser(username string, publicKey string) error {
+	n, err := sss.GetName(username)
+	if err != nil {
+		return err
+	}
+	if n != nil {
+		if n.PublicKey != publicKey {
+			return &processor.InvalidTransactionError{Msg: "username is taken"}
+		}
+		return &processor.InvalidTransactionError{Msg: "user exists"}
+	}
+	err = sss.saveName(user.NewName(username, publicKey), MakeAddress(AddressTypeName, username, ""))
+	if err != nil {
+		return err
+	}
 	address := MakeAddress(AddressTypeUser, username, publicKey)
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return err
+	}
 	_, ok := sss.userCache[address]
-	if ok {
-		return &processor.InvalidTransactionError{Msg: "user exists"}
+	if ok || len(results[address]) > 0 {
+		return nil
 	}
+	u := user.GenerateUser(username, publicKey)
+	isAdmin, err := sss.IsAdmin(publicKey)
+	if err != nil {
+		return err
+	}
+	if isAdmin {
+		u.Role = user.UserRoleAdmin
+	}
+	return sss.saveUser(u, address)
+}
+
+// Claims the username of the user created before the name registry, which only the admin can do,
+// so that the username can't be claimed by another user before the legacy user claims it.
+func (sss *StorageState) ClaimLegacyName(adminKey, username, publicKey string) error {
+	isAdmin, err := sss.IsAdmin(adminKey)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return &processor.InvalidTransactionError{Msg: "only admins can claim the name of legacy user"}
+	}
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, username, publicKey))
+	if err != nil {
+		return err
+	}
+	if u.Name != username {
+		return &processor.InvalidTransactionError{Msg: "username doesn't match the user"}
+	}
+	n, err := sss.GetName(username)
+	if err != nil {
+		return err
+	}
+	if n != nil {
+		return &processor.InvalidTransactionError{Msg: "username is already claimed"}
+	}
+	return sss.saveName(user.NewName(username, publicKey), MakeAddress(AddressTypeName, username, ""))
+}
+
+// Updates the role and the organization of the user, which only the admin can do.
+// The admin role follows the admin set in the settings, so it can't be granted.
+func (sss *StorageState) UpdateUserRole(adminKey, username, publicKey string, role user.UserRole, organization string) error {
+	isAdmin, err := sss.IsAdmin(adminKey)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return &processor.InvalidTransactionError{Msg: "only admins can update the role of user"}
+	}
+	if role == user.UserRoleAdmin {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprint("admins are managed by the setting ", SettingAdmins)}
+	}
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	err = policy.ValidateValue(organization)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprint("invalid organization: ", err)}
+	}
+	u.Role = role
+	u.Organization = organization
+	return sss.saveUser(u, address)
+}
+
+// Gets the entry of name registry by username.
+// If the username isn't claimed, nil will be returned.
+func (sss *StorageState) GetName(username string) (*user.Name, error) {
+	address := MakeAddress(AddressTypeName, username, "")
 	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) == 0 {
+		return nil, nil
+	}
+	n, err := user.NameFromBytes(results[address])
+	if err != nil {
+		return nil, &processor.InternalError{Msg: fmt.Sprint("failed to decode name: ", err)}
+	}
+	return n, nil
+}
+
+func (sss *StorageState) saveName(n *user.Name, address string) error {
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: n.ToBytes(),
+	})
 	if err != nil {
 		return err
 	}
-	if len(results[address]) > 0 {
-		return &processor.InvalidTransactionError{Msg: "user exists"}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
 	}
-	return sss.saveUser(user.GenerateUser(username, publicKey), address)
+	return nil
 }
 
 func (sss *StorageState) saveUser(u *user.User, address string) error {
@@ -89,6 +224,7 @@ func (sss *StorageState) saveUser(u *user.User, address string) error {
 	return nil
 }
 
+// Gets group data stored on the blockchain
 func (sss *StorageState) GetGroup(address string) (*user.Group, error) {
 	groupBytes, ok := sss.groupCache[address]
 	if ok {
@@ -99,13 +235,14 @@ func (sss *StorageState) GetGroup(address string) (*user.Group, error) {
 		return nil, err
 	}
 	if len(results[address]) > 0 {
-		sss.seaCache[address] = results[address]
+		sss.groupCache[address] = results[address]
 		return user.GroupFromBytes(results[address])
 	}
 	return nil, &processor.InvalidTransactionError{Msg: "group doesn't exists"}
 }
 
-func (sss *StorageState) CreateGroup(groupName, leader, key string) error {
+// Creates new group led by the user, who becomes its first owner
+func (sss *StorageState) CreateGroup(groupName, username, publicKey string) error {
 	address := MakeAddress(AddressTypeGroup, groupName, "")
 	_, ok := sss.groupCache[address]
 	if ok {
@@ -118,7 +255,89 @@ func (sss *StorageState) CreateGroup(groupName, leader, key string) error {
 	if len(results[address]) > 0 {
 		return &processor.InvalidTransactionError{Msg: "group exists"}
 	}
-	return sss.saveGroup(user.GenerateGroup(groupName, leader), address)
+	userAddress := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(userAddress)
+	if err != nil {
+		return err
+	}
+	u.JoinGroup(groupName)
+	err = sss.saveGroup(user.GenerateGroup(groupName, publicKey), address)
+	if err != nil {
+		return err
+	}
+	return sss.saveUser(u, userAddress)
+}
+
+// Adds the member to the group with the role
+func (sss *StorageState) AddGroupMember(groupName, publicKey, memberName, memberKey string, role user.Role) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	memberAddress := MakeAddress(AddressTypeUser, memberName, memberKey)
+	m, err := sss.GetUser(memberAddress)
+	if err != nil {
+		return err
+	}
+	if !g.AddMember(publicKey, memberKey, role) {
+		return &processor.InvalidTransactionError{Msg: "failed to add group member: permission denied"}
+	}
+	m.JoinGroup(groupName)
+	err = sss.saveGroup(g, address)
+	if err != nil {
+		return err
+	}
+	return sss.saveUser(m, memberAddress)
+}
+
+// Removes the member from the group
+func (sss *StorageState) RemoveGroupMember(groupName, publicKey, memberName, memberKey string) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	memberAddress := MakeAddress(AddressTypeUser, memberName, memberKey)
+	m, err := sss.GetUser(memberAddress)
+	if err != nil {
+		return err
+	}
+	if !g.RemoveMember(publicKey, memberKey) {
+		return &processor.InvalidTransactionError{Msg: "failed to remove group member: permission denied"}
+	}
+	m.LeaveGroup(groupName)
+	err = sss.saveGroup(g, address)
+	if err != nil {
+		return err
+	}
+	return sss.saveUser(m, memberAddress)
+}
+
+// Changes the role of the group member
+func (sss *StorageState) UpdateGroupMemberRole(groupName, publicKey, memberKey string, role user.Role) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	if !g.UpdateMemberRole(publicKey, memberKey, role) {
+		return &processor.InvalidTransactionError{Msg: "failed to update member role: permission denied"}
+	}
+	return sss.saveGroup(g, address)
+}
+
+// Transfers the group leadership to another member
+func (sss *StorageState) UpdateGroupLeader(groupName, publicKey, newLeaderKey string) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	if !g.UpdateLeader(publicKey, newLeaderKey) {
+		return &processor.InvalidTransactionError{Msg: "failed to update group leader: permission denied"}
+	}
+	return sss.saveGroup(g, address)
 }
 
 func (sss *StorageState) saveGroup(g *user.Group, address string) error {
@@ -129,33 +348,487 @@ func (sss *StorageState) saveGroup(g *user.Group, address string) error {
 	if err != nil {
 		return err
 	}
-	if len(addresses) > 0 {
+	if len(addresses) == 0 {
 		return &processor.InternalError{Msg: "No addresses in set response"}
 	}
 	sss.groupCache[address] = gBytes
 	return nil
 }
 
+// Creates the data of the user.
+// The origin of data is only set by the transaction processor when the data is shared further.
+// The copy shared with another user is recorded in its source, so it's deleted together with the source.
 func (sss *StorageState) CreateUserData(username, publicKey string, info storage.DataInfo) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	info.Origin = ""
+	err := sss.createUserData(username, publicKey, info)
+	if err != nil || info.Source == "" || info.Addr == username {
+		return err
+	}
+	source, err := sss.GetUserData(username, publicKey, info.Source, username)
+	if err != nil || source == nil {
+		return err
+	}
+	return sss.addCopy(username, publicKey, source, storage.DataRef{Owner: username, OwnerKey: publicKey, Hash: info.Hash, Addr: info.Addr})
+}
+
+func (sss *StorageState) createUserData(username, publicKey string, info storage.DataInfo) error {
+	_, err := sss.getUserForData(username, publicKey)
 	if err != nil {
 		return err
 	}
-	err = u.Root.CreateData(info)
+	if info.Expiration != 0 {
+		now, err := sss.GetBlockTimestamp()
+		if err != nil {
+			return err
+		}
+		if info.Expiration <= now {
+			return &processor.InvalidTransactionError{Msg: "expiration must be in the future"}
+		}
+	}
+	return sss.createData(username, publicKey, info)
+}
+
+// Shares the data, which is shared with the user by the owner, to another user.
+// The access of the user must not be expired, and the new share must not outlive it.
+// The new share expires within the emergency ttl after the latest block.
+// The critical data is shared only for the accepted request of the recipient, which has the id.
+// The copy is recorded in the data of the owner, so it's deleted together with the data.
+func (sss *StorageState) ShareUserData(username, publicKey, ownerName, ownerKey, requestID string, info storage.DataInfo) error {
+	grant, err := sss.GetUserData(ownerName, ownerKey, info.Source, username)
 	if err != nil {
-		return &processor.InvalidTransactionError{Msg: err.Error()}
+		return err
 	}
-	return sss.saveUser(u, address)
+	if grant == nil {
+		return &processor.InvalidTransactionError{Msg: "data isn't shared with the user"}
+	}
+	now, err := sss.GetBlockTimestamp()
+	if err != nil {
+		return err
+	}
+	if grant.IsExpired(now) {
+		return &processor.InvalidTransactionError{Msg: "access to the data is expired"}
+	}
+	// the data shared further is opened to the third party, whose access is limited by the emergency ttl.
+	// The expiration set by the clock of the client is cut to the ttl after the latest block, which lags behind it.
+	ttl, err := sss.GetDurationSetting(SettingEmergencyTTL, DefaultEmergencyTTL)
+	if err != nil {
+		return err
+	}
+	if limit := now + int64(ttl/time.Second); ttl > 0 && (info.Expiration == 0 || info.Expiration > limit) {
+		info.Expiration = limit
+	}
+	if grant.Expiration != 0 && (info.Expiration == 0 || info.Expiration > grant.Expiration) {
+		return &processor.InvalidTransactionError{Msg: "share must not outlive the access to the source"}
+	}
+	// the patient of the data shared further is the origin of the source, or the owner of the source
+	info.Origin = grant.Origin
+	if info.Origin == "" {
+		info.Origin = ownerName
+	}
+	if grant.AccessType == storage.Critical {
+		err = sss.checkShareRequest(requestID, publicKey, info)
+		if err != nil {
+			return err
+		}
+	}
+	// the policy and the category of the source are kept by the data shared further
+	info.Policy = grant.Policy
+	info.Category = grant.Category
+	// the data shared with the third party isn't forwarded again
+	info.ForwardKey = ""
+	err = sss.createUserData(username, publicKey, info)
+	if err != nil {
+		return err
+	}
+	return sss.addCopy(ownerName, ownerKey, grant, storage.DataRef{Owner: username, OwnerKey: publicKey, Hash: info.Hash, Addr: info.Addr})
+}
+
+// Checks that the request received by the user is accepted with enough approvals,
+// and it's sent by the recipient of the data for the source of the patient.
+func (sss *StorageState) checkShareRequest(id, publicKey string, info storage.DataInfo) error {
+	if id == "" {
+		return &processor.InvalidTransactionError{Msg: "critical data is shared only for the accepted request"}
+	}
+	r, err := sss.GetRequest(MakeAddress(AddressTypeRequest, id, publicKey))
+	if err != nil {
+		return err
+	}
+	if r.RequestFromKey != publicKey || r.Status != request.StatusAccepted || !r.IsApproved() {
+		return &processor.InvalidTransactionError{Msg: "request isn't accepted"}
+	}
+	if r.UsernameTo != info.Addr || r.UsernameFrom != info.Origin || r.AccessType != storage.Critical {
+		return &processor.InvalidTransactionError{Msg: "request doesn't match the share"}
+	}
+	for _, hash := range r.Hashes {
+		if hash == info.Source {
+			return nil
+		}
+	}
+	return &processor.InvalidTransactionError{Msg: "data isn't requested"}
+}
+
+// Removes the expired data of the user by hash and address
+func (sss *StorageState) PruneExpiredUserData(username, publicKey, hash, addr string) error {
+	_, err := sss.getUserForData(username, publicKey)
+	if err != nil {
+		return err
+	}
+	d, err := sss.GetUserData(username, publicKey, hash, addr)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "data doesn't exist"}
+	}
+	now, err := sss.GetBlockTimestamp()
+	if err != nil {
+		return err
+	}
+	if !d.IsExpired(now) {
+		return &processor.InvalidTransactionError{Msg: "data isn't expired"}
+	}
+	return sss.deleteData(username, publicKey, d)
+}
+
+// Creates the next version of the data owned by the user
+func (sss *StorageState) UpdateUserData(username, publicKey string, info storage.DataInfo) error {
+	u, err := sss.getUserForData(username, publicKey)
+	if err != nil {
+		return err
+	}
+	if info.Addr != u.Name {
+		return &processor.InvalidTransactionError{Msg: "only own data can be updated"}
+	}
+	prev, err := sss.GetUserData(username, publicKey, info.Prev, info.Addr)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		return &processor.InvalidTransactionError{Msg: "previous version doesn't exist"}
+	}
+	if prev.Next != "" {
+		return &processor.InvalidTransactionError{Msg: "previous version is already updated"}
+	}
+	if info.Name != prev.Name {
+		return &processor.InvalidTransactionError{Msg: "name of versions must be the same"}
+	}
+	if info.Category != prev.Category {
+		return &processor.InvalidTransactionError{Msg: "category of versions must be the same"}
+	}
+	if info.Version != prev.GetVersion()+1 {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid version: expected %d", prev.GetVersion()+1)}
+	}
+	err = sss.createData(username, publicKey, info)
+	if err != nil {
+		return err
+	}
+	prev.Next = info.Hash
+	return sss.saveData(username, publicKey, prev)
+}
+
+// Sets the access policy of the data owned by the user, or of its copy shared with the recipient
+func (sss *StorageState) SetUserDataPolicy(username, publicKey, hash, addr, p string) error {
+	_, err := sss.getUserForData(username, publicKey)
+	if err != nil {
+		return err
+	}
+	d, err := sss.GetUserData(username, publicKey, hash, addr)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "data doesn't exist"}
+	}
+	if d.Origin != "" {
+		return &processor.InvalidTransactionError{Msg: "policy of the data shared further can't be changed"}
+	}
+	err = policy.Validate(p)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: fmt.Sprintf("invalid policy: %v", err)}
+	}
+	d.Policy = p
+	return sss.saveData(username, publicKey, d)
+}
+
+// Revokes the data shared by the user with the recipient
+func (sss *StorageState) RevokeUserData(username, publicKey string, info storage.DataInfo) error {
+	u, err := sss.getUserForData(username, publicKey)
+	if err != nil {
+		return err
+	}
+	if info.Addr == "" || info.Addr == u.Name {
+		return &processor.InvalidTransactionError{Msg: "recipient is nil"}
+	}
+	d, err := sss.GetUserData(username, publicKey, info.Hash, info.Addr)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "data doesn't exist"}
+	}
+	return sss.deleteData(username, publicKey, d)
+}
+
+// Deletes the data owned by the user, and the copies shared from it, including the copies shared further
+// by the trusted parties. The copies shared before they were recorded in the data are revoked by the same batch.
+func (sss *StorageState) DeleteUserData(username, publicKey string, info storage.DataInfo) error {
+	u, err := sss.getUserForData(username, publicKey)
+	if err != nil {
+		return err
+	}
+	d, err := sss.GetUserData(username, publicKey, info.Hash, u.Name)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return &processor.InvalidTransactionError{Msg: "data doesn't exist"}
+	}
+	err = sss.deleteData(username, publicKey, d)
+	if err != nil {
+		return err
+	}
+	return sss.deleteCopies(d)
+}
+
+// Records the copy shared from the data of the owner.
+// The data of the legacy owner, which isn't moved to its own address yet, doesn't record its copies.
+func (sss *StorageState) addCopy(ownerName, ownerKey string, d *storage.Data, ref storage.DataRef) error {
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, ownerName, ownerKey))
+	if err != nil || u.Root != nil || !d.AddCopy(ref) {
+		return err
+	}
+	return sss.saveData(ownerName, ownerKey, d)
+}
+
+// Deletes the copies shared from the data, and the copies shared further from them.
+// The copies already revoked, pruned or replaced by another data are skipped.
+func (sss *StorageState) deleteCopies(d *storage.Data) error {
+	for _, ref := range d.Copies {
+		_, err := sss.getUserForData(ref.Owner, ref.OwnerKey)
+		if err != nil {
+			return err
+		}
+		copied, err := sss.GetUserData(ref.Owner, ref.OwnerKey, ref.Hash, ref.Addr)
+		if err != nil {
+			return err
+		}
+		if copied == nil || copied.Source != d.Hash {
+			continue
+		}
+		err = sss.deleteData(ref.Owner, ref.OwnerKey, copied)
+		if err != nil {
+			return err
+		}
+		err = sss.deleteCopies(copied)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gets access request stored on the blockchain
+func (sss *StorageState) GetRequest(address string) (*request.Request, error) {
+	requestBytes, ok := sss.requestCache[address]
+	if ok {
+		return request.RequestFromBytes(requestBytes)
+	}
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		sss.requestCache[address] = results[address]
+		return request.RequestFromBytes(results[address])
+	}
+	return nil, &processor.InvalidTransactionError{Msg: "request doesn't exists"}
+}
+
+// Creates new access request sent by the user, and returns the created request
+func (sss *StorageState) CreateRequest(username, publicKey string, req request.Request) (*request.Request, error) {
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, username, publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if req.IsThirdParty() && u.Role != user.UserRoleResponder {
+		return nil, &processor.InvalidTransactionError{Msg: "only emergency responders can request as third party"}
+	}
+	_, err = sss.GetUser(MakeAddress(AddressTypeUser, req.RequestFrom, req.RequestFromKey))
+	if err != nil {
+		return nil, &processor.InvalidTransactionError{Msg: "request receiver doesn't exists"}
+	}
+	address := MakeAddress(AddressTypeRequest, req.ID, req.RequestFromKey)
+	_, ok := sss.requestCache[address]
+	if ok {
+		return nil, &processor.InvalidTransactionError{Msg: "request exists"}
+	}
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		return nil, &processor.InvalidTransactionError{Msg: "request exists"}
+	}
+	err = policy.ValidateValue(req.Purpose)
+	if err != nil {
+		return nil, &processor.InvalidTransactionError{Msg: fmt.Sprint("invalid purpose: ", err)}
+	}
+	err = sss.checkAccessType(req.AccessType)
+	if err != nil {
+		return nil, err
+	}
+	r := request.NewRequest(req.ID, req.RequestFrom, req.RequestFromKey, req.UsernameFrom, username, publicKey, req.Hashes, req.AccessType)
+	r.Purpose = req.Purpose
+	if r.IsThirdParty() && r.AccessType == storage.Critical {
+		err = sss.setRequestApprovers(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, sss.saveRequest(r)
+}
+
+// Accepts or rejects the access request received by the user, and returns the processed request
+func (sss *StorageState) ProcessRequest(id, publicKey string, accept bool) (*request.Request, error) {
+	address := MakeAddress(AddressTypeRequest, id, publicKey)
+	r, err := sss.GetRequest(address)
+	if err != nil {
+		return nil, err
+	}
+	if r.RequestFromKey != publicKey {
+		return nil, &processor.InvalidTransactionError{Msg: "only the request receiver can process the request"}
+	}
+	if accept && r.IsThirdParty() {
+		requester, err := sss.GetUser(MakeAddress(AddressTypeUser, r.UsernameTo, r.UsernameToKey))
+		if err != nil {
+			return nil, err
+		}
+		if requester.Role != user.UserRoleResponder {
+			return nil, &processor.InvalidTransactionError{Msg: "requester isn't emergency responder"}
+		}
+	}
+	if accept && r.IsMultiParty() {
+		// the approval of the trusted party accepting the request is counted
+		r.Approve(publicKey)
+		if !r.IsApproved() {
+			return nil, &processor.InvalidTransactionError{Msg: fmt.Sprintf("request needs %d approvals, got %d", r.Threshold, len(r.Approvals))}
+		}
+	}
+	if !r.Process(publicKey, accept) {
+		return nil, &processor.InvalidTransactionError{Msg: "request is already processed"}
+	}
+	return r, sss.saveRequest(r)
+}
+
+// Saves the request at the addresses of the request receiver and all approvers.
+func (sss *StorageState) saveRequest(r *request.Request) error {
+	rBytes := r.ToBytes()
+	states := make(map[string][]byte)
+	for _, address := range MakeRequestAddresses(r) {
+		states[address] = rBytes
+	}
+	addresses, err := sss.context.SetState(states)
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	for address := range states {
+		sss.requestCache[address] = rBytes
+	}
+	return nil
 }
 
 func MakeAddress(addressType AddressType, name, publicKey string) string {
 	switch addressType {
 	case AddressTypeUser:
-		return Namespace + UserNamespace + crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))[:60]
+		return Namespace + UserNamespace + userHash(name, publicKey)[:60]
 	case AddressTypeGroup:
 		return Namespace + GroupNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
+	case AddressTypeRequest:
+		return MakeRequestPrefix(publicKey) + crypto.SHA512HexFromBytes([]byte(name))[:30]
+	case AddressTypeName:
+		return Namespace + NameNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
 	default:
 		return ""
 	}
 }
+
+// MakeRequestPrefix returns the address prefix of requests received by the public key
+func MakeRequestPrefix(publicKey string) string {
+	return Namespace + RequestNamespace + crypto.SHA512HexFromHex(publicKey)[:30]
+}
+
+// MakeRecordPrefix returns the address prefix of data and keys of the user.
+// Transactions of unrelated users don't share any address, so they can be scheduled in parallel.
+func MakeRecordPrefix(name, publicKey string) string {
+	return Namespace + RecordNamespace + userHash(name, publicKey)[:30]
+}
+
+// MakeDataPrefix returns the address prefix of data of the user
+func MakeDataPrefix(name, publicKey string) string {
+	return MakeRecordPrefix(name, publicKey) + RecordTypeData
+}
+
+// MakeKeyPrefix returns the address prefix of keys of the user
+func MakeKeyPrefix(name, publicKey string) string {
+	return MakeRecordPrefix(name, publicKey) + RecordTypeKey
+}
+
+// MakeDataAddress returns the address of data of the user by hash and address of data
+func MakeDataAddress(name, publicKey, hash, addr string) string {
+	return MakeDataPrefix(name, publicKey) + crypto.SHA512HexFromBytes([]byte(hash + "/" + addr))[:28]
+}
+
+// MakeKeyAddress returns the address of key of the user by index
+func MakeKeyAddress(name, publicKey, index string) string {
+	return MakeKeyPrefix(name, publicKey) + crypto.SHA512HexFromBytes([]byte(index))[:28]
+}
+
+// MakeAuditPrefix returns the address prefix of the audit log of the user
+func MakeAuditPrefix(name, publicKey string) string {
+	return Namespace + AuditNamespace + userHash(name, publicKey)[:30]
+}
+
+// MakeAuditAddress returns the address of the receipt in the audit log of the user by id
+func MakeAuditAddress(name, publicKey, id string) string {
+	return MakeAuditPrefix(name, publicKey) + crypto.SHA512HexFromBytes([]byte(id))[:30]
+}
+
+// MakeDelegationPrefix returns the address prefix of the delegations of the patient
+func MakeDelegationPrefix(name, publicKey string) string {
+	return Namespace + DelegationNamespace + userHash(name, publicKey)[:30]
+}
+
+// MakeDelegationAddress returns the address of the delegation of the patient to the delegate
+func MakeDelegationAddress(name, publicKey, delegateKey string) string {
+	return MakeDelegationPrefix(name, publicKey) + crypto.SHA512HexFromHex(delegateKey)[:30]
+}
+
+// MakeReKeyPrefix returns the address prefix of the re-encryption keys issued by the patient
+func MakeReKeyPrefix(name, publicKey string) string {
+	return Namespace + ReKeyNamespace + userHash(name, publicKey)[:30]
+}
+
+// MakeReKeyAddress returns the address of the re-encryption key of the patient from the proxy to the recipient
+func MakeReKeyAddress(name, publicKey, proxyKey, recipientKey string) string {
+	return MakeReKeyPrefix(name, publicKey) + crypto.SHA512HexFromHex(proxyKey + recipientKey)[:30]
+}
+
+// MakeRequestAddresses returns the addresses of the request.
+// The request is stored at the address of the request receiver, and the addresses of the approvers
+// of multi-party request, so that it's listed in the requests of all approvers.
+func MakeRequestAddresses(r *request.Request) []string {
+	addresses := []string{MakeAddress(AddressTypeRequest, r.ID, r.RequestFromKey)}
+	for _, key := range r.ApproverKeys {
+		if key != r.RequestFromKey {
+			addresses = append(addresses, MakeAddress(AddressTypeRequest, r.ID, key))
+		}
+	}
+	return addresses
+}
+
+func userHash(name, publicKey string) string {
+	return crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))
+}
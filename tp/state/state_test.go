@@ -0,0 +1,368 @@
+package state
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"healthcare-system-sawtooth/crypto"
+	"healthcare-system-sawtooth/tp/request"
+	"healthcare-system-sawtooth/tp/storage"
+	"healthcare-system-sawtooth/tp/user"
+)
+
+// mockContext is the state of the blockchain in memory.
+type mockContext struct {
+	state map[string][]byte
+}
+
+// newMockState returns the storage state of the empty blockchain, whose latest block has the timestamp.
+func newMockState(timestamp int64) (*StorageState, *mockContext) {
+	c := &mockContext{state: make(map[string][]byte)}
+	c.setBlockTimestamp(timestamp)
+	return NewStorageState(c), c
+}
+
+func (c *mockContext) GetState(addresses []string) (map[string][]byte, error) {
+	results := make(map[string][]byte)
+	for _, address := range addresses {
+		if value, ok := c.state[address]; ok {
+			results[address] = value
+		}
+	}
+	return results, nil
+}
+
+func (c *mockContext) SetState(pairs map[string][]byte) ([]string, error) {
+	var addresses []string
+	for address, value := range pairs {
+		c.state[address] = value
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+func (c *mockContext) DeleteState(addresses []string) ([]string, error) {
+	for _, address := range addresses {
+		delete(c.state, address)
+	}
+	return addresses, nil
+}
+
+// setBlockTimestamp stores the block info of the latest block with the timestamp.
+func (c *mockContext) setBlockTimestamp(timestamp int64) {
+	config := protowire.AppendTag(nil, blockInfoConfigLatestBlock, protowire.VarintType)
+	c.state[BlockInfoConfigAddress] = protowire.AppendVarint(config, 1)
+	info := protowire.AppendTag(nil, blockInfoTimestamp, protowire.VarintType)
+	c.state[MakeBlockInfoAddress(1)] = protowire.AppendVarint(info, uint64(timestamp))
+}
+
+// setSetting stores the setting by key.
+func (c *mockContext) setSetting(key, value string) {
+	entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, value)
+	setting := protowire.AppendTag(nil, 1, protowire.BytesType)
+	c.state[MakeSettingAddress(key)] = protowire.AppendBytes(setting, entry)
+}
+
+// testKey returns the public key of the test user.
+func testKey(name string) string {
+	return "02" + crypto.SHA256HexFromBytes([]byte(name))
+}
+
+// testHash returns the hash of the test data.
+func testHash(name string) string {
+	return crypto.SHA512HexFromBytes([]byte(name))
+}
+
+// createTestUsers creates the users with the test keys.
+func createTestUsers(t *testing.T, sss *StorageState, names ...string) {
+	for _, name := range names {
+		if err := sss.CreateUser(name, testKey(name)); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+}
+
+// testData returns the data of the user shared with the address.
+func testData(name, addr string, accessType uint) storage.DataInfo {
+	return *storage.NewDataInfo(name, 10, testHash(name), testHash(name+addr), addr, accessType)
+}
+
+func TestShareCriticalData(t *testing.T) {
+	now := int64(1600000000)
+	sss, c := newMockState(now)
+	c.setSetting(SettingAdmins, testKey("admin"))
+	createTestUsers(t, sss, "patient", "doctor", "responder", "nurse")
+	for _, name := range []string{"responder", "nurse"} {
+		if err := sss.UpdateUserRole(testKey("admin"), name, testKey(name), user.UserRoleResponder, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := testData("record", "doctor", storage.Critical)
+	if err := sss.CreateUserData("patient", testKey("patient"), source); err != nil {
+		t.Fatal(err)
+	}
+	share := func(id string) error {
+		info := testData("shared", "responder", storage.Critical)
+		info.Source = source.Hash
+		info.Expiration = now + 60
+		return sss.ShareUserData("doctor", testKey("doctor"), "patient", testKey("patient"), id, info)
+	}
+	if err := share(""); err == nil {
+		t.Errorf("critical data shared without request")
+	}
+	if err := share("unknown"); err == nil {
+		t.Errorf("critical data shared for unknown request")
+	}
+
+	newRequest := func(id, usernameTo string, hashes []string) *request.Request {
+		r := request.NewRequest(id, "doctor", testKey("doctor"), "patient", usernameTo, testKey(usernameTo), hashes, storage.Critical)
+		if err := sss.saveRequest(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	newRequest("pending", "responder", []string{source.Hash})
+	if err := share("pending"); err == nil {
+		t.Errorf("critical data shared for pending request")
+	}
+	for _, r := range []*request.Request{
+		newRequest("other-data", "responder", []string{testHash("other")}),
+		newRequest("other-recipient", "nurse", []string{source.Hash}),
+		newRequest("accepted", "responder", []string{source.Hash}),
+	} {
+		if _, err := sss.ProcessRequest(r.ID, testKey("doctor"), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := share("other-data"); err == nil {
+		t.Errorf("critical data shared for request of other data")
+	}
+	if err := share("other-recipient"); err == nil {
+		t.Errorf("critical data shared for request of other recipient")
+	}
+	if err := share("accepted"); err != nil {
+		t.Errorf("failed to share critical data for accepted request: %v", err)
+	}
+}
+
+func TestShareUserDataExpiration(t *testing.T) {
+	// the block time lags behind the clock of the client
+	now := int64(1600000000)
+	lag := int64(30)
+	ttl := int64(DefaultEmergencyTTL.Seconds())
+	sss, ctx := newMockState(now)
+	createTestUsers(t, sss, "patient", "doctor", "responder")
+	source := testData("record", "doctor", storage.Regular)
+	source.Expiration = now + 2*ttl
+	if err := sss.CreateUserData("patient", testKey("patient"), source); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		expiration int64
+		expected   int64
+	}{
+		{"unset", 0, now + ttl},
+		{"client clock", now + lag + ttl, now + ttl},
+		{"earlier", now + 60, now + 60},
+	}
+	for _, c := range cases {
+		info := testData(c.name, "responder", storage.Regular)
+		info.Source = source.Hash
+		info.Expiration = c.expiration
+		if err := sss.ShareUserData("doctor", testKey("doctor"), "patient", testKey("patient"), "", info); err != nil {
+			t.Errorf("%s: failed to share: %v", c.name, err)
+			continue
+		}
+		d, err := sss.GetUserData("doctor", testKey("doctor"), info.Hash, "responder")
+		if err != nil || d == nil || d.Expiration != c.expected {
+			t.Errorf("%s: unexpected data %+v, %v", c.name, d, err)
+		}
+	}
+
+	// the share is cut to the ttl, but it must not outlive the source
+	ctx.setBlockTimestamp(now + 2*ttl - 60)
+	info := testData("outlive", "responder", storage.Regular)
+	info.Source = source.Hash
+	if err := sss.ShareUserData("doctor", testKey("doctor"), "patient", testKey("patient"), "", info); err == nil {
+		t.Errorf("share outlives the source")
+	}
+}
+
+func TestDeleteUserDataCascade(t *testing.T) {
+	now := int64(1600000000)
+	sss, _ := newMockState(now)
+	createTestUsers(t, sss, "patient", "doctor", "nurse", "responder")
+	record := testData("record", "patient", storage.Regular)
+	if err := sss.CreateUserData("patient", testKey("patient"), record); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"doctor", "nurse"} {
+		copied := testData("record", name, storage.Regular)
+		copied.Source = record.Hash
+		if err := sss.CreateUserData("patient", testKey("patient"), copied); err != nil {
+			t.Fatal(err)
+		}
+	}
+	further := testData("record", "responder", storage.Regular)
+	further.Source = record.Hash
+	if err := sss.ShareUserData("doctor", testKey("doctor"), "patient", testKey("patient"), "", further); err != nil {
+		t.Fatal(err)
+	}
+	// the revoked copy is skipped
+	if err := sss.RevokeUserData("patient", testKey("patient"), storage.DataInfo{Hash: record.Hash, Addr: "nurse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sss.DeleteUserData("patient", testKey("patient"), storage.DataInfo{Hash: record.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	refs := []storage.DataRef{
+		{Owner: "patient", Hash: record.Hash, Addr: "patient"},
+		{Owner: "patient", Hash: record.Hash, Addr: "doctor"},
+		{Owner: "patient", Hash: record.Hash, Addr: "nurse"},
+		{Owner: "doctor", Hash: record.Hash, Addr: "responder"},
+	}
+	for _, ref := range refs {
+		d, err := sss.GetUserData(ref.Owner, testKey(ref.Owner), ref.Hash, ref.Addr)
+		if err != nil || d != nil {
+			t.Errorf("copy of %s shared with %s isn't deleted: %+v, %v", ref.Owner, ref.Addr, d, err)
+		}
+	}
+	for _, name := range []string{"patient", "doctor"} {
+		u, err := sss.GetUser(MakeAddress(AddressTypeUser, name, testKey(name)))
+		if err != nil || u.Records != 0 || u.DataSize != 0 {
+			t.Errorf("usage of %s isn't released: %+v, %v", name, u, err)
+		}
+	}
+	if err := sss.DeleteUserData("patient", testKey("patient"), storage.DataInfo{Hash: record.Hash}); err == nil {
+		t.Errorf("deleted data is deleted again")
+	}
+}
+
+func TestCreateUserName(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	c.setSetting(SettingAdmins, testKey("admin"))
+	// the users created before the name registry have no name
+	for _, name := range []string{"legacy", "unclaimed"} {
+		if err := sss.saveUser(user.GenerateUser(name, testKey(name)), MakeAddress(AddressTypeUser, name, testKey(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name, publicKey string
+		ok              bool
+	}{
+		{"alice", testKey("alice"), true},
+		{"alice", testKey("alice"), false},   // user exists
+		{"alice", testKey("mallory"), false}, // username is taken
+		{"unclaimed", testKey("unclaimed"), true},
+	}
+	for _, tc := range cases {
+		if err := sss.CreateUser(tc.name, tc.publicKey); (err == nil) != tc.ok {
+			t.Errorf("%s with %s: unexpected result %v", tc.name, tc.publicKey, err)
+		}
+	}
+	n, err := sss.GetName("unclaimed")
+	if err != nil || n == nil || n.PublicKey != testKey("unclaimed") {
+		t.Errorf("legacy user didn't claim the name: %+v, %v", n, err)
+	}
+
+	claims := []struct {
+		adminKey, name, publicKey string
+		ok                        bool
+	}{
+		{testKey("mallory"), "legacy", testKey("legacy"), false}, // only admins claim
+		{testKey("admin"), "legacy", testKey("mallory"), false},  // user doesn't exist
+		{testKey("admin"), "alice", testKey("alice"), false},     // name is already claimed
+		{testKey("admin"), "legacy", testKey("legacy"), true},
+		{testKey("admin"), "legacy", testKey("legacy"), false},
+	}
+	for _, tc := range claims {
+		if err := sss.ClaimLegacyName(tc.adminKey, tc.name, tc.publicKey); (err == nil) != tc.ok {
+			t.Errorf("claim of %s with %s: unexpected result %v", tc.name, tc.publicKey, err)
+		}
+	}
+	// the name of the legacy user can't be taken, and the legacy user is still created
+	if err := sss.CreateUser("legacy", testKey("mallory")); err == nil {
+		t.Errorf("name of legacy user is taken")
+	}
+	if err := sss.CreateUser("legacy", testKey("legacy")); err == nil {
+		t.Errorf("legacy user is created again")
+	}
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	c.setSetting(SettingAdmins, testKey("admin"))
+	createTestUsers(t, sss, "admin", "doctor")
+	u, err := sss.GetUser(MakeAddress(AddressTypeUser, "admin", testKey("admin")))
+	if err != nil || u.Role != user.UserRoleAdmin {
+		t.Errorf("admin isn't created with the admin role: %+v, %v", u, err)
+	}
+	cases := []struct {
+		adminKey, name, publicKey string
+		role                      user.UserRole
+		organization              string
+		ok                        bool
+	}{
+		{testKey("doctor"), "doctor", testKey("doctor"), user.UserRolePractitioner, "", false}, // only admins elevate
+		{testKey("admin"), "doctor", testKey("doctor"), user.UserRoleAdmin, "", false},         // admins follow the setting
+		{testKey("admin"), "stranger", testKey("stranger"), user.UserRolePractitioner, "", false},
+		{testKey("admin"), "doctor", testKey("doctor"), user.UserRolePractitioner, "Hospital A", false},
+		{testKey("admin"), "doctor", testKey("doctor"), user.UserRolePractitioner, "HospitalA", true},
+	}
+	for i, tc := range cases {
+		if err := sss.UpdateUserRole(tc.adminKey, tc.name, tc.publicKey, tc.role, tc.organization); (err == nil) != tc.ok {
+			t.Errorf("case %d: unexpected result %v", i, err)
+		}
+	}
+	u, err = sss.GetUser(MakeAddress(AddressTypeUser, "doctor", testKey("doctor")))
+	if err != nil || u.Role != user.UserRolePractitioner || u.Organization != "HospitalA" {
+		t.Errorf("unexpected user %+v, %v", u, err)
+	}
+}
+
+func TestThirdPartyRequestRole(t *testing.T) {
+	sss, c := newMockState(1600000000)
+	c.setSetting(SettingAdmins, testKey("admin"))
+	createTestUsers(t, sss, "patient", "doctor", "responder", "impostor")
+	if err := sss.UpdateUserRole(testKey("admin"), "responder", testKey("responder"), user.UserRoleResponder, ""); err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func(id string) request.Request {
+		return *request.NewRequest(id, "doctor", testKey("doctor"), "patient", "", "", []string{testHash("record")}, storage.Regular)
+	}
+	if _, err := sss.CreateRequest("impostor", testKey("impostor"), newRequest("impostor")); err == nil {
+		t.Errorf("third party request of user who isn't responder is created")
+	}
+	// the request to the patient doesn't need the role
+	own := newRequest("own")
+	own.RequestFrom = "patient"
+	own.RequestFromKey = testKey("patient")
+	if _, err := sss.CreateRequest("impostor", testKey("impostor"), own); err != nil {
+		t.Errorf("failed to create request to the patient: %v", err)
+	}
+	for _, id := range []string{"accepted", "demoted"} {
+		if _, err := sss.CreateRequest("responder", testKey("responder"), newRequest(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, err := sss.ProcessRequest("accepted", testKey("doctor"), true); err != nil || r.Status != request.StatusAccepted {
+		t.Errorf("failed to accept request of responder: %+v, %v", r, err)
+	}
+
+	// the role is checked again when the request is accepted, but the request can still be rejected
+	if err := sss.UpdateUserRole(testKey("admin"), "responder", testKey("responder"), user.UserRolePatient, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sss.ProcessRequest("demoted", testKey("doctor"), true); err == nil {
+		t.Errorf("request of demoted responder is accepted")
+	}
+	if _, err := sss.ProcessRequest("demoted", testKey("doctor"), false); err != nil {
+		t.Errorf("failed to reject request of demoted responder: %v", err)
+	}
+}
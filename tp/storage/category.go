@@ -0,0 +1,35 @@
+package storage
+
+// Categories of clinical records.
+// The data without category is stored before the categories, or it isn't a clinical record.
+var (
+	CategoryAllergy      = "allergy"
+	CategoryMedication   = "medication"
+	CategoryLabResult    = "lab-result"
+	CategoryDiagnosis    = "diagnosis"
+	CategoryImmunization = "immunization"
+	CategoryVitalSign    = "vital-sign"
+)
+
+// Categories lists all the categories of clinical records.
+var Categories = []string{
+	CategoryAllergy,
+	CategoryMedication,
+	CategoryLabResult,
+	CategoryDiagnosis,
+	CategoryImmunization,
+	CategoryVitalSign,
+}
+
+// ValidCategory reports whether the category is empty or one of the categories.
+func ValidCategory(category string) bool {
+	if category == "" {
+		return true
+	}
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -56,3 +56,19 @@ func (fkm *FileKeyMap) AddKey(key string, used bool) string {
 	fkm.Keys = append(fkm.Keys, fileKey)
 	return index
 }
+
+// RemoveKey decrease the used count of key by index.
+// If the key is not used anymore, it will be removed.
+// If the key doesn't exist, it returns false.
+func (fkm *FileKeyMap) RemoveKey(index string) bool {
+	for i, fileKey := range fkm.Keys {
+		if fileKey.Index == index {
+			fileKey.Used--
+			if fileKey.Used <= 0 {
+				fkm.Keys = append(fkm.Keys[:i], fkm.Keys[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
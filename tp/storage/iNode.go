@@ -1,8 +1,6 @@
 package storage
 
 import (
-	"bytes"
-	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"sync"
@@ -22,6 +20,11 @@ type INode interface {
 	GetAddr() string
 	GetKeys() []string
 	GetAccessType() uint
+	GetSource() string
+	GetVersion() uint
+	GetPrev() string
+	GetExpiration() int64
+	GetCategory() string
 	ToBytes() []byte
 	ToJson() string
 	lock()
@@ -36,6 +39,26 @@ type Data struct {
 	KeyIndex   string
 	Addr       string
 	AccessType uint
+	Source     string
+	Version    uint
+	Prev       string
+	Expiration int64
+	Next       string
+	Origin     string
+	Policy     string
+	Category   string
+	// The key of data encrypted for the patient by proxy re-encryption, set on the copies shared with trusted parties.
+	ForwardKey string
+	// The copies shared from the data, which are deleted together with it.
+	Copies []DataRef
+}
+
+// DataRef refers to the data of the owner by hash and address.
+type DataRef struct {
+	Owner    string
+	OwnerKey string
+	Hash     string
+	Addr     string
 }
 
 type Repo struct {
@@ -85,10 +108,7 @@ func (d *Repo) GetKeys() []string {
 }
 
 func (d *Repo) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(d)
-	return buf.Bytes()
+	return d.toProto()
 }
 
 func (d *Repo) ToJson() string {
@@ -132,11 +152,50 @@ func (d *Data) GetAccessType() uint {
 	return d.AccessType
 }
 
+func (d *Data) GetSource() string {
+	return d.Source
+}
+
+// GetVersion returns the version of data.
+// The data created before versioning is the first version.
+func (d *Data) GetVersion() uint {
+	if d.Version == 0 {
+		return 1
+	}
+	return d.Version
+}
+
+func (d *Data) GetPrev() string {
+	return d.Prev
+}
+
+func (d *Data) GetExpiration() int64 {
+	return d.Expiration
+}
+
+func (d *Data) GetCategory() string {
+	return d.Category
+}
+
+// IsExpired reports whether the data is expired at the unix time.
+// The data without expiration never expires.
+func (d *Data) IsExpired(now int64) bool {
+	return d.Expiration != 0 && d.Expiration <= now
+}
+
+// AddCopy records the copy shared from the data. It returns false if the copy is already recorded.
+func (d *Data) AddCopy(ref DataRef) bool {
+	for _, c := range d.Copies {
+		if c == ref {
+			return false
+		}
+	}
+	d.Copies = append(d.Copies, ref)
+	return true
+}
+
 func (d *Data) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(d)
-	return buf.Bytes()
+	return d.toProto()
 }
 
 func (d *Data) ToJson() string {
@@ -144,11 +203,11 @@ func (d *Data) ToJson() string {
 	return string(data)
 }
 
-func (r *Repo) CreateData(name, hash, keyIndex, addr string, size int64, accessType uint) error {
+func (r *Repo) CreateData(name, hash, keyIndex, addr string, size int64, accessType uint) (*Data, error) {
 
 	for j := 0; j < len(r.INodes); j++ {
 		if r.INodes[j].GetHash() == hash && r.INodes[j].GetAddr() == addr {
-			return errors.New("data already exists")
+			return nil, errors.New("data already exists")
 		}
 	}
 	r.lock()
@@ -160,8 +219,45 @@ func (r *Repo) CreateData(name, hash, keyIndex, addr string, size int64, accessT
 	data.Addr = addr
 	data.AccessType = accessType
 	r.INodes = append(r.INodes, data)
+	return data, nil
+}
+
+// checkNextVersion returns the data whose previous version is the hash.
+func (d *Repo) checkNextVersion(hash, addr string) *Data {
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Data:
+			if iNode.GetPrev() == hash && iNode.GetAddr() == addr {
+				return iNode.(*Data)
+			}
+		}
+	}
 	return nil
 }
+
+// DeleteData removes the data by hash and address, and returns it.
+func (r *Repo) DeleteData(hash, addr string) (*Data, error) {
+	r.lock()
+	defer r.unlock()
+	for i, iNode := range r.INodes {
+		switch iNode.(type) {
+		case *Data:
+			if iNode.GetHash() == hash && iNode.GetAddr() == addr {
+				r.INodes = append(r.INodes[:i], r.INodes[i+1:]...)
+				return iNode.(*Data), nil
+			}
+		}
+	}
+	return nil, errors.New("data doesn't exist")
+}
+
+// FindData returns the data by hash and address.
+// If it doesn't exist, nil will be returned.
+func (d *Repo) FindData(hash, addr string) *Data {
+	data, _ := d.checkDataExists(hash, addr)
+	return data
+}
+
 func (d *Repo) checkDataExists(hash, addr string) (*Data, error) {
 
 	for _, iNode := range d.INodes {
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"errors"
+
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+// Encoding of storage messages defined in healthcare.proto.
+
+func (fk *FileKey) toProto() []byte {
+	e := protos.NewEncoder()
+	e.String(1, fk.Index)
+	e.Int(2, int64(fk.Used))
+	e.String(3, fk.Key)
+	e.Bool(4, fk.Published)
+	return e.ToBytes()
+}
+
+func fileKeyFromProto(data []byte) (*FileKey, error) {
+	fk := &FileKey{}
+	err := protos.Decode(data, func(f protos.Field) (err error) {
+		switch f.Num {
+		case 1:
+			fk.Index, err = f.String()
+		case 2:
+			var used int64
+			used, err = f.Int()
+			fk.Used = int(used)
+		case 3:
+			fk.Key, err = f.String()
+		case 4:
+			fk.Published, err = f.Bool()
+		}
+		return
+	})
+	return fk, err
+}
+
+func (fkm *FileKeyMap) toProto() []byte {
+	e := protos.NewEncoder()
+	for _, key := range fkm.Keys {
+		e.Message(1, key.toProto())
+	}
+	return e.ToBytes()
+}
+
+func fileKeyMapFromProto(data []byte) (*FileKeyMap, error) {
+	fkm := NewFileKeyMap()
+	err := protos.Decode(data, func(f protos.Field) error {
+		if f.Num != 1 {
+			return nil
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		key, err := fileKeyFromProto(b)
+		if err != nil {
+			return err
+		}
+		fkm.Keys = append(fkm.Keys, key)
+		return nil
+	})
+	return fkm, err
+}
+
+func (d *Data) toProto() []byte {
+	e := protos.NewEncoder()
+	e.String(1, d.Name)
+	e.String(2, d.Hash)
+	e.Int(3, d.Size)
+	e.String(4, d.KeyIndex)
+	e.String(5, d.Addr)
+	e.Uint(6, uint64(d.AccessType))
+	e.String(7, d.Source)
+	e.Uint(8, uint64(d.Version))
+	e.String(9, d.Prev)
+	e.Int(10, d.Expiration)
+	for _, ref := range d.Copies {
+		e.Message(11, ref.toProto())
+	}
+	e.String(12, d.Next)
+	e.String(13, d.Origin)
+	e.String(14, d.Policy)
+	e.String(15, d.Category)
+	e.String(16, d.ForwardKey)
+	return e.ToBytes()
+}
+
+func dataFromProto(data []byte) (*Data, error) {
+	d := &Data{}
+	err := protos.Decode(data, func(f protos.Field) (err error) {
+		var v uint64
+		switch f.Num {
+		case 1:
+			d.Name, err = f.String()
+		case 2:
+			d.Hash, err = f.String()
+		case 3:
+			d.Size, err = f.Int()
+		case 4:
+			d.KeyIndex, err = f.String()
+		case 5:
+			d.Addr, err = f.String()
+		case 6:
+			v, err = f.Uint()
+			d.AccessType = uint(v)
+		case 7:
+			d.Source, err = f.String()
+		case 8:
+			v, err = f.Uint()
+			d.Version = uint(v)
+		case 9:
+			d.Prev, err = f.String()
+		case 10:
+			d.Expiration, err = f.Int()
+		case 11:
+			var b []byte
+			var ref *DataRef
+			b, err = f.Bytes()
+			if err == nil {
+				ref, err = dataRefFromProto(b)
+			}
+			if err == nil {
+				d.Copies = append(d.Copies, *ref)
+			}
+		case 12:
+			d.Next, err = f.String()
+		case 13:
+			d.Origin, err = f.String()
+		case 14:
+			d.Policy, err = f.String()
+		case 15:
+			d.Category, err = f.String()
+		case 16:
+			d.ForwardKey, err = f.String()
+		}
+		return
+	})
+	return d, err
+}
+
+func (ref *DataRef) toProto() []byte {
+	e := protos.NewEncoder()
+	e.String(1, ref.Owner)
+	e.String(2, ref.OwnerKey)
+	e.String(3, ref.Hash)
+	e.String(4, ref.Addr)
+	return e.ToBytes()
+}
+
+func dataRefFromProto(data []byte) (*DataRef, error) {
+	ref := &DataRef{}
+	err := protos.Decode(data, func(f protos.Field) (err error) {
+		switch f.Num {
+		case 1:
+			ref.Owner, err = f.String()
+		case 2:
+			ref.OwnerKey, err = f.String()
+		case 3:
+			ref.Hash, err = f.String()
+		case 4:
+			ref.Addr, err = f.String()
+		}
+		return
+	})
+	return ref, err
+}
+
+func (d *Repo) toProto() []byte {
+	e := protos.NewEncoder()
+	e.String(1, d.Name)
+	e.String(2, d.Hash)
+	e.String(3, d.Addr)
+	e.Int(4, d.Size)
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Data:
+			e.Message(5, iNode.(*Data).toProto())
+		}
+	}
+	return e.ToBytes()
+}
+
+func repoFromProto(data []byte) (*Repo, error) {
+	r := NewRepo("")
+	err := protos.Decode(data, func(f protos.Field) (err error) {
+		switch f.Num {
+		case 1:
+			r.Name, err = f.String()
+		case 2:
+			r.Hash, err = f.String()
+		case 3:
+			r.Addr, err = f.String()
+		case 4:
+			r.Size, err = f.Int()
+		case 5:
+			var b []byte
+			var d *Data
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			d, err = dataFromProto(b)
+			if err != nil {
+				return
+			}
+			r.INodes = append(r.INodes, d)
+		}
+		return
+	})
+	return r, err
+}
+
+// ToRecord convert data to the DataRecord message stored at the address of data.
+func (d *Data) ToRecord() []byte {
+	e := protos.NewVersionedEncoder()
+	e.Message(2, d.toProto())
+	return e.ToBytes()
+}
+
+// DataFromRecord convert data from the DataRecord message.
+func DataFromRecord(data []byte) (*Data, error) {
+	var d *Data
+	err := protos.DecodeVersioned(data, func(f protos.Field) error {
+		if f.Num != 2 {
+			return nil
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		d, err = dataFromProto(b)
+		return err
+	})
+	if err == nil && d == nil {
+		err = errors.New("data is missing")
+	}
+	return d, err
+}
+
+// ToRecord convert key to the KeyRecord message stored at the address of key.
+func (fk *FileKey) ToRecord() []byte {
+	e := protos.NewVersionedEncoder()
+	e.Message(2, fk.toProto())
+	return e.ToBytes()
+}
+
+// FileKeyFromRecord convert key from the KeyRecord message.
+func FileKeyFromRecord(data []byte) (*FileKey, error) {
+	var fk *FileKey
+	err := protos.DecodeVersioned(data, func(f protos.Field) error {
+		if f.Num != 2 {
+			return nil
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		fk, err = fileKeyFromProto(b)
+		return err
+	})
+	if err == nil && fk == nil {
+		err = errors.New("key is missing")
+	}
+	return fk, err
+}
+
+// ToProto convert root to the Root message.
+func (root *Root) ToProto() []byte {
+	e := protos.NewEncoder()
+	if root.Repo != nil {
+		e.Message(1, root.Repo.toProto())
+	}
+	if root.Keys != nil {
+		e.Message(2, root.Keys.toProto())
+	}
+	return e.ToBytes()
+}
+
+// RootFromProto convert root from the Root message.
+func RootFromProto(data []byte) (*Root, error) {
+	root := &Root{}
+	err := protos.Decode(data, func(f protos.Field) error {
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		switch f.Num {
+		case 1:
+			root.Repo, err = repoFromProto(b)
+		case 2:
+			root.Keys, err = fileKeyMapFromProto(b)
+		}
+		return err
+	})
+	return root, err
+}
+
+// ToProto convert data info to the DataInfo message.
+func (info *DataInfo) ToProto() []byte {
+	e := protos.NewEncoder()
+	e.String(1, info.Name)
+	e.Int(2, info.Size)
+	e.String(3, info.Hash)
+	e.String(4, info.Key)
+	e.String(5, info.Addr)
+	e.Uint(6, uint64(info.AccessType))
+	e.String(7, info.Source)
+	e.Uint(8, uint64(info.Version))
+	e.String(9, info.Prev)
+	e.Int(10, info.Expiration)
+	e.String(11, info.Origin)
+	e.String(12, info.Policy)
+	e.String(13, info.Category)
+	e.String(14, info.ForwardKey)
+	return e.ToBytes()
+}
+
+// DataInfoFromProto convert data info from the DataInfo message.
+func DataInfoFromProto(data []byte) (*DataInfo, error) {
+	info := &DataInfo{}
+	err := protos.Decode(data, func(f protos.Field) (err error) {
+		var v uint64
+		switch f.Num {
+		case 1:
+			info.Name, err = f.String()
+		case 2:
+			info.Size, err = f.Int()
+		case 3:
+			info.Hash, err = f.String()
+		case 4:
+			info.Key, err = f.String()
+		case 5:
+			info.Addr, err = f.String()
+		case 6:
+			v, err = f.Uint()
+			info.AccessType = uint(v)
+		case 7:
+			info.Source, err = f.String()
+		case 8:
+			v, err = f.Uint()
+			info.Version = uint(v)
+		case 9:
+			info.Prev, err = f.String()
+		case 10:
+			info.Expiration, err = f.Int()
+		case 11:
+			info.Origin, err = f.String()
+		case 12:
+			info.Policy, err = f.String()
+		case 13:
+			info.Category, err = f.String()
+		case 14:
+			info.ForwardKey, err = f.String()
+		}
+		return
+	})
+	return info, err
+}
@@ -1,10 +1,12 @@
 package storage
 
 import (
-	"bytes"
 	"encoding/gob"
+	"errors"
+	"fmt"
 )
 
+// Types stored in INodes are registered to decode legacy gob state.
 func init() {
 	gob.Register(&Data{})
 	gob.Register(&Repo{})
@@ -24,6 +26,14 @@ type DataInfo struct {
 	Key        string
 	Addr       string
 	AccessType uint
+	Source     string
+	Version    uint
+	Prev       string
+	Expiration int64
+	Origin     string
+	Policy     string
+	Category   string
+	ForwardKey string
 }
 
 // NewRoot is the construct for Root.
@@ -53,14 +63,109 @@ func GenerateRoot() *Root {
 
 // CreateFile generate file in the path and store its information.
 func (root *Root) CreateData(info DataInfo) error {
-	fileKeyIndex := root.Keys.AddKey(info.Key, true)
-	err := root.Repo.CreateData(info.Name, info.Hash, fileKeyIndex, info.Addr, info.Size, info.AccessType)
+	d, err := root.Repo.CreateData(info.Name, info.Hash, "", info.Addr, info.Size, info.AccessType)
 	if err != nil {
 		return err
 	}
+	// the copy shared with the trusted party holding the re-encryption key has the forward key only
+	if info.Key != "" {
+		d.KeyIndex = root.Keys.AddKey(info.Key, true)
+	}
+	d.Source = info.Source
+	d.Version = info.Version
+	d.Prev = info.Prev
+	d.Expiration = info.Expiration
+	d.Origin = info.Origin
+	d.Policy = info.Policy
+	d.Category = info.Category
+	d.ForwardKey = info.ForwardKey
 	return nil
 }
 
+// UpdateData generate the next version of data in the path.
+// The previous version must exist and must not be updated yet.
+func (root *Root) UpdateData(info DataInfo) error {
+	prev, err := root.Repo.checkDataExists(info.Prev, info.Addr)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		return errors.New("previous version doesn't exist")
+	}
+	if prev.Next != "" || root.Repo.checkNextVersion(info.Prev, info.Addr) != nil {
+		return errors.New("previous version is already updated")
+	}
+	if info.Name != prev.Name {
+		return errors.New("name of versions must be the same")
+	}
+	if info.Category != prev.Category {
+		return errors.New("category of versions must be the same")
+	}
+	if info.Version != prev.GetVersion()+1 {
+		return fmt.Errorf("invalid version: expected %d", prev.GetVersion()+1)
+	}
+	err = root.CreateData(info)
+	if err != nil {
+		return err
+	}
+	prev.Next = info.Hash
+	return nil
+}
+
+// DeleteData removes the data in the path and releases the key used to encrypt it.
+// The previous version of the data can be updated again.
+func (root *Root) DeleteData(hash, addr string) error {
+	d, err := root.Repo.DeleteData(hash, addr)
+	if err != nil {
+		return err
+	}
+	root.Keys.RemoveKey(d.KeyIndex)
+	if prev := root.Repo.FindData(d.Prev, addr); prev != nil && prev.Next == d.Hash {
+		prev.Next = ""
+	}
+	return nil
+}
+
+// DeleteDataWithShares removes the data in the path, and every copy shared from it.
+// The keys which are not used anymore are released. It returns the removed data.
+func (root *Root) DeleteDataWithShares(hash, addr string) ([]*Data, error) {
+	d, err := root.Repo.checkDataExists(hash, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, errors.New("data doesn't exist")
+	}
+	// copies shared before the source was stored are matched by their name
+	sharedName := fmt.Sprintf("shared_by_%s_%s", addr, d.Name)
+	removed := []*Data{d}
+	sources := map[string]bool{d.Hash: true}
+	for found := true; found; {
+		found = false
+		for _, iNode := range root.Repo.INodes {
+			if iNode.GetHash() == hash && iNode.GetAddr() == addr {
+				continue
+			}
+			if sources[iNode.GetSource()] || (iNode.GetSource() == "" && iNode.GetName() == sharedName) {
+				shared, err := root.Repo.DeleteData(iNode.GetHash(), iNode.GetAddr())
+				if err != nil {
+					return nil, err
+				}
+				root.Keys.RemoveKey(shared.KeyIndex)
+				removed = append(removed, shared)
+				sources[iNode.GetHash()] = true
+				found = true
+				break
+			}
+		}
+	}
+	err = root.DeleteData(hash, addr)
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
 func (root *Root) GetData(hash, addr string) (data *DataInfo, err error) {
 	f, err := root.Repo.checkDataExists(hash, addr)
 	if err != nil {
@@ -69,23 +174,85 @@ func (root *Root) GetData(hash, addr string) (data *DataInfo, err error) {
 	if f == nil {
 		return nil, nil
 	}
-	key := root.Keys.GetKey(f.KeyIndex)
-	return NewDataInfo(f.Name, f.Size, f.Hash, key.Key, addr, f.AccessType), nil
+	var key string
+	if fileKey := root.Keys.GetKey(f.KeyIndex); fileKey != nil {
+		key = fileKey.Key
+	}
+	info := NewDataInfo(f.Name, f.Size, f.Hash, key, addr, f.AccessType)
+	info.Source = f.Source
+	info.Version = f.GetVersion()
+	info.Prev = f.Prev
+	info.Expiration = f.Expiration
+	info.Origin = f.Origin
+	info.Policy = f.Policy
+	info.Category = f.Category
+	info.ForwardKey = f.ForwardKey
+	return info, nil
+}
+
+// GetSharedData returns the data by hash shared to the address.
+// If the data doesn't exist or it is expired at the unix time, error will be returned.
+func (root *Root) GetSharedData(hash, addr string, now int64) (*Data, error) {
+	d, err := root.Repo.checkDataExists(hash, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, errors.New("data isn't shared with the user")
+	}
+	if d.IsExpired(now) {
+		return nil, errors.New("access to the data is expired")
+	}
+	return d, nil
+}
+
+// NewDataFromInfo is the construct for Data by the information of data.
+// The key of data is stored separately by the index.
+func NewDataFromInfo(info DataInfo, keyIndex string) *Data {
+	d := NewData(info.Name)
+	d.Hash = info.Hash
+	d.Size = info.Size
+	d.KeyIndex = keyIndex
+	d.Addr = info.Addr
+	d.AccessType = info.AccessType
+	d.Source = info.Source
+	d.Version = info.Version
+	d.Prev = info.Prev
+	d.Expiration = info.Expiration
+	d.Origin = info.Origin
+	d.Policy = info.Policy
+	d.Category = info.Category
+	d.ForwardKey = info.ForwardKey
+	return d
+}
+
+// PruneExpiredData removes the data which is expired at the unix time.
+// It returns the hashes of removed data.
+func (root *Root) PruneExpiredData(now int64) []string {
+	var expired []*Data
+	for _, iNode := range root.Repo.INodes {
+		switch iNode.(type) {
+		case *Data:
+			if iNode.(*Data).IsExpired(now) {
+				expired = append(expired, iNode.(*Data))
+			}
+		}
+	}
+	var removed []string
+	for _, d := range expired {
+		if root.DeleteData(d.Hash, d.Addr) == nil {
+			removed = append(removed, d.Hash)
+		}
+	}
+	return removed
 }
 
 // ToBytes convert root to byte slice.
 func (root *Root) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(root)
-	return buf.Bytes()
+	return root.ToProto()
 }
 
 // RootFromBytes convert root from byte slice.
 func RootFromBytes(data []byte) (*Root, error) {
-	root := &Root{}
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(root)
-	return root, err
+	return RootFromProto(data)
 }
@@ -3,7 +3,9 @@ package user
 import (
 	"bytes"
 	"encoding/gob"
+	"healthcare-system-sawtooth/tp/protos"
 	"healthcare-system-sawtooth/tp/storage"
+	"sort"
 )
 
 type Role uint8
@@ -35,45 +37,141 @@ func GenerateGroup(name, leader string) *Group {
 	return NewGroup(name, leader, map[string]Role{leader: RoleOwner}, storage.GenerateRoot())
 }
 
+// ValidRole reports whether the role is one of the group roles.
+func ValidRole(role Role) bool {
+	return role >= RoleGuest && role <= RoleOwner
+}
+
+// UpdateLeader transfers the leadership to another member of the group.
+// The new leader becomes an owner of the group.
 func (g *Group) UpdateLeader(user, newLeader string) bool {
-	if user == g.Leader {
-		g.Leader = newLeader
-		return true
+	if user != g.Leader {
+		return false
 	}
-	return false
+	if _, ok := g.Members[newLeader]; !ok {
+		return false
+	}
+	g.Leader = newLeader
+	g.Members[newLeader] = RoleOwner
+	return true
 }
 
-func (g *Group) UpdateMemberRole(user, member string, role Role) bool {
+// AddMember adds new member to the group with the role.
+// Only owners can add members, and only the leader can add other owners.
+func (g *Group) AddMember(user, member string, role Role) bool {
 	if g.Members[user] != RoleOwner {
 		return false
-	} else if g.Members[member] == RoleOwner && g.Leader != user {
+	} else if role == RoleOwner && g.Leader != user {
+		return false
+	}
+	if _, ok := g.Members[member]; ok {
 		return false
 	}
 	g.Members[member] = role
 	return true
 }
 
-func (g *Group) RemoveMember(user, member string) bool {
+// IsMember reports whether the member belongs to the group.
+func (g *Group) IsMember(member string) bool {
+	_, ok := g.Members[member]
+	return ok
+}
+
+// UpdateMemberRole changes the role of the member.
+// The role of the leader cannot be changed.
+func (g *Group) UpdateMemberRole(user, member string, role Role) bool {
 	if g.Members[user] != RoleOwner {
 		return false
-	} else if g.Members[member] == RoleOwner && g.Leader != user {
+	} else if !g.IsMember(member) || member == g.Leader {
+		return false
+	} else if (g.Members[member] == RoleOwner || role == RoleOwner) && g.Leader != user {
 		return false
 	}
+	g.Members[member] = role
+	return true
+}
+
+// RemoveMember removes the member from the group.
+// Members are able to leave the group by themselves, except the leader.
+func (g *Group) RemoveMember(user, member string) bool {
+	if !g.IsMember(member) || member == g.Leader {
+		return false
+	}
+	if user != member {
+		if g.Members[user] != RoleOwner {
+			return false
+		} else if g.Members[member] == RoleOwner && g.Leader != user {
+			return false
+		}
+	}
 	delete(g.Members, member)
 	return true
 }
 
+// ToBytes encodes the group as the versioned Group message.
+// Members are sorted by the public key to keep the encoding deterministic.
 func (g *Group) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(g)
-	return buf.Bytes()
+	e := protos.NewVersionedEncoder()
+	e.String(2, g.Name)
+	e.String(3, g.Leader)
+	members := make([]string, 0, len(g.Members))
+	for member := range g.Members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		me := protos.NewEncoder()
+		me.String(1, member)
+		me.Uint(2, uint64(g.Members[member]))
+		e.Message(4, me.ToBytes())
+	}
+	if g.Root != nil {
+		e.Message(5, g.Root.ToProto())
+	}
+	return e.ToBytes()
 }
 
+// GroupFromBytes decodes the group from both the versioned Group message and legacy gob encoding.
 func GroupFromBytes(data []byte) (*Group, error) {
-	g := &Group{}
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(g)
+	g := &Group{Members: make(map[string]Role)}
+	if !protos.IsVersioned(data) {
+		buf := bytes.NewBuffer(data)
+		dec := gob.NewDecoder(buf)
+		err := dec.Decode(g)
+		return g, err
+	}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		var b []byte
+		switch f.Num {
+		case 2:
+			g.Name, err = f.String()
+		case 3:
+			g.Leader, err = f.String()
+		case 4:
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			var member string
+			var role uint64
+			err = protos.Decode(b, func(mf protos.Field) (err error) {
+				switch mf.Num {
+				case 1:
+					member, err = mf.String()
+				case 2:
+					role, err = mf.Uint()
+				}
+				return
+			})
+			g.Members[member] = Role(role)
+		case 5:
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			g.Root, err = storage.RootFromProto(b)
+		}
+		return
+	})
 	return g, err
 }
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"testing"
+)
+
+// testGroup returns the group led by the leader, with the owner, the developer and the guest.
+func testGroup() *Group {
+	return NewGroup("cardiology", "leader", map[string]Role{
+		"leader":    RoleOwner,
+		"owner":     RoleOwner,
+		"developer": RoleDeveloper,
+		"guest":     RoleGuest,
+	}, nil)
+}
+
+func TestAddMember(t *testing.T) {
+	cases := []struct {
+		user, member string
+		role         Role
+		ok           bool
+	}{
+		{"leader", "new", RoleGuest, true},
+		{"leader", "new", RoleOwner, true},
+		{"owner", "new", RoleMaintainer, true},
+		{"owner", "new", RoleOwner, false}, // only the leader adds owners
+		{"developer", "new", RoleGuest, false},
+		{"stranger", "new", RoleGuest, false},
+		{"leader", "guest", RoleDeveloper, false}, // already a member
+	}
+	for _, c := range cases {
+		g := testGroup()
+		if ok := g.AddMember(c.user, c.member, c.role); ok != c.ok {
+			t.Errorf("%s adds %s as %d: expected %v", c.user, c.member, c.role, c.ok)
+		} else if ok && g.Members[c.member] != c.role {
+			t.Errorf("%s adds %s as %d: role is %d", c.user, c.member, c.role, g.Members[c.member])
+		}
+	}
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	cases := []struct {
+		user, member string
+		role         Role
+		ok           bool
+	}{
+		{"leader", "guest", RoleDeveloper, true},
+		{"leader", "guest", RoleOwner, true},
+		{"leader", "owner", RoleGuest, true},
+		{"owner", "guest", RoleMaintainer, true},
+		{"owner", "guest", RoleOwner, false},     // only the leader promotes to owner
+		{"owner", "leader", RoleGuest, false},    // the role of the leader can't be changed
+		{"leader", "leader", RoleGuest, false},   // even by the leader
+		{"developer", "guest", RoleGuest, false}, // only owners change roles
+		{"leader", "stranger", RoleGuest, false},
+	}
+	for _, c := range cases {
+		g := testGroup()
+		if ok := g.UpdateMemberRole(c.user, c.member, c.role); ok != c.ok {
+			t.Errorf("%s changes %s to %d: expected %v", c.user, c.member, c.role, c.ok)
+		} else if ok && g.Members[c.member] != c.role {
+			t.Errorf("%s changes %s to %d: role is %d", c.user, c.member, c.role, g.Members[c.member])
+		}
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	cases := []struct {
+		user, member string
+		ok           bool
+	}{
+		{"leader", "owner", true},
+		{"leader", "guest", true},
+		{"owner", "developer", true},
+		{"guest", "guest", true},      // members leave by themselves
+		{"owner", "owner", true},      // owners too
+		{"owner", "leader", false},    // the leader can't be removed
+		{"leader", "leader", false},   // nor leave, so the group always has a member
+		{"developer", "guest", false}, // only owners remove others
+		{"leader", "stranger", false},
+	}
+	for _, c := range cases {
+		g := testGroup()
+		if ok := g.RemoveMember(c.user, c.member); ok != c.ok {
+			t.Errorf("%s removes %s: expected %v", c.user, c.member, c.ok)
+		} else if ok && g.IsMember(c.member) {
+			t.Errorf("%s removes %s: still a member", c.user, c.member)
+		}
+	}
+
+	// the leader is the last member, who can't leave
+	g := GenerateGroup("cardiology", "leader")
+	if g.RemoveMember("leader", "leader") || len(g.Members) != 1 {
+		t.Errorf("the last member left the group")
+	}
+}
+
+func TestUpdateLeader(t *testing.T) {
+	cases := []struct {
+		user, newLeader string
+		ok              bool
+	}{
+		{"leader", "guest", true},
+		{"leader", "owner", true},
+		{"owner", "guest", false}, // only the leader transfers the leadership
+		{"guest", "guest", false},
+		{"leader", "stranger", false},
+	}
+	for _, c := range cases {
+		g := testGroup()
+		if ok := g.UpdateLeader(c.user, c.newLeader); ok != c.ok {
+			t.Errorf("%s transfers to %s: expected %v", c.user, c.newLeader, c.ok)
+		} else if ok && (g.Leader != c.newLeader || g.Members[c.newLeader] != RoleOwner) {
+			t.Errorf("%s transfers to %s: leader is %s with role %d", c.user, c.newLeader, g.Leader, g.Members[c.newLeader])
+		}
+	}
+
+	// the former leader can leave after the transfer
+	g := testGroup()
+	g.UpdateLeader("leader", "guest")
+	if !g.RemoveMember("leader", "leader") {
+		t.Errorf("the former leader can't leave")
+	}
+}
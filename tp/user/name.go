@@ -0,0 +1,41 @@
+package user
+
+import (
+	"healthcare-system-sawtooth/tp/protos"
+)
+
+// Name is the entry of name registry, which binds the username to the public key.
+type Name struct {
+	Name      string
+	PublicKey string
+}
+
+func NewName(username, publicKey string) *Name {
+	return &Name{
+		Name:      username,
+		PublicKey: publicKey,
+	}
+}
+
+// ToBytes encodes the name as the versioned Name message.
+func (n *Name) ToBytes() []byte {
+	e := protos.NewVersionedEncoder()
+	e.String(2, n.Name)
+	e.String(3, n.PublicKey)
+	return e.ToBytes()
+}
+
+// NameFromBytes decodes the name from the versioned Name message.
+func NameFromBytes(data []byte) (*Name, error) {
+	n := &Name{}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		switch f.Num {
+		case 2:
+			n.Name, err = f.String()
+		case 3:
+			n.PublicKey, err = f.String()
+		}
+		return
+	})
+	return n, err
+}
@@ -3,14 +3,39 @@ package user
 import (
 	"bytes"
 	"encoding/gob"
+	"healthcare-system-sawtooth/tp/protos"
 	"healthcare-system-sawtooth/tp/storage"
 )
 
+// UserRole is the role of user in the healthcare system.
+type UserRole uint8
+
+var (
+	UserRolePatient      UserRole = 0
+	UserRolePractitioner UserRole = 1
+	UserRoleResponder    UserRole = 2
+	UserRoleAdmin        UserRole = 3
+)
+
+// MaxApprovers is the limit of the approvers of critical requests.
+const MaxApprovers = 10
+
+var userRoleNames = []string{"patient", "practitioner", "responder", "admin"}
+
 type User struct {
-	Name      string
-	PublicKey string
-	Groups    []string
-	Root      *storage.Root
+	Name         string
+	PublicKey    string
+	Groups       []string
+	Root         *storage.Root
+	Role         UserRole
+	Organization string
+	Records      uint64 // Number of data stored by the user, accounted against the quotas
+	DataSize     int64  // Total size of data stored by the user
+	// Trusted parties who approve critical requests to the data of the user.
+	// Critical requests need ApprovalThreshold approvals, or single approval if it's 0.
+	Approvers         []string
+	ApproverKeys      []string
+	ApprovalThreshold uint
 }
 
 func NewUser(username, publicKey string, groups []string, root *storage.Root) *User {
@@ -22,8 +47,34 @@ func NewUser(username, publicKey string, groups []string, root *storage.Root) *U
 	}
 }
 
+// GenerateUser generate new user for usage.
+// The data of user is stored at their own addresses, so the root is nil.
 func GenerateUser(username, publicKey string) *User {
-	return NewUser(username, publicKey, make([]string, 0), storage.GenerateRoot())
+	return NewUser(username, publicKey, make([]string, 0), nil)
+}
+
+// ValidUserRole reports whether the role is one of the user roles.
+func ValidUserRole(role UserRole) bool {
+	return role <= UserRoleAdmin
+}
+
+// String returns the name of the role used by the access policies.
+func (role UserRole) String() string {
+	if !ValidUserRole(role) {
+		return ""
+	}
+	return userRoleNames[role]
+}
+
+// SetApprovers configures the approvers of critical requests.
+// The approvers are cleared if the threshold is 0.
+func (u *User) SetApprovers(names, keys []string, threshold uint) {
+	if threshold == 0 {
+		names, keys = nil, nil
+	}
+	u.Approvers = names
+	u.ApproverKeys = keys
+	u.ApprovalThreshold = threshold
 }
 
 func (u *User) VerifyPublicKey(publicKey string) bool {
@@ -59,17 +110,72 @@ func (u *User) IsInGroup(group string) bool {
 	return false
 }
 
+// ToBytes encodes the user as the versioned User message.
 func (u *User) ToBytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	_ = enc.Encode(u)
-	return buf.Bytes()
+	e := protos.NewVersionedEncoder()
+	e.String(2, u.Name)
+	e.String(3, u.PublicKey)
+	e.Strings(4, u.Groups)
+	if u.Root != nil {
+		e.Message(5, u.Root.ToProto())
+	}
+	e.Uint(6, uint64(u.Role))
+	e.String(7, u.Organization)
+	e.Uint(8, u.Records)
+	e.Int(9, u.DataSize)
+	e.Strings(10, u.Approvers)
+	e.Strings(11, u.ApproverKeys)
+	e.Uint(12, uint64(u.ApprovalThreshold))
+	return e.ToBytes()
 }
 
+// UserFromBytes decodes the user from both the versioned User message and legacy gob encoding.
 func UserFromBytes(data []byte) (*User, error) {
-	buf := bytes.NewBuffer(data)
-	u := &User{}
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(u)
+	u := &User{Groups: make([]string, 0)}
+	if !protos.IsVersioned(data) {
+		buf := bytes.NewBuffer(data)
+		dec := gob.NewDecoder(buf)
+		err := dec.Decode(u)
+		return u, err
+	}
+	err := protos.DecodeVersioned(data, func(f protos.Field) (err error) {
+		var b []byte
+		switch f.Num {
+		case 2:
+			u.Name, err = f.String()
+		case 3:
+			u.PublicKey, err = f.String()
+		case 4:
+			b, err = f.Bytes()
+			u.Groups = append(u.Groups, string(b))
+		case 5:
+			b, err = f.Bytes()
+			if err != nil {
+				return
+			}
+			u.Root, err = storage.RootFromProto(b)
+		case 6:
+			var v uint64
+			v, err = f.Uint()
+			u.Role = UserRole(v)
+		case 7:
+			u.Organization, err = f.String()
+		case 8:
+			u.Records, err = f.Uint()
+		case 9:
+			u.DataSize, err = f.Int()
+		case 10:
+			b, err = f.Bytes()
+			u.Approvers = append(u.Approvers, string(b))
+		case 11:
+			b, err = f.Bytes()
+			u.ApproverKeys = append(u.ApproverKeys, string(b))
+		case 12:
+			var v uint64
+			v, err = f.Uint()
+			u.ApprovalThreshold = uint(v)
+		}
+		return
+	})
 	return u, err
 }